@@ -1,25 +1,67 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 
+	"apigateway/internal/config"
+	"apigateway/internal/logging"
+	"apigateway/internal/proxy"
+	"apigateway/internal/ratelimit"
 	"apigateway/internal/routes"
+	"apigateway/internal/tracing"
+	"apigateway/internal/upstream"
+	"authclient/jwks"
+	"authclient/revocation"
 )
 
 func main() {
 	// Load environment variables from .env file
-	if err := godotenv.Load(); err != nil {
+	envErr := godotenv.Load()
+
+	// Structured JSON logs; the standard log package is routed through slog too
+	logging.Setup("api-gateway")
+	if envErr != nil {
 		log.Println("No .env file found, using environment variables")
 	}
 
-	// Validate JWT_SECRET is set
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		log.Fatal("JWT_SECRET environment variable is required")
+	// Access tokens are verified with the public keys AuthService publishes
+	jwksURL := os.Getenv("JWKS_URL")
+	if jwksURL == "" {
+		log.Fatal("JWKS_URL environment variable is required")
+	}
+
+	// Backends trust the caller identity only from the assertion signed with this secret
+	if os.Getenv("GATEWAY_IDENTITY_SECRET") == "" {
+		log.Fatal("GATEWAY_IDENTITY_SECRET environment variable is required")
+	}
+
+	// AuthService's /internal endpoints are guarded by this token alone; without
+	// it the feeds and notifications served there are not used
+	internalToken := os.Getenv("INTERNAL_API_TOKEN")
+	if internalToken == "" {
+		log.Println("INTERNAL_API_TOKEN not set; Auth Service's internal endpoints are not used")
+	}
+
+	// Stop serving and flush traces on SIGINT/SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Tracing exporter is selected by OTEL_TRACES_EXPORTER (none, otlp, stdout, file)
+	shutdownTracing, err := tracing.Setup(ctx, "api-gateway")
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %v", err)
 	}
 
 	// Set Gin mode
@@ -28,11 +70,52 @@ func main() {
 		gin.SetMode(ginMode)
 	}
 
-	// Create Gin router
-	router := gin.Default()
+	// Shared proxy transport; its connection pool survives route reloads
+	proxyConfig, err := config.LoadProxyConfig()
+	if err != nil {
+		log.Fatalf("Failed to load proxy config: %v", err)
+	}
+	transport := proxy.NewTransport(proxyConfig)
+
+	comps := &routes.Components{
+		Proxy:          proxy.NewEngine(transport),
+		Registry:       upstream.NewRegistry(transport),
+		RateLimiter:    ratelimit.NewLimiter(time.Minute),
+		TrustedProxies: splitList(os.Getenv("TRUSTED_PROXIES")),
+		Keys:           jwks.NewCache(jwksURL),
+	}
+
+	// Signing keys are refetched periodically and whenever a token names an unknown kid
+	jwksInterval, err := time.ParseDuration(getEnvOrDefault("JWKS_REFRESH_INTERVAL", "5m"))
+	if err != nil {
+		log.Fatalf("Invalid JWKS_REFRESH_INTERVAL: %v", err)
+	}
+	go comps.Keys.Run(ctx, jwksInterval)
+
+	// Token revocation list synced from AuthService
+	if feedURL := os.Getenv("REVOCATION_FEED_URL"); feedURL != "" && internalToken != "" {
+		interval, err := time.ParseDuration(getEnvOrDefault("REVOCATION_POLL_INTERVAL", "5s"))
+		if err != nil {
+			log.Fatalf("Invalid REVOCATION_POLL_INTERVAL: %v", err)
+		}
+		comps.Revocations = revocation.NewList(feedURL, internalToken)
+		go comps.Revocations.Run(ctx, interval)
+	} else {
+		log.Println("REVOCATION_FEED_URL or INTERNAL_API_TOKEN not set; revoked tokens are accepted until they expire")
+	}
 
-	// Setup all routes and middlewares
-	routes.SetupRoutes(router)
+	// Load the declarative route table; it is reloaded on SIGHUP or file change
+	routesFile := getEnvOrDefault("ROUTES_FILE", "routes.yaml")
+	reloader, err := routes.NewReloader(routesFile, comps)
+	if err != nil {
+		log.Fatalf("Failed to load routes: %v", err)
+	}
+
+	pollInterval, err := time.ParseDuration(getEnvOrDefault("ROUTES_POLL_INTERVAL", "2s"))
+	if err != nil {
+		log.Fatalf("Invalid ROUTES_POLL_INTERVAL: %v", err)
+	}
+	go reloader.Watch(ctx, pollInterval)
 
 	// Get port from environment
 	port := os.Getenv("PORT")
@@ -41,14 +124,26 @@ func main() {
 	}
 
 	// Start the gateway server
-	log.Printf("API Gateway starting on port %s", port)
-	log.Println("Proxying to backend services:")
-	log.Printf("   - Auth Service: %s", getEnvOrDefault("AUTH_SERVICE_URL", "http://localhost:8001"))
-	log.Printf("   - Product Service: %s", getEnvOrDefault("PRODUCT_SERVICE_URL", "http://localhost:8002"))
-	log.Printf("   - Order Service: %s", getEnvOrDefault("ORDER_SERVICE_URL", "http://localhost:8003"))
+	server := &http.Server{Addr: ":" + port, Handler: reloader}
+	// Event streams never finish on their own; end them so shutdown can drain
+	server.RegisterOnShutdown(comps.Proxy.CloseStreams)
+	go func() {
+		slog.Info("API Gateway starting", "port", port)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Failed to start gateway: %v", err)
+		}
+	}()
 
-	if err := router.Run(":" + port); err != nil {
-		log.Fatalf("Failed to start gateway: %v", err)
+	// Drain in-flight requests, then flush buffered spans
+	<-ctx.Done()
+	slog.Info("API Gateway shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Error("gateway shutdown failed", "error", err)
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		slog.Error("failed to flush traces", "error", err)
 	}
 }
 
@@ -59,3 +154,14 @@ func getEnvOrDefault(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// splitList splits a comma-separated value, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
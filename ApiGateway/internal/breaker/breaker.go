@@ -0,0 +1,228 @@
+package breaker
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// State is the position of a circuit breaker.
+type State int
+
+const (
+	// Closed lets every request through while counting failures.
+	Closed State = iota
+	// Open rejects every request until the cool-down has elapsed.
+	Open
+	// HalfOpen lets a limited number of probe requests through.
+	HalfOpen
+)
+
+// String returns the lower-case name of the state.
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// ErrOpen is returned by Allow while the breaker rejects requests.
+var ErrOpen = errors.New("circuit breaker is open")
+
+// Settings configures when a breaker trips and how it recovers.
+type Settings struct {
+	// FailureRate is the fraction of failed requests (0-1] that opens the breaker.
+	FailureRate float64
+	// MinRequests is the number of requests in a window before FailureRate applies.
+	MinRequests int
+	// Window is the length of the counting window while closed.
+	Window time.Duration
+	// CoolDown is how long the breaker stays open before probing again.
+	CoolDown time.Duration
+	// HalfOpenRequests is the number of successful probes needed to close again.
+	HalfOpenRequests int
+	// OnStateChange is called, with the lock released, after every transition.
+	OnStateChange func(from, to State)
+}
+
+// Breaker is a failure-rate based circuit breaker.
+type Breaker struct {
+	settings Settings
+
+	mu          sync.Mutex
+	state       State
+	generation  uint64
+	windowStart time.Time
+	requests    int
+	failures    int
+	inFlight    int
+	openedAt    time.Time
+}
+
+// Snapshot is a point-in-time view of a breaker for status reporting.
+type Snapshot struct {
+	State      string    `json:"state"`
+	Requests   int       `json:"requests"`
+	Failures   int       `json:"failures"`
+	OpenedAt   time.Time `json:"opened_at,omitempty"`
+	RetryAfter float64   `json:"retry_after_seconds,omitempty"`
+}
+
+// New creates a closed breaker.
+func New(settings Settings) *Breaker {
+	if settings.HalfOpenRequests <= 0 {
+		settings.HalfOpenRequests = 1
+	}
+	return &Breaker{settings: settings, windowStart: time.Now()}
+}
+
+// Allow reports whether a request may proceed. On success it returns a
+// generation that must be passed to Done once the outcome is known. While
+// the breaker is open it returns ErrOpen and the time left until it probes.
+func (b *Breaker) Allow() (generation uint64, retryAfter time.Duration, err error) {
+	b.mu.Lock()
+	from, to := b.advance(time.Now())
+
+	switch b.state {
+	case Open:
+		retryAfter = b.settings.CoolDown - time.Since(b.openedAt)
+		err = ErrOpen
+	case HalfOpen:
+		if b.inFlight+b.requests >= b.settings.HalfOpenRequests {
+			retryAfter = time.Second
+			err = ErrOpen
+			break
+		}
+		b.inFlight++
+	}
+	generation = b.generation
+	b.mu.Unlock()
+
+	b.notify(from, to)
+	return generation, retryAfter, err
+}
+
+// Done records the outcome of a request admitted by Allow. Outcomes from a
+// previous generation (before the last state change) are ignored.
+func (b *Breaker) Done(generation uint64, success bool) {
+	b.mu.Lock()
+	from, to := b.state, b.state
+	if generation == b.generation {
+		from, to = b.record(success)
+	}
+	b.mu.Unlock()
+
+	b.notify(from, to)
+}
+
+// Abandon releases a request admitted by Allow without recording an outcome,
+// e.g. when the client went away before the upstream answered.
+func (b *Breaker) Abandon(generation uint64) {
+	b.mu.Lock()
+	if generation == b.generation && b.state == HalfOpen {
+		b.inFlight--
+	}
+	b.mu.Unlock()
+}
+
+// State returns the current state of the breaker.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	from, to := b.advance(time.Now())
+	state := b.state
+	b.mu.Unlock()
+
+	b.notify(from, to)
+	return state
+}
+
+// Snapshot returns the breaker's current counters.
+func (b *Breaker) Snapshot() Snapshot {
+	b.mu.Lock()
+	from, to := b.advance(time.Now())
+	s := Snapshot{State: b.state.String(), Requests: b.requests, Failures: b.failures}
+	if b.state != Closed {
+		s.OpenedAt = b.openedAt
+	}
+	if b.state == Open {
+		s.RetryAfter = (b.settings.CoolDown - time.Since(b.openedAt)).Seconds()
+	}
+	b.mu.Unlock()
+
+	b.notify(from, to)
+	return s
+}
+
+// advance applies time-based transitions. Callers must hold b.mu.
+func (b *Breaker) advance(now time.Time) (from, to State) {
+	from = b.state
+	switch b.state {
+	case Closed:
+		if now.Sub(b.windowStart) >= b.settings.Window {
+			b.resetCounts(now)
+		}
+	case Open:
+		if now.Sub(b.openedAt) >= b.settings.CoolDown {
+			b.setState(HalfOpen, now)
+		}
+	}
+	return from, b.state
+}
+
+// record counts an outcome and trips or resets the breaker. Callers must hold b.mu.
+func (b *Breaker) record(success bool) (from, to State) {
+	from = b.state
+	now := time.Now()
+
+	switch b.state {
+	case Closed:
+		b.requests++
+		if !success {
+			b.failures++
+		}
+		if b.requests >= b.settings.MinRequests &&
+			float64(b.failures)/float64(b.requests) >= b.settings.FailureRate {
+			b.setState(Open, now)
+		}
+	case HalfOpen:
+		b.inFlight--
+		if !success {
+			b.setState(Open, now)
+			break
+		}
+		b.requests++
+		if b.requests >= b.settings.HalfOpenRequests {
+			b.setState(Closed, now)
+		}
+	}
+	return from, b.state
+}
+
+// setState switches state and starts a new generation. Callers must hold b.mu.
+func (b *Breaker) setState(state State, now time.Time) {
+	b.state = state
+	b.generation++
+	b.inFlight = 0
+	b.resetCounts(now)
+	if state == Open {
+		b.openedAt = now
+	}
+}
+
+func (b *Breaker) resetCounts(now time.Time) {
+	b.windowStart = now
+	b.requests = 0
+	b.failures = 0
+}
+
+func (b *Breaker) notify(from, to State) {
+	if from != to && b.settings.OnStateChange != nil {
+		b.settings.OnStateChange(from, to)
+	}
+}
@@ -0,0 +1,141 @@
+package breaker
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// run sends one request with the given outcome through b.
+func run(t *testing.T, b *Breaker, success bool) {
+	t.Helper()
+	gen, _, err := b.Allow()
+	if err != nil {
+		t.Fatalf("Allow() = %v", err)
+	}
+	b.Done(gen, success)
+}
+
+func TestBreakerTrips(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings Settings
+		outcomes []bool
+		want     State
+	}{
+		{"below min requests", Settings{FailureRate: 0.5, MinRequests: 4, Window: time.Minute, CoolDown: time.Minute},
+			[]bool{false, false, false}, Closed},
+		{"at failure rate", Settings{FailureRate: 0.5, MinRequests: 4, Window: time.Minute, CoolDown: time.Minute},
+			[]bool{true, false, true, false}, Open},
+		{"below failure rate", Settings{FailureRate: 0.5, MinRequests: 4, Window: time.Minute, CoolDown: time.Minute},
+			[]bool{true, true, true, false}, Closed},
+		{"every failure", Settings{FailureRate: 1, MinRequests: 1, Window: time.Minute, CoolDown: time.Minute},
+			[]bool{false}, Open},
+		{"successes only", Settings{FailureRate: 0.1, MinRequests: 1, Window: time.Minute, CoolDown: time.Minute},
+			[]bool{true, true, true}, Closed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := New(tt.settings)
+			for _, ok := range tt.outcomes {
+				run(t, b, ok)
+			}
+			if got := b.State(); got != tt.want {
+				t.Fatalf("State() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBreakerWindowForgetsFailures(t *testing.T) {
+	b := New(Settings{FailureRate: 0.5, MinRequests: 2, Window: 20 * time.Millisecond})
+	run(t, b, false)
+	time.Sleep(30 * time.Millisecond)
+	run(t, b, false)
+	if got := b.State(); got != Closed {
+		t.Fatalf("State() = %s, want closed once the first failure left the window", got)
+	}
+}
+
+func TestBreakerRecovers(t *testing.T) {
+	var transitions []string
+	b := New(Settings{
+		FailureRate: 1, MinRequests: 1, Window: time.Minute,
+		CoolDown: 20 * time.Millisecond, HalfOpenRequests: 2,
+		OnStateChange: func(from, to State) { transitions = append(transitions, from.String()+">"+to.String()) },
+	})
+	run(t, b, false)
+
+	_, retryAfter, err := b.Allow()
+	if !errors.Is(err, ErrOpen) || retryAfter <= 0 {
+		t.Fatalf("Allow() while open = %v, %v; want ErrOpen and a positive wait", retryAfter, err)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	g1, _, err := b.Allow()
+	if err != nil {
+		t.Fatalf("first probe: %v", err)
+	}
+	g2, _, err := b.Allow()
+	if err != nil {
+		t.Fatalf("second probe: %v", err)
+	}
+	if _, _, err := b.Allow(); !errors.Is(err, ErrOpen) {
+		t.Fatalf("third probe = %v, want ErrOpen while probes are in flight", err)
+	}
+	b.Done(g1, true)
+	b.Done(g2, true)
+	if got := b.State(); got != Closed {
+		t.Fatalf("State() = %s, want closed after successful probes", got)
+	}
+
+	want := []string{"closed>open", "open>half-open", "half-open>closed"}
+	if len(transitions) != len(want) {
+		t.Fatalf("transitions = %v, want %v", transitions, want)
+	}
+	for i := range want {
+		if transitions[i] != want[i] {
+			t.Fatalf("transitions = %v, want %v", transitions, want)
+		}
+	}
+}
+
+func TestBreakerFailedProbeReopens(t *testing.T) {
+	b := New(Settings{FailureRate: 1, MinRequests: 1, Window: time.Minute, CoolDown: 10 * time.Millisecond})
+	run(t, b, false)
+	time.Sleep(20 * time.Millisecond)
+	run(t, b, false)
+	if got := b.State(); got != Open {
+		t.Fatalf("State() = %s, want open after a failed probe", got)
+	}
+}
+
+func TestBreakerIgnoresStaleOutcomes(t *testing.T) {
+	b := New(Settings{FailureRate: 1, MinRequests: 1, Window: time.Minute, CoolDown: 10 * time.Millisecond})
+	stale, _, _ := b.Allow()
+	run(t, b, false)
+	time.Sleep(20 * time.Millisecond)
+	if got := b.State(); got != HalfOpen {
+		t.Fatalf("State() = %s, want half-open", got)
+	}
+	// A failure of a request admitted before the breaker opened must not reopen it
+	b.Done(stale, false)
+	if got := b.State(); got != HalfOpen {
+		t.Fatalf("State() after stale outcome = %s, want half-open", got)
+	}
+}
+
+func TestBreakerAbandonFreesProbe(t *testing.T) {
+	b := New(Settings{FailureRate: 1, MinRequests: 1, Window: time.Minute, CoolDown: 10 * time.Millisecond})
+	run(t, b, false)
+	time.Sleep(20 * time.Millisecond)
+	gen, _, err := b.Allow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Abandon(gen)
+	run(t, b, true)
+	if got := b.State(); got != Closed {
+		t.Fatalf("State() = %s, want closed", got)
+	}
+}
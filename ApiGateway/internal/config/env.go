@@ -0,0 +1,34 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// getenvDuration parses a Go duration from the environment, falling back to def.
+func getenvDuration(key string, def time.Duration) (time.Duration, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s; use Go duration format like 5s, 1m", key)
+	}
+	return d, nil
+}
+
+// getenvInt parses an integer from the environment, falling back to def.
+func getenvInt(key string, def int) (int, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s; must be an integer", key)
+	}
+	return n, nil
+}
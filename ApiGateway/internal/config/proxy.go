@@ -0,0 +1,35 @@
+package config
+
+import "time"
+
+// ProxyConfig tunes the shared transport used to reach backend services.
+type ProxyConfig struct {
+	DialTimeout           time.Duration
+	ResponseHeaderTimeout time.Duration
+	IdleConnTimeout       time.Duration
+	MaxIdleConns          int
+	MaxIdleConnsPerHost   int
+}
+
+// LoadProxyConfig reads proxy transport settings from the environment.
+func LoadProxyConfig() (ProxyConfig, error) {
+	var cfg ProxyConfig
+	var err error
+
+	if cfg.DialTimeout, err = getenvDuration("PROXY_DIAL_TIMEOUT", 5*time.Second); err != nil {
+		return cfg, err
+	}
+	if cfg.ResponseHeaderTimeout, err = getenvDuration("PROXY_RESPONSE_HEADER_TIMEOUT", 30*time.Second); err != nil {
+		return cfg, err
+	}
+	if cfg.IdleConnTimeout, err = getenvDuration("PROXY_IDLE_CONN_TIMEOUT", 90*time.Second); err != nil {
+		return cfg, err
+	}
+	if cfg.MaxIdleConns, err = getenvInt("PROXY_MAX_IDLE_CONNS", 100); err != nil {
+		return cfg, err
+	}
+	if cfg.MaxIdleConnsPerHost, err = getenvInt("PROXY_MAX_IDLE_CONNS_PER_HOST", 32); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
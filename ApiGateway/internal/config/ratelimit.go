@@ -0,0 +1,68 @@
+package config
+
+import "fmt"
+
+// RateLimitPolicy allows Requests per Per on average with bursts of up to Burst.
+type RateLimitPolicy struct {
+	Requests float64  `yaml:"requests" json:"requests"`
+	Per      Duration `yaml:"per" json:"per"`
+	Burst    int      `yaml:"burst" json:"burst"`
+}
+
+// RateLimitGroup holds the limits shared by every route referencing it.
+// Authenticated requests are limited per user_id using the policy of their
+// role, falling back to Default; anonymous requests are limited per client IP.
+// A missing policy means that kind of request is not limited.
+type RateLimitGroup struct {
+	Anonymous *RateLimitPolicy           `yaml:"anonymous" json:"anonymous"`
+	Default   *RateLimitPolicy           `yaml:"default" json:"default"`
+	Roles     map[string]RateLimitPolicy `yaml:"roles" json:"roles"`
+}
+
+// PolicyFor returns the policy applying to a request, or nil if it is unlimited.
+func (g RateLimitGroup) PolicyFor(authenticated bool, role string) *RateLimitPolicy {
+	if !authenticated {
+		return g.Anonymous
+	}
+	if p, ok := g.Roles[role]; ok {
+		return &p
+	}
+	return g.Default
+}
+
+// validate checks every policy of the group and fills in the default burst.
+func (g *RateLimitGroup) validate(name string) error {
+	check := func(label string, p *RateLimitPolicy) error {
+		if p.Requests <= 0 || p.Per <= 0 {
+			return fmt.Errorf("rate limit %q: %s needs positive requests and per", name, label)
+		}
+		if p.Burst < 0 {
+			return fmt.Errorf("rate limit %q: %s burst must not be negative", name, label)
+		}
+		if p.Burst == 0 {
+			p.Burst = int(p.Requests)
+			if p.Burst < 1 {
+				p.Burst = 1
+			}
+		}
+		return nil
+	}
+
+	if g.Anonymous != nil {
+		if err := check("anonymous", g.Anonymous); err != nil {
+			return err
+		}
+	}
+	if g.Default != nil {
+		if err := check("default", g.Default); err != nil {
+			return err
+		}
+	}
+	for role, p := range g.Roles {
+		if err := check("role "+role, &p); err != nil {
+			return err
+		}
+		g.Roles[role] = p
+	}
+	return nil
+}
@@ -0,0 +1,277 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MethodAny matches every HTTP method for a route.
+const MethodAny = "ANY"
+
+// Load balancing strategies for upstreams with several instances.
+const (
+	BalancerRoundRobin       = "round_robin"
+	BalancerLeastConnections = "least_connections"
+	BalancerWeighted         = "weighted"
+)
+
+// UpstreamConfig describes a backend service the gateway can proxy to.
+type UpstreamConfig struct {
+	// URL is the default base URL of a single-instance service.
+	URL string `yaml:"url" json:"url"`
+	// URLEnv names an environment variable that overrides the instances when set.
+	// It may hold a comma-separated list of URLs.
+	URLEnv string `yaml:"url_env" json:"url_env"`
+	// Instances lists the replicas of the service; used instead of URL when set.
+	Instances      []InstanceConfig     `yaml:"instances" json:"instances"`
+	Balancer       string               `yaml:"balancer" json:"balancer"`
+	HealthCheck    HealthCheckConfig    `yaml:"health_check" json:"health_check"`
+	CircuitBreaker CircuitBreakerConfig `yaml:"circuit_breaker" json:"circuit_breaker"`
+}
+
+// InstanceConfig is a single replica of an upstream service.
+type InstanceConfig struct {
+	URL    string `yaml:"url" json:"url"`
+	Weight int    `yaml:"weight" json:"weight"`
+}
+
+// HealthCheckConfig configures the active health probe of an upstream.
+type HealthCheckConfig struct {
+	Disabled           bool     `yaml:"disabled" json:"disabled"`
+	Path               string   `yaml:"path" json:"path"`
+	Interval           Duration `yaml:"interval" json:"interval"`
+	Timeout            Duration `yaml:"timeout" json:"timeout"`
+	UnhealthyThreshold int      `yaml:"unhealthy_threshold" json:"unhealthy_threshold"`
+	HealthyThreshold   int      `yaml:"healthy_threshold" json:"healthy_threshold"`
+}
+
+// CircuitBreakerConfig configures the circuit breaker guarding an upstream.
+type CircuitBreakerConfig struct {
+	Disabled bool `yaml:"disabled" json:"disabled"`
+	// FailureRate is the fraction of failed requests (0-1] that opens the breaker.
+	FailureRate float64 `yaml:"failure_rate" json:"failure_rate"`
+	// MinRequests is the number of requests in a window before FailureRate applies.
+	MinRequests int      `yaml:"min_requests" json:"min_requests"`
+	Window      Duration `yaml:"window" json:"window"`
+	CoolDown    Duration `yaml:"cool_down" json:"cool_down"`
+	// HalfOpenRequests is the number of successful probes needed to close again.
+	HalfOpenRequests int `yaml:"half_open_requests" json:"half_open_requests"`
+}
+
+// ResolvedInstances returns the upstream instances, preferring the environment override.
+func (u UpstreamConfig) ResolvedInstances() []InstanceConfig {
+	if u.URLEnv != "" {
+		if v := os.Getenv(u.URLEnv); v != "" {
+			var instances []InstanceConfig
+			for _, raw := range strings.Split(v, ",") {
+				if raw = strings.TrimSpace(raw); raw != "" {
+					instances = append(instances, InstanceConfig{URL: raw, Weight: 1})
+				}
+			}
+			return instances
+		}
+	}
+	if len(u.Instances) > 0 {
+		return u.Instances
+	}
+	if u.URL == "" {
+		return nil
+	}
+	return []InstanceConfig{{URL: u.URL, Weight: 1}}
+}
+
+// applyDefaults fills in balancing and health check defaults.
+func (u *UpstreamConfig) applyDefaults() {
+	if u.Balancer == "" {
+		u.Balancer = BalancerRoundRobin
+	}
+	for i := range u.Instances {
+		if u.Instances[i].Weight == 0 {
+			u.Instances[i].Weight = 1
+		}
+	}
+	hc := &u.HealthCheck
+	if hc.Path == "" {
+		hc.Path = "/readyz"
+	}
+	if hc.Interval == 0 {
+		hc.Interval = Duration(10 * time.Second)
+	}
+	if hc.Timeout == 0 {
+		hc.Timeout = Duration(2 * time.Second)
+	}
+	if hc.UnhealthyThreshold == 0 {
+		hc.UnhealthyThreshold = 3
+	}
+	if hc.HealthyThreshold == 0 {
+		hc.HealthyThreshold = 2
+	}
+	cb := &u.CircuitBreaker
+	if cb.FailureRate == 0 {
+		cb.FailureRate = 0.5
+	}
+	if cb.MinRequests == 0 {
+		cb.MinRequests = 10
+	}
+	if cb.Window == 0 {
+		cb.Window = Duration(30 * time.Second)
+	}
+	if cb.CoolDown == 0 {
+		cb.CoolDown = Duration(15 * time.Second)
+	}
+	if cb.HalfOpenRequests == 0 {
+		cb.HalfOpenRequests = 1
+	}
+}
+
+// RouteConfig describes a single gateway route.
+type RouteConfig struct {
+	Method      string `yaml:"method" json:"method"`
+	Path        string `yaml:"path" json:"path"`
+	Upstream    string `yaml:"upstream" json:"upstream"`
+	StripPrefix string `yaml:"strip_prefix" json:"strip_prefix"`
+	Auth        bool   `yaml:"auth" json:"auth"`
+	// Permissions must all be granted by the caller's token.
+	Permissions []string `yaml:"permissions" json:"permissions"`
+	// Roles, when set, additionally restricts the route to these role names.
+	// Prefer permissions, which follow role changes made in AuthService.
+	Roles []string `yaml:"roles" json:"roles"`
+	// RateLimit names an entry of RouteTable.RateLimits applied to the route.
+	RateLimit string `yaml:"rate_limit" json:"rate_limit"`
+}
+
+// RouteTable is the full declarative route configuration of the gateway.
+type RouteTable struct {
+	Upstreams  map[string]UpstreamConfig `yaml:"upstreams" json:"upstreams"`
+	RateLimits map[string]RateLimitGroup `yaml:"rate_limits" json:"rate_limits"`
+	Routes     []RouteConfig             `yaml:"routes" json:"routes"`
+}
+
+var validMethods = map[string]struct{}{
+	MethodAny:          {},
+	http.MethodGet:     {},
+	http.MethodHead:    {},
+	http.MethodPost:    {},
+	http.MethodPut:     {},
+	http.MethodPatch:   {},
+	http.MethodDelete:  {},
+	http.MethodOptions: {},
+}
+
+// LoadRouteTable reads and validates a route table from a YAML or JSON file.
+// Files ending in .json are decoded as JSON, everything else as YAML.
+func LoadRouteTable(path string) (*RouteTable, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read route table: %w", err)
+	}
+
+	var table RouteTable
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&table); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", path, err)
+		}
+	} else {
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(&table); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", path, err)
+		}
+	}
+
+	if err := table.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid route table %s: %w", path, err)
+	}
+	return &table, nil
+}
+
+// Validate checks the route table for missing or inconsistent fields.
+// Method names are normalised to upper case and upstream defaults are
+// filled in as a side effect.
+func (t *RouteTable) Validate() error {
+	if len(t.Upstreams) == 0 {
+		return fmt.Errorf("no upstreams defined")
+	}
+	for name, u := range t.Upstreams {
+		u.applyDefaults()
+		t.Upstreams[name] = u
+
+		instances := u.ResolvedInstances()
+		if len(instances) == 0 {
+			return fmt.Errorf("upstream %q: url or instances is required", name)
+		}
+		for _, inst := range instances {
+			parsed, err := url.Parse(inst.URL)
+			if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+				return fmt.Errorf("upstream %q: invalid url %q", name, inst.URL)
+			}
+			if inst.Weight < 0 {
+				return fmt.Errorf("upstream %q: instance %s has negative weight", name, inst.URL)
+			}
+		}
+		switch u.Balancer {
+		case BalancerRoundRobin, BalancerLeastConnections, BalancerWeighted:
+		default:
+			return fmt.Errorf("upstream %q: unknown balancer %q", name, u.Balancer)
+		}
+		if !strings.HasPrefix(u.HealthCheck.Path, "/") {
+			return fmt.Errorf("upstream %q: health_check.path must start with /", name)
+		}
+		if cb := u.CircuitBreaker; cb.FailureRate <= 0 || cb.FailureRate > 1 {
+			return fmt.Errorf("upstream %q: circuit_breaker.failure_rate must be in (0, 1]", name)
+		} else if cb.MinRequests < 0 || cb.HalfOpenRequests < 0 || cb.Window < 0 || cb.CoolDown < 0 {
+			return fmt.Errorf("upstream %q: circuit_breaker values must not be negative", name)
+		}
+	}
+
+	for name, g := range t.RateLimits {
+		if err := g.validate(name); err != nil {
+			return err
+		}
+		t.RateLimits[name] = g
+	}
+
+	if len(t.Routes) == 0 {
+		return fmt.Errorf("no routes defined")
+	}
+	for i := range t.Routes {
+		r := &t.Routes[i]
+		r.Method = strings.ToUpper(strings.TrimSpace(r.Method))
+		if r.Method == "" {
+			r.Method = MethodAny
+		}
+		if _, ok := validMethods[r.Method]; !ok {
+			return fmt.Errorf("route %d (%s): unsupported method %q", i, r.Path, r.Method)
+		}
+		if !strings.HasPrefix(r.Path, "/") {
+			return fmt.Errorf("route %d: path %q must start with /", i, r.Path)
+		}
+		if _, ok := t.Upstreams[r.Upstream]; !ok {
+			return fmt.Errorf("route %d (%s %s): unknown upstream %q", i, r.Method, r.Path, r.Upstream)
+		}
+		if r.StripPrefix != "" && !strings.HasPrefix(r.Path, r.StripPrefix) {
+			return fmt.Errorf("route %d (%s %s): strip_prefix %q is not a prefix of the path", i, r.Method, r.Path, r.StripPrefix)
+		}
+		if len(r.Roles) > 0 && !r.Auth {
+			return fmt.Errorf("route %d (%s %s): roles require auth: true", i, r.Method, r.Path)
+		}
+		if len(r.Permissions) > 0 && !r.Auth {
+			return fmt.Errorf("route %d (%s %s): permissions require auth: true", i, r.Method, r.Path)
+		}
+		if _, ok := t.RateLimits[r.RateLimit]; r.RateLimit != "" && !ok {
+			return fmt.Errorf("route %d (%s %s): unknown rate_limit %q", i, r.Method, r.Path, r.RateLimit)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func validTable() *RouteTable {
+	return &RouteTable{
+		Upstreams: map[string]UpstreamConfig{
+			"users": {URL: "http://users:8080"},
+		},
+		RateLimits: map[string]RateLimitGroup{
+			"api": {Anonymous: &RateLimitPolicy{Requests: 10, Per: Duration(time.Minute)}},
+		},
+		Routes: []RouteConfig{
+			{Method: "get", Path: "/users", Upstream: "users", RateLimit: "api"},
+		},
+	}
+}
+
+func TestRouteTableValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(*RouteTable)
+		wantErr string
+	}{
+		{"valid", func(*RouteTable) {}, ""},
+		{"no upstreams", func(t *RouteTable) { t.Upstreams = nil }, "no upstreams defined"},
+		{"no url", func(t *RouteTable) { t.Upstreams["users"] = UpstreamConfig{} }, "url or instances is required"},
+		{"relative url", func(t *RouteTable) { t.Upstreams["users"] = UpstreamConfig{URL: "users:8080"} }, "invalid url"},
+		{"negative weight", func(t *RouteTable) {
+			t.Upstreams["users"] = UpstreamConfig{Instances: []InstanceConfig{{URL: "http://a", Weight: -1}}}
+		}, "negative weight"},
+		{"unknown balancer", func(t *RouteTable) {
+			t.Upstreams["users"] = UpstreamConfig{URL: "http://users", Balancer: "random"}
+		}, "unknown balancer"},
+		{"health path", func(t *RouteTable) {
+			t.Upstreams["users"] = UpstreamConfig{URL: "http://users", HealthCheck: HealthCheckConfig{Path: "readyz"}}
+		}, "health_check.path must start with /"},
+		{"failure rate", func(t *RouteTable) {
+			t.Upstreams["users"] = UpstreamConfig{URL: "http://users", CircuitBreaker: CircuitBreakerConfig{FailureRate: 1.5}}
+		}, "failure_rate must be in (0, 1]"},
+		{"negative breaker", func(t *RouteTable) {
+			t.Upstreams["users"] = UpstreamConfig{URL: "http://users", CircuitBreaker: CircuitBreakerConfig{MinRequests: -1}}
+		}, "must not be negative"},
+		{"rate limit without per", func(t *RouteTable) {
+			t.RateLimits["api"] = RateLimitGroup{Default: &RateLimitPolicy{Requests: 10}}
+		}, "default needs positive requests and per"},
+		{"negative burst", func(t *RouteTable) {
+			t.RateLimits["api"] = RateLimitGroup{Roles: map[string]RateLimitPolicy{
+				"admin": {Requests: 10, Per: Duration(time.Second), Burst: -1},
+			}}
+		}, "role admin burst must not be negative"},
+		{"no routes", func(t *RouteTable) { t.Routes = nil }, "no routes defined"},
+		{"bad method", func(t *RouteTable) { t.Routes[0].Method = "FETCH" }, "unsupported method"},
+		{"relative path", func(t *RouteTable) { t.Routes[0].Path = "users" }, "must start with /"},
+		{"unknown upstream", func(t *RouteTable) { t.Routes[0].Upstream = "orders" }, "unknown upstream"},
+		{"strip prefix", func(t *RouteTable) { t.Routes[0].StripPrefix = "/admin" }, "is not a prefix of the path"},
+		{"roles without auth", func(t *RouteTable) { t.Routes[0].Roles = []string{"admin"} }, "roles require auth"},
+		{"permissions without auth", func(t *RouteTable) {
+			t.Routes[0].Permissions = []string{"user:read"}
+		}, "permissions require auth"},
+		{"permissions with auth", func(t *RouteTable) {
+			t.Routes[0].Auth = true
+			t.Routes[0].Permissions = []string{"user:read"}
+		}, ""},
+		{"unknown rate limit", func(t *RouteTable) { t.Routes[0].RateLimit = "strict" }, "unknown rate_limit"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table := validTable()
+			tt.modify(table)
+			err := table.Validate()
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("Validate() = %v, want nil", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("Validate() = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRouteTableValidateDefaults(t *testing.T) {
+	table := validTable()
+	table.Routes = append(table.Routes, RouteConfig{Path: "/users/:id", Upstream: "users"})
+	if err := table.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if got := table.Routes[0].Method; got != "GET" {
+		t.Errorf("method = %q, want GET", got)
+	}
+	if got := table.Routes[1].Method; got != MethodAny {
+		t.Errorf("empty method = %q, want %s", got, MethodAny)
+	}
+	u := table.Upstreams["users"]
+	if u.Balancer != BalancerRoundRobin || u.HealthCheck.Path != "/readyz" || u.CircuitBreaker.FailureRate != 0.5 {
+		t.Errorf("upstream defaults not applied: %+v", u)
+	}
+	if got := table.RateLimits["api"].Anonymous.Burst; got != 10 {
+		t.Errorf("default burst = %d, want 10", got)
+	}
+}
+
+func TestLoadRouteTable(t *testing.T) {
+	if _, err := LoadRouteTable(filepath.Join("..", "..", "routes.yaml")); err != nil {
+		t.Fatalf("shipped routes.yaml: %v", err)
+	}
+
+	dir := t.TempDir()
+	tests := []struct {
+		file    string
+		content string
+		wantErr string
+	}{
+		{"unknown.yaml", "upstreams: {}\nrouts: []\n", "field routs not found"},
+		{"unknown.json", `{"routs": []}`, "unknown field"},
+		{"invalid.yaml", "upstreams: {}\n", "no upstreams defined"},
+		{"ok.json", `{"upstreams": {"u": {"url": "http://u"}}, "routes": [{"path": "/", "upstream": "u"}]}`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			path := filepath.Join(dir, tt.file)
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			_, err := LoadRouteTable(path)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("LoadRouteTable() = %v, want nil", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("LoadRouteTable() = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+// Package metrics holds the Prometheus collectors of the gateway and the
+// handler exposing them in the text exposition format.
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// unmatchedRoute labels requests that matched no route, keeping the
+// cardinality of the route label bounded by the route table.
+const unmatchedRoute = "unmatched"
+
+var (
+	requestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests handled by the gateway, by route template and status.",
+	}, []string{"method", "route", "status"})
+
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Latency of HTTP requests handled by the gateway, by route template and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	upstreamDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "gateway_upstream_request_duration_seconds",
+		Help:    "Latency of requests proxied to an upstream instance, by upstream and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"upstream", "instance", "status"})
+
+	rateLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gateway_rate_limited_requests_total",
+		Help: "Requests rejected with 429 by a rate limit group.",
+	}, []string{"group"})
+
+	breakerRejections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gateway_circuit_breaker_rejections_total",
+		Help: "Requests rejected with 503 because the upstream circuit breaker was open.",
+	}, []string{"upstream"})
+
+	breakerState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gateway_circuit_breaker_state",
+		Help: "Circuit breaker state of an upstream: 0 closed, 1 open, 2 half-open.",
+	}, []string{"upstream"})
+)
+
+// Middleware records the request counter and latency histogram of every request
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		status := strconv.Itoa(c.Writer.Status())
+		requestsTotal.WithLabelValues(c.Request.Method, route, status).Inc()
+		requestDuration.WithLabelValues(c.Request.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+// Handler serves all registered metrics in the Prometheus text format
+func Handler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.Handler())
+}
+
+// ObserveUpstream records the latency of a request proxied to an upstream instance
+func ObserveUpstream(upstream, instance string, status int, d time.Duration) {
+	upstreamDuration.WithLabelValues(upstream, instance, strconv.Itoa(status)).Observe(d.Seconds())
+}
+
+// RateLimited counts a request rejected by the named rate limit group
+func RateLimited(group string) {
+	rateLimited.WithLabelValues(group).Inc()
+}
+
+// BreakerRejected counts a request rejected by an open circuit breaker
+func BreakerRejected(upstream string) {
+	breakerRejections.WithLabelValues(upstream).Inc()
+}
+
+// SetBreakerState records the current circuit breaker state of an upstream
+func SetBreakerState(upstream string, state int) {
+	breakerState.WithLabelValues(upstream).Set(float64(state))
+}
+
+// DeleteBreakerState drops the circuit breaker state of a replaced or removed upstream
+func DeleteBreakerState(upstream string) {
+	breakerState.DeleteLabelValues(upstream)
+}
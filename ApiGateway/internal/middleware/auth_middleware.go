@@ -3,15 +3,18 @@ package middleware
 import (
 	"fmt"
 	"net/http"
+	"slices"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 
 	"apigateway/internal/utils"
+	"authclient/jwks"
+	"authclient/revocation"
 )
 
-// AuthMiddleware validates JWT tokens and extracts user information
-func AuthMiddleware() gin.HandlerFunc {
+// AuthMiddleware validates JWT tokens with the cached signing keys, rejects revoked ones and extracts user information
+func AuthMiddleware(keys *jwks.Cache, revocations *revocation.List) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Get Authorization header
 		authHeader := c.GetHeader("Authorization")
@@ -30,27 +33,58 @@ func AuthMiddleware() gin.HandlerFunc {
 		}
 
 		// Validate token
-		claims, err := utils.ValidateToken(tokenString)
+		claims, err := utils.ValidateToken(tokenString, keys)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": fmt.Sprintf("invalid token: %v", err)})
 			c.Abort()
 			return
 		}
 
+		// Reject tokens revoked by logout or by a superadmin
+		issuedAt := revocation.IssuedAt(claims.IssuedAt, claims.IssuedAtMs)
+		if revocations.IsRevoked(claims.ID, claims.UserID, issuedAt) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "token has been revoked"})
+			c.Abort()
+			return
+		}
+
 		// Add user information to context
 		c.Set("user_id", claims.UserID)
 		c.Set("role", claims.Role)
+		c.Set("permissions", claims.Permissions)
 
-		// Add custom headers for downstream services
-		c.Request.Header.Set("X-User-ID", fmt.Sprintf("%d", claims.UserID))
-		c.Request.Header.Set("X-User-Role", claims.Role)
+		// Backends learn who the caller is only from the signed identity assertion
+		assertion, err := utils.SignIdentity(claims)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to sign identity"})
+			c.Abort()
+			return
+		}
+		c.Request.Header.Set(utils.IdentityHeader, assertion)
+
+		c.Next()
+	}
+}
 
+// StripIdentityHeaders removes client-supplied identity headers from every request.
+// Only the gateway itself may assert who the caller is, after validating the JWT.
+func StripIdentityHeaders() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for key := range c.Request.Header {
+			if strings.HasPrefix(key, "X-User-") || key == utils.IdentityHeader {
+				c.Request.Header.Del(key)
+			}
+		}
 		c.Next()
 	}
 }
 
-// AdminOnlyMiddleware restricts access to admin and superadmin roles
-func AdminOnlyMiddleware() gin.HandlerFunc {
+// RequireRoles restricts access to users whose role is one of the allowed roles
+func RequireRoles(roles ...string) gin.HandlerFunc {
+	allowed := make(map[string]struct{}, len(roles))
+	for _, r := range roles {
+		allowed[r] = struct{}{}
+	}
 	return func(c *gin.Context) {
 		role, exists := c.Get("role")
 		if !exists {
@@ -59,9 +93,9 @@ func AdminOnlyMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		roleStr, ok := role.(string)
-		if !ok || (roleStr != "saler" && roleStr != "superadmin") {
-			c.JSON(http.StatusForbidden, gin.H{"error": "admin access required"})
+		roleStr, _ := role.(string)
+		if _, ok := allowed[roleStr]; !ok {
+			c.JSON(http.StatusForbidden, gin.H{"error": "insufficient role"})
 			c.Abort()
 			return
 		}
@@ -69,3 +103,20 @@ func AdminOnlyMiddleware() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// RequirePermission restricts access to users whose token grants every one of the permissions
+func RequirePermission(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		granted, _ := c.Get("permissions")
+		list, _ := granted.([]string)
+		for _, p := range permissions {
+			if !slices.Contains(list, p) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "missing permission " + p})
+				c.Abort()
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
@@ -1,14 +1,33 @@
 package middleware
 
 import (
-	"fmt"
-	"log"
+	"log/slog"
 	"time"
 
 	"github.com/gin-gonic/gin"
+
+	"apigateway/internal/logging"
 )
 
-// LoggingMiddleware logs all incoming requests with user context
+// RequestIDMiddleware reuses a valid inbound X-Request-ID or generates a new one,
+// stores it in the request context and sets it on the forwarded request and the response
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(logging.RequestIDHeader)
+		if !logging.ValidRequestID(id) {
+			id = logging.NewRequestID()
+		}
+
+		c.Set("request_id", id)
+		c.Request = c.Request.WithContext(logging.WithRequestID(c.Request.Context(), id))
+		c.Request.Header.Set(logging.RequestIDHeader, id)
+		c.Header(logging.RequestIDHeader, id)
+
+		c.Next()
+	}
+}
+
+// LoggingMiddleware logs all incoming requests as structured JSON with user context
 func LoggingMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Start timer
@@ -17,24 +36,30 @@ func LoggingMiddleware() gin.HandlerFunc {
 		// Process request
 		c.Next()
 
-		// Calculate latency
-		latency := time.Since(start)
+		status := c.Writer.Status()
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("route", c.FullPath()),
+			slog.String("path", c.Request.URL.Path),
+			slog.Int("status", status),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("client_ip", c.ClientIP()),
+		}
 
 		// Get user_id from context if available
-		userID, exists := c.Get("user_id")
-		userIDStr := "anonymous"
-		if exists {
-			userIDStr = fmt.Sprintf("%v", userID)
+		if userID, exists := c.Get("user_id"); exists {
+			attrs = append(attrs, slog.Any("user_id", userID))
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("errors", c.Errors.String()))
 		}
 
-		// Log request details
-		log.Printf("[%s] %s %s | Status: %d | Latency: %v | User: %s",
-			c.Request.Method,
-			c.Request.URL.Path,
-			c.Request.Proto,
-			c.Writer.Status(),
-			latency,
-			userIDStr,
-		)
+		level := slog.LevelInfo
+		if status >= 500 {
+			level = slog.LevelError
+		} else if status >= 400 {
+			level = slog.LevelWarn
+		}
+		logging.FromContext(c.Request.Context()).LogAttrs(c.Request.Context(), level, "request", attrs...)
 	}
 }
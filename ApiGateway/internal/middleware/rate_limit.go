@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"apigateway/internal/config"
+	"apigateway/internal/metrics"
+	"apigateway/internal/ratelimit"
+)
+
+// RateLimitMiddleware enforces the token-bucket limits of a rate limit group.
+// Authenticated requests are keyed by user_id and limited by role; anonymous
+// requests are keyed by client IP. Must run after AuthMiddleware on protected routes.
+func RateLimitMiddleware(limiter *ratelimit.Limiter, name string, group config.RateLimitGroup) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, authenticated := c.Get("user_id")
+		role := c.GetString("role")
+
+		policy := group.PolicyFor(authenticated, role)
+		if policy == nil {
+			c.Next()
+			return
+		}
+
+		key := name + "|ip:" + c.ClientIP()
+		if authenticated {
+			key = fmt.Sprintf("%s|user:%v", name, userID)
+		}
+
+		res := limiter.Take(key, ratelimit.Policy{
+			Requests: policy.Requests,
+			Per:      policy.Per.Std(),
+			Burst:    policy.Burst,
+		})
+
+		c.Header("X-RateLimit-Limit", strconv.Itoa(res.Limit))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		c.Header("X-RateLimit-Reset", strconv.FormatInt(res.Reset.Unix(), 10))
+
+		if !res.Allowed {
+			metrics.RateLimited(name)
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(res.RetryAfter.Seconds()))))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "rate limit exceeded"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -1,129 +1,254 @@
 package proxy
 
 import (
+	"context"
+	"errors"
 	"io"
-	"log"
+	"math"
+	"mime"
+	"net"
 	"net/http"
+	"net/http/httputil"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+
+	"apigateway/internal/config"
+	"apigateway/internal/logging"
+	"apigateway/internal/metrics"
+	"apigateway/internal/upstream"
 )
 
-// ProxyHandler creates a reverse proxy handler for a backend service
-func ProxyHandler(targetURL string) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		// Build target URL
-		path := c.Request.URL.Path
-		rawQuery := c.Request.URL.RawQuery
-
-		// Construct full target URL
-		fullURL := targetURL + path
-		if rawQuery != "" {
-			fullURL += "?" + rawQuery
-		}
+// statusClientClosedRequest is recorded when the client goes away mid-request.
+const statusClientClosedRequest = 499
 
-		// Debug log: where the request is being proxied
-		log.Printf("Proxying %s %s -> %s", c.Request.Method, c.Request.URL.String(), fullURL)
+// Engine forwards requests to backend services over a shared, pooled transport.
+// A single Engine is meant to live for the whole process so connections are
+// reused across route table reloads.
+type Engine struct {
+	rp *httputil.ReverseProxy
 
-		// Create new request to backend service
-		req, err := http.NewRequest(c.Request.Method, fullURL, c.Request.Body)
-		if err != nil {
-			log.Printf("Error creating proxy request: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create proxy request"})
-			return
-		}
+	// closing is cancelled by CloseStreams to end open event streams
+	closing      context.Context
+	closeStreams context.CancelFunc
+}
+
+// target is the per-request forwarding decision, carried in the request context.
+type target struct {
+	pool        *upstream.Pool
+	instance    *upstream.Instance
+	stripPrefix string
+	// settle records the upstream's answer in metrics and the breaker; only
+	// the first call counts
+	settle func(status int)
+}
+
+type targetKey struct{}
+
+// NewEngine creates a proxy engine that forwards over transport. Every
+// forwarded request gets a client span and a traceparent header continuing
+// the trace of the incoming request.
+//
+// Server-Sent Events (text/event-stream) responses are flushed to the client
+// as each event arrives. They may stay open for hours, so their outcome is
+// recorded as soon as the upstream sends the headers.
+func NewEngine(transport http.RoundTripper) *Engine {
+	e := &Engine{}
+	e.closing, e.closeStreams = context.WithCancel(context.Background())
+	e.rp = &httputil.ReverseProxy{
+		Rewrite:        rewrite,
+		Transport:      otelhttp.NewTransport(transport, otelhttp.WithSpanNameFormatter(spanName)),
+		ErrorHandler:   handleError,
+		ModifyResponse: e.modifyResponse,
+	}
+	return e
+}
 
-		// Copy headers from original request
-		for key, values := range c.Request.Header {
-			for _, value := range values {
-				req.Header.Add(key, value)
+// CloseStreams ends every open event stream so a graceful shutdown does not
+// wait for them. Clients reconnect, to another gateway instance if there is
+// one. Later streams are closed as soon as they start.
+func (e *Engine) CloseStreams() {
+	e.closeStreams()
+}
+
+// NewTransport builds the keep-alive transport shared by all proxied requests.
+func NewTransport(cfg config.ProxyConfig) *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   cfg.DialTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          cfg.MaxIdleConns,
+		MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+		IdleConnTimeout:       cfg.IdleConnTimeout,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: cfg.ResponseHeaderTimeout,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
+
+// Handler returns a Gin handler proxying to an instance of pool chosen by its
+// balancer. When stripPrefix is set it is removed from the request path
+// before forwarding.
+//
+// Hop-by-hop headers are dropped in both directions, X-Forwarded-For/Host/Proto
+// are set from the client connection, bodies are streamed rather than buffered
+// and the upstream request is cancelled when the client disconnects.
+//
+// While the pool's circuit breaker is open requests fail fast with 503 and a
+// Retry-After header instead of waiting for the upstream.
+func (e *Engine) Handler(pool *upstream.Pool, stripPrefix string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cb := pool.Breaker()
+		var generation uint64
+		if cb != nil {
+			gen, retryAfter, err := cb.Allow()
+			if err != nil {
+				metrics.BreakerRejected(pool.Name)
+				c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+				c.JSON(http.StatusServiceUnavailable, gin.H{"error": pool.Name + " service temporarily unavailable"})
+				c.Abort()
+				return
 			}
+			generation = gen
 		}
 
-		// Execute the request
-		client := &http.Client{}
-		resp, err := client.Do(req)
-		if err != nil {
-			log.Printf("Error forwarding request to %s: %v", targetURL, err)
-			c.JSON(http.StatusBadGateway, gin.H{"error": "service unavailable"})
+		inst := pool.Next()
+		if inst == nil {
+			if cb != nil {
+				cb.Done(generation, false)
+			}
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "no healthy upstream for " + pool.Name})
+			c.Abort()
 			return
 		}
-		defer resp.Body.Close()
 
-		// Copy response headers
-		for key, values := range resp.Header {
-			for _, value := range values {
-				c.Writer.Header().Add(key, value)
-			}
+		inst.Acquire()
+		defer inst.Release()
+
+		start := time.Now()
+		var once sync.Once
+		settle := func(status int) {
+			once.Do(func() {
+				metrics.ObserveUpstream(pool.Name, inst.URL.Host, status, time.Since(start))
+				if cb == nil {
+					return
+				}
+				if status == statusClientClosedRequest {
+					// The client gave up; this says nothing about the upstream
+					cb.Abandon(generation)
+				} else {
+					cb.Done(generation, !isUpstreamFailure(status))
+				}
+			})
 		}
 
-		// Set status code
-		c.Status(resp.StatusCode)
-
-		// Copy response body
-		_, err = io.Copy(c.Writer, resp.Body)
-		if err != nil {
-			log.Printf("Error copying response body: %v", err)
-		}
+		t := &target{pool: pool, instance: inst, stripPrefix: stripPrefix, settle: settle}
+		ctx := context.WithValue(c.Request.Context(), targetKey{}, t)
+		e.serve(c.Writer, c.Request.WithContext(ctx))
+		settle(c.Writer.Status())
 	}
 }
 
-// StripPrefixProxy strips the prefix from the path before forwarding
-func StripPrefixProxy(prefix, targetURL string) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		// Strip prefix from path
-		path := c.Request.URL.Path
-		if strings.HasPrefix(path, prefix) {
-			path = strings.TrimPrefix(path, prefix)
+// serve forwards r. A response body cut off midway, which is how every event
+// stream ends when its client goes away, makes ReverseProxy panic with
+// http.ErrAbortHandler; the response simply ends there instead of reaching
+// gin's recovery as a crash.
+func (e *Engine) serve(w http.ResponseWriter, r *http.Request) {
+	defer func() {
+		if err := recover(); err != nil && err != http.ErrAbortHandler {
+			panic(err)
 		}
+	}()
+	e.rp.ServeHTTP(w, r)
+}
 
-		rawQuery := c.Request.URL.RawQuery
+// isUpstreamFailure reports whether a response status counts against the breaker.
+func isUpstreamFailure(status int) bool {
+	return status == http.StatusBadGateway ||
+		status == http.StatusServiceUnavailable ||
+		status == http.StatusGatewayTimeout
+}
 
-		// Construct full target URL
-		fullURL := targetURL + path
-		if rawQuery != "" {
-			fullURL += "?" + rawQuery
-		}
+// spanName names the client span of a forwarded request after its upstream.
+func spanName(_ string, r *http.Request) string {
+	if t, ok := r.Context().Value(targetKey{}).(*target); ok {
+		return "proxy " + t.pool.Name
+	}
+	return "proxy " + r.Method
+}
 
-		// Create new request to backend service
-		req, err := http.NewRequest(c.Request.Method, fullURL, c.Request.Body)
-		if err != nil {
-			log.Printf("Error creating proxy request: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create proxy request"})
-			return
-		}
+// rewrite points the outbound request at the chosen instance.
+func rewrite(pr *httputil.ProxyRequest) {
+	t := pr.In.Context().Value(targetKey{}).(*target)
+	if t.stripPrefix != "" {
+		pr.Out.URL.Path = strings.TrimPrefix(pr.Out.URL.Path, t.stripPrefix)
+		pr.Out.URL.RawPath = ""
+	}
+	pr.SetURL(t.instance.URL)
+	pr.SetXForwarded()
+}
 
-		// Copy headers from original request
-		for key, values := range c.Request.Header {
-			for _, value := range values {
-				req.Header.Add(key, value)
-			}
-		}
+// modifyResponse drops the upstream's copy of the request ID; the gateway
+// already set it on the client response. Event streams are settled right away
+// and closed by CloseStreams.
+func (e *Engine) modifyResponse(resp *http.Response) error {
+	resp.Header.Del(logging.RequestIDHeader)
+	if !isEventStream(resp) {
+		return nil
+	}
+	resp.Request.Context().Value(targetKey{}).(*target).settle(resp.StatusCode)
+	// Tell buffering proxies in front of the gateway (e.g. nginx) to pass events on
+	resp.Header.Set("X-Accel-Buffering", "no")
+	body := resp.Body
+	stop := context.AfterFunc(e.closing, func() { body.Close() })
+	resp.Body = &streamBody{ReadCloser: body, stop: stop}
+	return nil
+}
 
-		// Execute the request
-		client := &http.Client{}
-		resp, err := client.Do(req)
-		if err != nil {
-			log.Printf("Error forwarding request to %s: %v", targetURL, err)
-			c.JSON(http.StatusBadGateway, gin.H{"error": "service unavailable"})
-			return
-		}
-		defer resp.Body.Close()
+// isEventStream reports whether resp is a Server-Sent Events stream.
+func isEventStream(resp *http.Response) bool {
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return mediaType == "text/event-stream"
+}
 
-		// Copy response headers
-		for key, values := range resp.Header {
-			for _, value := range values {
-				c.Writer.Header().Add(key, value)
-			}
-		}
+// streamBody is the body of an event stream, closed early by CloseStreams.
+type streamBody struct {
+	io.ReadCloser
+	stop func() bool
+}
 
-		// Set status code
-		c.Status(resp.StatusCode)
+// Close releases the stream's CloseStreams hook and closes the body.
+func (b *streamBody) Close() error {
+	b.stop()
+	return b.ReadCloser.Close()
+}
 
-		// Copy response body
-		_, err = io.Copy(c.Writer, resp.Body)
-		if err != nil {
-			log.Printf("Error copying response body: %v", err)
-		}
+// handleError reports upstream failures to the client: 504 when the upstream
+// did not answer in time, 502 otherwise.
+func handleError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, context.Canceled) && r.Context().Err() != nil {
+		// Client disconnected; nobody is left to read a response
+		w.WriteHeader(statusClientClosedRequest)
+		return
+	}
+	t := r.Context().Value(targetKey{}).(*target)
+	logging.FromContext(r.Context()).Error("upstream request failed",
+		"method", r.Method, "path", r.URL.Path,
+		"upstream", t.pool.Name, "instance", t.instance.URL.String(), "error", err)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		w.WriteHeader(http.StatusGatewayTimeout)
+		_, _ = w.Write([]byte(`{"error":"service timed out"}`))
+		return
 	}
+	w.WriteHeader(http.StatusBadGateway)
+	_, _ = w.Write([]byte(`{"error":"service unavailable"}`))
 }
@@ -0,0 +1,222 @@
+package proxy
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"apigateway/internal/config"
+	"apigateway/internal/middleware"
+	"apigateway/internal/upstream"
+	"apigateway/internal/utils"
+)
+
+// testTransport is the transport of the tests: short timeouts so a hanging
+// upstream fails fast.
+func testTransport() *http.Transport {
+	return NewTransport(config.ProxyConfig{
+		DialTimeout:           time.Second,
+		ResponseHeaderTimeout: 200 * time.Millisecond,
+		IdleConnTimeout:       time.Second,
+		MaxIdleConns:          4,
+		MaxIdleConnsPerHost:   4,
+	})
+}
+
+// newGateway serves /api/* through e to the upstream at backendURL, with the
+// prefix stripped, behind the identity header filter of the real gateway.
+func newGateway(t *testing.T, e *Engine, backendURL string) *httptest.Server {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	pool, err := upstream.NewPool("backend", config.UpstreamConfig{
+		URL:            backendURL,
+		CircuitBreaker: config.CircuitBreakerConfig{Disabled: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.Use(middleware.StripIdentityHeaders())
+	r.Any("/api/*path", e.Handler(pool, "/api"))
+	gw := httptest.NewServer(r)
+	t.Cleanup(gw.Close)
+	return gw
+}
+
+func TestProxyHeaders(t *testing.T) {
+	// The backend answers with the path and headers it received
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"path": r.URL.Path, "header": r.Header})
+	}))
+	defer backend.Close()
+	gw := newGateway(t, NewEngine(testTransport()), backend.URL)
+
+	req, _ := http.NewRequest(http.MethodGet, gw.URL+"/api/items?page=2", nil)
+	req.Header.Set("X-User-Id", "1")
+	req.Header.Set("X-User-Role", "superadmin")
+	req.Header.Set(utils.IdentityHeader, "forged")
+	req.Header.Set("X-Forwarded-For", "203.0.113.7")
+	req.Header.Set("X-Forwarded-Host", "evil.example.com")
+	req.Header.Set("Connection", "X-Hop")
+	req.Header.Set("X-Hop", "1")
+	req.Header.Set("X-Custom", "kept")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var got struct {
+		Path   string
+		Header http.Header
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Path != "/items" {
+		t.Errorf("path = %q, want /items", got.Path)
+	}
+	for _, name := range []string{"X-User-Id", "X-User-Role", utils.IdentityHeader, "X-Hop"} {
+		if v := got.Header.Get(name); v != "" {
+			t.Errorf("%s = %q reached the backend", name, v)
+		}
+	}
+	gwURL, _ := url.Parse(gw.URL)
+	want := map[string]string{
+		"X-Forwarded-For":   "127.0.0.1",
+		"X-Forwarded-Host":  gwURL.Host,
+		"X-Forwarded-Proto": "http",
+		"X-Custom":          "kept",
+	}
+	for name, v := range want {
+		if got.Header.Get(name) != v {
+			t.Errorf("%s = %q, want %q", name, got.Header.Get(name), v)
+		}
+	}
+}
+
+// streamBackend sends one event and holds the stream open until the client
+// goes away or release is closed.
+func streamBackend(release <-chan struct{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = io.WriteString(w, "data: hello\n\n")
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+}
+
+// readEvent reads the first line of the stream, failing after a second.
+func readEvent(t *testing.T, r *bufio.Reader) string {
+	t.Helper()
+	line := make(chan string, 1)
+	go func() {
+		s, _ := r.ReadString('\n')
+		line <- s
+	}()
+	select {
+	case s := <-line:
+		return s
+	case <-time.After(time.Second):
+		t.Fatal("event was not flushed to the client")
+		return ""
+	}
+}
+
+func TestEventStreamFlushes(t *testing.T) {
+	release := make(chan struct{})
+	backend := streamBackend(release)
+	defer backend.Close()
+	defer close(release)
+	gw := newGateway(t, NewEngine(testTransport()), backend.URL)
+
+	resp, err := http.Get(gw.URL + "/api/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if got := resp.Header.Get("X-Accel-Buffering"); got != "no" {
+		t.Errorf("X-Accel-Buffering = %q, want no", got)
+	}
+	// The backend is still holding the stream open
+	if got := readEvent(t, bufio.NewReader(resp.Body)); got != "data: hello\n" {
+		t.Errorf("first line = %q", got)
+	}
+}
+
+func TestCloseStreamsEndsOpenStreams(t *testing.T) {
+	release := make(chan struct{})
+	backend := streamBackend(release)
+	defer backend.Close()
+	defer close(release)
+	e := NewEngine(testTransport())
+	gw := newGateway(t, e, backend.URL)
+
+	resp, err := http.Get(gw.URL + "/api/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body := bufio.NewReader(resp.Body)
+	readEvent(t, body)
+
+	e.CloseStreams()
+	done := make(chan error, 1)
+	go func() {
+		_, err := io.ReadAll(body)
+		done <- err
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("stream still open after CloseStreams")
+	}
+}
+
+func TestUpstreamErrors(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer slow.Close()
+	defer close(release)
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	tests := []struct {
+		name    string
+		backend string
+		want    int
+	}{
+		{"unreachable", down.URL, http.StatusBadGateway},
+		{"no response headers in time", slow.URL, http.StatusGatewayTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gw := newGateway(t, NewEngine(testTransport()), tt.backend)
+			resp, err := http.Get(gw.URL + "/api/items")
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// Policy is a token bucket refilled with Requests tokens every Per, holding at most Burst tokens.
+type Policy struct {
+	Requests float64
+	Per      time.Duration
+	Burst    int
+}
+
+// ratePerSecond returns the refill rate in tokens per second.
+func (p Policy) ratePerSecond() float64 {
+	return p.Requests / p.Per.Seconds()
+}
+
+// id identifies the policy so buckets are recreated when limits change.
+func (p Policy) id() string {
+	return fmt.Sprintf("%g/%s/%d", p.Requests, p.Per, p.Burst)
+}
+
+// Result describes the outcome of a Take call.
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Time     // when the bucket will be full again
+	RetryAfter time.Duration // when the next token is available, if rejected
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	full   time.Time // when the bucket will have refilled completely
+}
+
+// Limiter keeps token buckets for every subject across route table reloads.
+type Limiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+// NewLimiter creates a limiter and starts a janitor that drops, every
+// interval, buckets that have refilled completely. Such buckets are
+// indistinguishable from new ones, so removing them never relaxes a limit.
+func NewLimiter(interval time.Duration) *Limiter {
+	l := &Limiter{buckets: map[string]*bucket{}}
+	go l.sweep(interval)
+	return l
+}
+
+// Take removes one token from the bucket identified by key under policy p.
+func (l *Limiter) Take(key string, p Policy) Result {
+	now := time.Now()
+	rate := p.ratePerSecond()
+	capacity := float64(p.Burst)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	k := p.id() + "|" + key
+	b, ok := l.buckets[k]
+	if !ok {
+		b = &bucket{tokens: capacity, last: now}
+		l.buckets[k] = b
+	} else {
+		b.tokens = math.Min(capacity, b.tokens+now.Sub(b.last).Seconds()*rate)
+		b.last = now
+	}
+
+	res := Result{Limit: p.Burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = time.Duration((1 - b.tokens) / rate * float64(time.Second))
+	}
+	res.Remaining = int(b.tokens)
+	res.Reset = now.Add(time.Duration((capacity - b.tokens) / rate * float64(time.Second)))
+	b.full = res.Reset
+	return res
+}
+
+// sweep periodically removes full buckets so memory does not grow with every client seen.
+func (l *Limiter) sweep(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		now := time.Now()
+		l.mu.Lock()
+		for k, b := range l.buckets {
+			if now.After(b.full) {
+				delete(l.buckets, k)
+			}
+		}
+		l.mu.Unlock()
+	}
+}
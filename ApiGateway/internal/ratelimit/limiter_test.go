@@ -0,0 +1,100 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTakeBurst(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      Policy
+		takes       int
+		wantAllowed int
+	}{
+		{"within burst", Policy{Requests: 10, Per: time.Minute, Burst: 5}, 5, 5},
+		{"past burst", Policy{Requests: 10, Per: time.Minute, Burst: 5}, 8, 5},
+		{"burst of one", Policy{Requests: 1, Per: time.Hour, Burst: 1}, 3, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewLimiter(time.Hour)
+			allowed := 0
+			for i := 0; i < tt.takes; i++ {
+				res := l.Take("ip:1.2.3.4", tt.policy)
+				if res.Limit != tt.policy.Burst {
+					t.Fatalf("Limit = %d, want %d", res.Limit, tt.policy.Burst)
+				}
+				if res.Allowed {
+					allowed++
+					if res.Remaining != tt.policy.Burst-allowed {
+						t.Fatalf("Remaining = %d after %d requests, want %d", res.Remaining, allowed, tt.policy.Burst-allowed)
+					}
+				} else if res.RetryAfter <= 0 || res.Remaining != 0 {
+					t.Fatalf("rejected with RetryAfter %v and Remaining %d", res.RetryAfter, res.Remaining)
+				}
+			}
+			if allowed != tt.wantAllowed {
+				t.Fatalf("allowed %d of %d requests, want %d", allowed, tt.takes, tt.wantAllowed)
+			}
+		})
+	}
+}
+
+func TestTakeRetryAfter(t *testing.T) {
+	l := NewLimiter(time.Hour)
+	p := Policy{Requests: 1, Per: 10 * time.Second, Burst: 1}
+	l.Take("k", p)
+	res := l.Take("k", p)
+	if res.Allowed {
+		t.Fatal("second request allowed")
+	}
+	if res.RetryAfter < 9*time.Second || res.RetryAfter > 10*time.Second {
+		t.Fatalf("RetryAfter = %v, want about 10s", res.RetryAfter)
+	}
+	if wait := time.Until(res.Reset); wait < 9*time.Second || wait > 10*time.Second {
+		t.Fatalf("Reset in %v, want about 10s", wait)
+	}
+}
+
+func TestTakeRefills(t *testing.T) {
+	l := NewLimiter(time.Hour)
+	p := Policy{Requests: 1, Per: 20 * time.Millisecond, Burst: 1}
+	if !l.Take("k", p).Allowed {
+		t.Fatal("first request rejected")
+	}
+	if l.Take("k", p).Allowed {
+		t.Fatal("second request allowed before refill")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if !l.Take("k", p).Allowed {
+		t.Fatal("request rejected after refill")
+	}
+}
+
+func TestTakeSeparatesKeysAndPolicies(t *testing.T) {
+	l := NewLimiter(time.Hour)
+	p := Policy{Requests: 1, Per: time.Hour, Burst: 1}
+	l.Take("user:1", p)
+	if !l.Take("user:2", p).Allowed {
+		t.Fatal("another key shares the bucket")
+	}
+	// Changing the policy, e.g. on a route table reload, starts a new bucket
+	if !l.Take("user:1", Policy{Requests: 2, Per: time.Hour, Burst: 2}).Allowed {
+		t.Fatal("a changed policy shares the bucket")
+	}
+}
+
+func TestSweepDropsFullBuckets(t *testing.T) {
+	l := NewLimiter(10 * time.Millisecond)
+	l.Take("full", Policy{Requests: 1, Per: time.Millisecond, Burst: 1})
+	l.Take("empty", Policy{Requests: 1, Per: time.Hour, Burst: 1})
+	time.Sleep(50 * time.Millisecond)
+
+	l.mu.Lock()
+	n := len(l.buckets)
+	l.mu.Unlock()
+	if n != 1 {
+		t.Fatalf("%d buckets left, want only the one still refilling", n)
+	}
+}
@@ -0,0 +1,122 @@
+package routes
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"apigateway/internal/config"
+)
+
+// Reloader serves requests through the most recently loaded route table.
+// Reloads swap the active engine atomically, so in-flight requests finish on
+// the engine they started on while new requests use the new table.
+type Reloader struct {
+	path    string
+	comps   *Components
+	engine  atomic.Pointer[gin.Engine]
+	mu      sync.Mutex
+	modTime time.Time
+}
+
+// NewReloader loads the route table at path and builds the initial engine.
+// All engines built by the reloader share comps.
+func NewReloader(path string, comps *Components) (*Reloader, error) {
+	r := &Reloader{path: path, comps: comps}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// ServeHTTP dispatches the request to the active engine.
+func (r *Reloader) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.engine.Load().ServeHTTP(w, req)
+}
+
+// Reload re-reads the route table and swaps in a new engine.
+// On error the previously loaded table keeps serving.
+func (r *Reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return err
+	}
+
+	table, err := config.LoadRouteTable(r.path)
+	if err != nil {
+		return err
+	}
+	pools, err := r.comps.Registry.Resolve(table.Upstreams)
+	if err != nil {
+		return err
+	}
+	engine, err := NewEngine(table, r.comps, pools)
+	if err != nil {
+		return err
+	}
+
+	r.engine.Store(engine)
+	r.comps.Registry.Commit(pools)
+	r.modTime = info.ModTime()
+	slog.Info("route table loaded", "file", r.path, "routes", len(table.Routes))
+	return nil
+}
+
+// Watch reloads the route table on SIGHUP or when the file's modification
+// time changes, polling every interval. It blocks until ctx is cancelled.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			slog.Info("SIGHUP received, reloading route table", "file", r.path)
+			r.reloadAndLog()
+		case <-ticker.C:
+			if r.changed() {
+				slog.Info("route table changed, reloading", "file", r.path)
+				r.reloadAndLog()
+			}
+		}
+	}
+}
+
+// changed reports whether the route file was modified since the last load attempt.
+func (r *Reloader) changed() bool {
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if info.ModTime().Equal(r.modTime) {
+		return false
+	}
+	// Remember the new timestamp so an invalid file is not retried every tick
+	r.modTime = info.ModTime()
+	return true
+}
+
+func (r *Reloader) reloadAndLog() {
+	if err := r.Reload(); err != nil {
+		slog.Error("route table rejected, keeping previous table", "file", r.path, "error", err)
+	}
+}
@@ -1,112 +1,189 @@
 package routes
 
 import (
-	"os"
+	"fmt"
+	"net/http"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 
+	"apigateway/internal/config"
+	"apigateway/internal/metrics"
 	"apigateway/internal/middleware"
 	"apigateway/internal/proxy"
+	"apigateway/internal/ratelimit"
+	"apigateway/internal/tracing"
+	"apigateway/internal/upstream"
+	"authclient/jwks"
+	"authclient/revocation"
 )
 
-// SetupRoutes configures all routes and middlewares for the gateway
-func SetupRoutes(router *gin.Engine) {
-	// Get backend service URLs from environment
-	authServiceURL := os.Getenv("AUTH_SERVICE_URL")
-	if authServiceURL == "" {
-		authServiceURL = "http://localhost:8001"
-	}
+// Components are the process-lifetime parts of the gateway shared by every
+// engine built from a route table, so their state survives reloads.
+type Components struct {
+	Proxy       *proxy.Engine
+	Registry    *upstream.Registry
+	RateLimiter *ratelimit.Limiter
+	// Keys holds AuthService's public signing keys that verify access tokens.
+	Keys *jwks.Cache
+	// Revocations is the synced token revocation list; nil disables the check.
+	Revocations *revocation.List
+	// TrustedProxies lists the proxies whose X-Forwarded-For is believed
+	// when resolving the client IP; empty means use the connection address.
+	TrustedProxies []string
+}
 
-	productServiceURL := os.Getenv("PRODUCT_SERVICE_URL")
-	if productServiceURL == "" {
-		productServiceURL = "http://localhost:8002"
+// NewEngine builds a fresh Gin engine serving the given route table through
+// the upstream pools. Route registration errors (e.g. conflicting paths) are
+// returned instead of panicking.
+func NewEngine(table *config.RouteTable, comps *Components, pools map[string]*upstream.Pool) (engine *gin.Engine, err error) {
+	engine = gin.New()
+	engine.Use(gin.Recovery())
+	if err := engine.SetTrustedProxies(comps.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("trusted proxies: %w", err)
 	}
+	defer func() {
+		if r := recover(); r != nil {
+			engine = nil
+			err = fmt.Errorf("register routes: %v", r)
+		}
+	}()
+	SetupRoutes(engine, table, comps, pools)
+	return engine, nil
+}
 
-	orderServiceURL := os.Getenv("ORDER_SERVICE_URL")
-	if orderServiceURL == "" {
-		orderServiceURL = "http://localhost:8003"
-	}
+// SetupRoutes configures all routes and middlewares for the gateway
+func SetupRoutes(router *gin.Engine, table *config.RouteTable, comps *Components, pools map[string]*upstream.Pool) {
+	// Start or continue the trace of every request (W3C traceparent)
+	router.Use(otelgin.Middleware("api-gateway", otelgin.WithFilter(tracing.ShouldTrace)))
+
+	// Assign or propagate the correlation ID before anything else logs
+	router.Use(middleware.RequestIDMiddleware())
+
+	// Never forward identity headers sent by the client
+	router.Use(middleware.StripIdentityHeaders())
 
 	// Configure CORS middleware
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"*"}, // In production, specify allowed origins
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "X-User-ID", "X-User-Role"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "X-Request-ID"},
+		ExposeHeaders:    []string{"Content-Length", "X-Request-ID", "Retry-After", "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset", "X-Next-Cursor"},
 		AllowCredentials: true,
 	}))
 
 	// Add request logging middleware
 	router.Use(middleware.LoggingMiddleware())
 
-	// Check endpoint
+	// Record request counters and latency by route template
+	router.Use(metrics.Middleware())
+
+	// Check endpoint with the health of every upstream instance; degraded
+	// while any upstream has no healthy instance left
 	router.GET("/Check", func(c *gin.Context) {
-		c.JSON(200, gin.H{
-			"status": "ok",
-			"services": gin.H{
-				"auth":    authServiceURL,
-				"product": productServiceURL,
-				"order":   orderServiceURL,
-			},
+		status, code := "ok", http.StatusOK
+		for _, p := range pools {
+			if p.HealthyCount() == 0 {
+				status, code = "degraded", http.StatusServiceUnavailable
+				break
+			}
+		}
+		c.JSON(code, gin.H{
+			"status":   status,
+			"services": poolStatus(pools, false),
 		})
 	})
 
-	// Auth Service routes - Public (no authentication needed for login/register)
-	authGroup := router.Group("/auth")
-	{
-		authGroup.Any("/*path", proxy.StripPrefixProxy("/auth", authServiceURL))
-	}
+	// Liveness: the gateway process is up and serving
+	router.GET("/healthz", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": "ok", "service": "api-gateway"})
+	})
 
-	// Admin routes (for approving users, notifications, etc.) - Requires authentication
-	// Strip the /admin prefix and forward to AuthService root, since backend admin routes are not prefixed
-	adminGroup := router.Group("/admin")
-	adminGroup.Use(middleware.AuthMiddleware(), middleware.AdminOnlyMiddleware())
-	{
-		adminGroup.Any("/*path", proxy.StripPrefixProxy("/admin", authServiceURL))
-	}
+	// Readiness: every upstream has at least one instance whose readiness
+	// endpoint answers right now, with per-instance latencies
+	router.GET("/readyz", func(c *gin.Context) {
+		services := comps.Registry.CheckReadiness(c.Request.Context(), pools)
+		status, code := upstream.StatusReady, http.StatusOK
+		for _, svc := range services {
+			if svc.Status != upstream.StatusReady {
+				status, code = upstream.StatusNotReady, http.StatusServiceUnavailable
+				break
+			}
+		}
+		c.JSON(code, gin.H{"status": status, "services": services})
+	})
 
-	// Notifications - Requires authentication; preserve original path and proxy to AuthService
-	notifGroup := router.Group("/notifications")
-	notifGroup.Use(middleware.AuthMiddleware())
+	// Prometheus metrics of the gateway
+	router.GET("/metrics", metrics.Handler())
+
+	// Gateway admin endpoints - gateway:status permission
+	gatewayAdmin := router.Group("/gateway")
+	gatewayAdmin.Use(middleware.AuthMiddleware(comps.Keys, comps.Revocations), middleware.RequirePermission("gateway:status"))
 	{
-		notifGroup.Any("/*path", proxy.ProxyHandler(authServiceURL))
+		// Upstream instances and circuit breaker state
+		gatewayAdmin.GET("/status", func(c *gin.Context) {
+			c.JSON(200, gin.H{"upstreams": poolStatus(pools, true)})
+		})
 	}
 
-	// Product Service routes
-	productGroup := router.Group("/products")
-	{
-		// Public routes (list and get single product)
-		productGroup.GET("", proxy.ProxyHandler(productServiceURL))
-		productGroup.GET("/:id", proxy.ProxyHandler(productServiceURL))
-
-		// Protected routes - Admin only (create, update, delete)
-		protectedProducts := productGroup.Group("")
-		protectedProducts.Use(middleware.AuthMiddleware(), middleware.AdminOnlyMiddleware())
-		{
-			protectedProducts.POST("", proxy.ProxyHandler(productServiceURL))
-			protectedProducts.PATCH("/:id", proxy.ProxyHandler(productServiceURL))
-			protectedProducts.PATCH("/:id/stock", proxy.ProxyHandler(productServiceURL))
-			protectedProducts.DELETE("/:id", proxy.ProxyHandler(productServiceURL))
-			// Seller's own products - match backend route /allProducts
-			protectedProducts.GET("/allProducts", proxy.StripPrefixProxy("/products", productServiceURL))
+	// Declarative routes loaded from the route table
+	for _, rc := range table.Routes {
+		handlers := append(routeMiddlewares(rc, table, comps), comps.Proxy.Handler(pools[rc.Upstream], rc.StripPrefix))
+
+		if rc.Method == config.MethodAny {
+			router.Any(rc.Path, handlers...)
+		} else {
+			router.Handle(rc.Method, rc.Path, handlers...)
 		}
 	}
+}
 
-	// Order Service routes - All require authentication
-	orderGroup := router.Group("/orders")
-	orderGroup.Use(middleware.AuthMiddleware())
-	{
-		// User can create and view orders
-		orderGroup.POST("", proxy.ProxyHandler(orderServiceURL))
-		orderGroup.GET("", proxy.ProxyHandler(orderServiceURL))
-		orderGroup.GET("/:id", proxy.ProxyHandler(orderServiceURL))
-
-		// Admin only - update order status
-		adminOrders := orderGroup.Group("")
-		adminOrders.Use(middleware.AdminOnlyMiddleware())
-		{
-			adminOrders.PATCH("/:id/status", proxy.ProxyHandler(orderServiceURL))
+// routeMiddlewares returns the authentication and rate limiting chain of a route.
+// Rate limiting runs after authentication so requests are keyed by user.
+func routeMiddlewares(rc config.RouteConfig, table *config.RouteTable, comps *Components) []gin.HandlerFunc {
+	var chain []gin.HandlerFunc
+	if rc.Auth {
+		chain = append(chain, middleware.AuthMiddleware(comps.Keys, comps.Revocations))
+	}
+	if rc.RateLimit != "" {
+		chain = append(chain, middleware.RateLimitMiddleware(comps.RateLimiter, rc.RateLimit, table.RateLimits[rc.RateLimit]))
+	}
+	if len(rc.Permissions) > 0 {
+		chain = append(chain, middleware.RequirePermission(rc.Permissions...))
+	}
+	if len(rc.Roles) > 0 {
+		chain = append(chain, middleware.RequireRoles(rc.Roles...))
+	}
+	return chain
+}
+
+// poolStatus summarises the instances of every upstream pool and, when
+// withBreakers is set, the counters of their circuit breakers.
+func poolStatus(pools map[string]*upstream.Pool, withBreakers bool) gin.H {
+	services := gin.H{}
+	for name, p := range pools {
+		instances := make([]gin.H, 0, len(p.Instances()))
+		for _, inst := range p.Instances() {
+			instances = append(instances, gin.H{
+				"url":     inst.URL.String(),
+				"weight":  inst.Weight,
+				"healthy": inst.Healthy(),
+				"active":  inst.ActiveRequests(),
+			})
+		}
+		status := gin.H{
+			"balancer":  p.Balancer(),
+			"instances": instances,
+		}
+		if cb := p.Breaker(); cb == nil {
+			status["circuit_breaker"] = "disabled"
+		} else if withBreakers {
+			status["circuit_breaker"] = cb.Snapshot()
+		} else {
+			status["circuit_breaker"] = cb.State().String()
 		}
+		services[name] = status
 	}
+	return services
 }
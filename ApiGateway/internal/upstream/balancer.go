@@ -0,0 +1,84 @@
+package upstream
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"apigateway/internal/config"
+)
+
+// Balancer chooses one instance out of the currently healthy ones.
+type Balancer interface {
+	Pick(healthy []*Instance) *Instance
+}
+
+// NewBalancer returns the balancer registered under name.
+func NewBalancer(name string) (Balancer, error) {
+	switch name {
+	case "", config.BalancerRoundRobin:
+		return &roundRobin{}, nil
+	case config.BalancerLeastConnections:
+		return &leastConnections{}, nil
+	case config.BalancerWeighted:
+		return &weighted{current: map[*Instance]int{}}, nil
+	default:
+		return nil, fmt.Errorf("unknown balancer %q", name)
+	}
+}
+
+// roundRobin cycles through healthy instances in order.
+type roundRobin struct {
+	next atomic.Uint64
+}
+
+func (b *roundRobin) Pick(healthy []*Instance) *Instance {
+	n := b.next.Add(1) - 1
+	return healthy[n%uint64(len(healthy))]
+}
+
+// leastConnections picks the instance with the fewest requests in flight,
+// rotating between instances that are tied.
+type leastConnections struct {
+	next atomic.Uint64
+}
+
+func (b *leastConnections) Pick(healthy []*Instance) *Instance {
+	offset := int(b.next.Add(1) % uint64(len(healthy)))
+	var best *Instance
+	for i := range healthy {
+		inst := healthy[(offset+i)%len(healthy)]
+		if best == nil || inst.ActiveRequests() < best.ActiveRequests() {
+			best = inst
+		}
+	}
+	return best
+}
+
+// weighted implements smooth weighted round-robin: over a cycle each
+// instance is picked in proportion to its weight without bursts.
+type weighted struct {
+	mu      sync.Mutex
+	current map[*Instance]int
+}
+
+func (b *weighted) Pick(healthy []*Instance) *Instance {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	total := 0
+	var best *Instance
+	for _, inst := range healthy {
+		b.current[inst] += inst.Weight
+		total += inst.Weight
+		if best == nil || b.current[inst] > b.current[best] {
+			best = inst
+		}
+	}
+	if total == 0 {
+		// Every instance has weight 0; fall back to the first one
+		return healthy[0]
+	}
+	b.current[best] -= total
+	return best
+}
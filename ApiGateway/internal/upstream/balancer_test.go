@@ -0,0 +1,115 @@
+package upstream
+
+import (
+	"net/url"
+	"testing"
+
+	"apigateway/internal/config"
+)
+
+func newInstances(weights ...int) []*Instance {
+	instances := make([]*Instance, len(weights))
+	for i, w := range weights {
+		instances[i] = &Instance{URL: &url.URL{Scheme: "http", Host: string(rune('a' + i))}, Weight: w}
+		instances[i].healthy.Store(true)
+	}
+	return instances
+}
+
+func pickCounts(b Balancer, instances []*Instance, n int) map[*Instance]int {
+	counts := map[*Instance]int{}
+	for i := 0; i < n; i++ {
+		counts[b.Pick(instances)]++
+	}
+	return counts
+}
+
+func TestBalancerDistribution(t *testing.T) {
+	tests := []struct {
+		balancer string
+		weights  []int
+		picks    int
+		want     []int
+	}{
+		{config.BalancerRoundRobin, []int{1, 1, 1}, 9, []int{3, 3, 3}},
+		{config.BalancerRoundRobin, []int{5, 1}, 4, []int{2, 2}},
+		{config.BalancerLeastConnections, []int{1, 1, 1}, 6, []int{2, 2, 2}},
+		{config.BalancerWeighted, []int{5, 1, 1}, 7, []int{5, 1, 1}},
+		{config.BalancerWeighted, []int{3, 1}, 8, []int{6, 2}},
+		{config.BalancerWeighted, []int{0, 0}, 4, []int{4, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.balancer, func(t *testing.T) {
+			b, err := NewBalancer(tt.balancer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			instances := newInstances(tt.weights...)
+			counts := pickCounts(b, instances, tt.picks)
+			for i, inst := range instances {
+				if counts[inst] != tt.want[i] {
+					t.Errorf("weights %v: instance %d picked %d times, want %d", tt.weights, i, counts[inst], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestWeightedIsSmooth(t *testing.T) {
+	b, _ := NewBalancer(config.BalancerWeighted)
+	instances := newInstances(5, 1, 1)
+	// Smooth weighted round-robin spreads the heavy instance out
+	want := []int{0, 0, 1, 0, 2, 0, 0}
+	for i, w := range want {
+		if got := b.Pick(instances); got != instances[w] {
+			t.Fatalf("pick %d = %s, want %s", i, got.URL.Host, instances[w].URL.Host)
+		}
+	}
+}
+
+func TestLeastConnectionsPrefersIdle(t *testing.T) {
+	b, _ := NewBalancer(config.BalancerLeastConnections)
+	instances := newInstances(1, 1, 1)
+	instances[0].Acquire()
+	instances[2].Acquire()
+	instances[2].Acquire()
+	for i := 0; i < 3; i++ {
+		if got := b.Pick(instances); got != instances[1] {
+			t.Fatalf("pick %d = %s, want b", i, got.URL.Host)
+		}
+	}
+	instances[2].Release()
+	instances[2].Release()
+	instances[1].Acquire()
+	if got := b.Pick(instances); got != instances[2] {
+		t.Fatalf("pick after release = %s, want c", got.URL.Host)
+	}
+}
+
+func TestNewBalancerUnknown(t *testing.T) {
+	if _, err := NewBalancer("random"); err == nil {
+		t.Fatal("NewBalancer(random) succeeded")
+	}
+}
+
+func TestPoolNextSkipsUnhealthy(t *testing.T) {
+	p, err := NewPool("users", config.UpstreamConfig{
+		Instances:      []config.InstanceConfig{{URL: "http://a", Weight: 1}, {URL: "http://b", Weight: 1}},
+		Balancer:       config.BalancerRoundRobin,
+		CircuitBreaker: config.CircuitBreakerConfig{Disabled: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	instances := p.Instances()
+	instances[0].healthy.Store(false)
+	for i := 0; i < 3; i++ {
+		if got := p.Next(); got != instances[1] {
+			t.Fatalf("Next() = %v, want the healthy instance", got)
+		}
+	}
+	instances[1].healthy.Store(false)
+	if got := p.Next(); got != nil {
+		t.Fatalf("Next() with no healthy instance = %v, want nil", got)
+	}
+}
@@ -0,0 +1,75 @@
+package upstream
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// runHealthChecks probes every instance on the configured interval until the
+// pool is closed, ejecting instances after consecutive failures and
+// re-admitting them after consecutive successes. Each instance is probed by
+// its own goroutine so one that hangs until the timeout does not delay the
+// checks of the others.
+func (p *Pool) runHealthChecks(client *http.Client) {
+	for _, inst := range p.instances {
+		go p.checkInstance(client, inst)
+	}
+}
+
+// checkInstance runs the health checks of a single instance until the pool is closed.
+func (p *Pool) checkInstance(client *http.Client, inst *Instance) {
+	hc := p.spec.HealthCheck
+	var failures, successes int
+
+	ticker := time.NewTicker(hc.Interval.Std())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+
+		if p.probe(client, inst) {
+			failures = 0
+			successes++
+			if !inst.Healthy() && successes >= hc.HealthyThreshold {
+				inst.healthy.Store(true)
+				slog.Info("upstream instance re-admitted", "upstream", p.Name, "instance", inst.URL.String())
+			}
+		} else {
+			successes = 0
+			failures++
+			if inst.Healthy() && failures >= hc.UnhealthyThreshold {
+				inst.healthy.Store(false)
+				slog.Warn("upstream instance ejected", "upstream", p.Name, "instance", inst.URL.String(), "failed_checks", failures)
+			}
+		}
+	}
+}
+
+// probe issues a single health check request; any 2xx response counts as healthy.
+func (p *Pool) probe(client *http.Client, inst *Instance) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), p.spec.HealthCheck.Timeout.Std())
+	defer cancel()
+
+	status, err := p.check(ctx, client, inst)
+	return err == nil && status >= 200 && status < 300
+}
+
+// check requests the health check path of an instance and returns the response status.
+func (p *Pool) check(ctx context.Context, client *http.Client, inst *Instance) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, inst.URL.JoinPath(p.spec.HealthCheck.Path).String(), nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
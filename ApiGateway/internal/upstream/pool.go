@@ -0,0 +1,126 @@
+package upstream
+
+import (
+	"fmt"
+	"log/slog"
+	"net/url"
+	"sync"
+	"sync/atomic"
+
+	"apigateway/internal/breaker"
+	"apigateway/internal/config"
+	"apigateway/internal/metrics"
+)
+
+// Instance is a single replica of an upstream service.
+type Instance struct {
+	URL    *url.URL
+	Weight int
+
+	healthy atomic.Bool
+	active  atomic.Int64
+}
+
+// Healthy reports whether the instance currently receives traffic.
+func (i *Instance) Healthy() bool { return i.healthy.Load() }
+
+// ActiveRequests returns the number of requests currently in flight to the instance.
+func (i *Instance) ActiveRequests() int64 { return i.active.Load() }
+
+// Acquire marks the start of a request to the instance.
+func (i *Instance) Acquire() { i.active.Add(1) }
+
+// Release marks the end of a request started with Acquire.
+func (i *Instance) Release() { i.active.Add(-1) }
+
+// Pool is the set of instances behind one upstream name.
+type Pool struct {
+	Name string
+
+	spec      config.UpstreamConfig
+	instances []*Instance
+	balancer  Balancer
+	breaker   *breaker.Breaker
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewPool creates a pool from an upstream configuration. All instances start
+// healthy; health checks only run once the pool is started by a Registry.
+func NewPool(name string, spec config.UpstreamConfig) (*Pool, error) {
+	balancer, err := NewBalancer(spec.Balancer)
+	if err != nil {
+		return nil, fmt.Errorf("upstream %q: %w", name, err)
+	}
+
+	p := &Pool{
+		Name:     name,
+		spec:     spec,
+		balancer: balancer,
+		stop:     make(chan struct{}),
+	}
+	if cb := spec.CircuitBreaker; !cb.Disabled {
+		p.breaker = breaker.New(breaker.Settings{
+			FailureRate:      cb.FailureRate,
+			MinRequests:      cb.MinRequests,
+			Window:           cb.Window.Std(),
+			CoolDown:         cb.CoolDown.Std(),
+			HalfOpenRequests: cb.HalfOpenRequests,
+			OnStateChange: func(from, to breaker.State) {
+				slog.Warn("circuit breaker state changed", "upstream", name, "from", from.String(), "to", to.String())
+				metrics.SetBreakerState(name, int(to))
+			},
+		})
+	}
+	for _, ic := range spec.ResolvedInstances() {
+		u, err := url.Parse(ic.URL)
+		if err != nil {
+			return nil, fmt.Errorf("upstream %q: parse %q: %w", name, ic.URL, err)
+		}
+		inst := &Instance{URL: u, Weight: ic.Weight}
+		inst.healthy.Store(true)
+		p.instances = append(p.instances, inst)
+	}
+	return p, nil
+}
+
+// Next picks the instance for the next request, or nil if none is healthy.
+func (p *Pool) Next() *Instance {
+	healthy := make([]*Instance, 0, len(p.instances))
+	for _, inst := range p.instances {
+		if inst.Healthy() {
+			healthy = append(healthy, inst)
+		}
+	}
+	if len(healthy) == 0 {
+		return nil
+	}
+	return p.balancer.Pick(healthy)
+}
+
+// HealthyCount returns the number of instances currently receiving traffic.
+// Unlike Next it leaves the balancer untouched.
+func (p *Pool) HealthyCount() int {
+	n := 0
+	for _, inst := range p.instances {
+		if inst.Healthy() {
+			n++
+		}
+	}
+	return n
+}
+
+// Instances returns every instance of the pool, healthy or not.
+func (p *Pool) Instances() []*Instance { return p.instances }
+
+// Breaker returns the pool's circuit breaker, or nil when it is disabled.
+func (p *Pool) Breaker() *breaker.Breaker { return p.breaker }
+
+// Balancer returns the name of the pool's balancing strategy.
+func (p *Pool) Balancer() string { return p.spec.Balancer }
+
+// Close stops the pool's background health checks.
+func (p *Pool) Close() {
+	p.stopOnce.Do(func() { close(p.stop) })
+}
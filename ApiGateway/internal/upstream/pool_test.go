@@ -0,0 +1,41 @@
+package upstream
+
+import (
+	"testing"
+
+	"apigateway/internal/config"
+)
+
+func TestHealthyCountLeavesBalancer(t *testing.T) {
+	p, err := NewPool("svc", config.UpstreamConfig{
+		Balancer: config.BalancerRoundRobin,
+		Instances: []config.InstanceConfig{
+			{URL: "http://a", Weight: 1}, {URL: "http://b", Weight: 1}, {URL: "http://c", Weight: 1},
+		},
+		CircuitBreaker: config.CircuitBreakerConfig{Disabled: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := p.Next()
+	for i := 0; i < 5; i++ {
+		if got := p.HealthyCount(); got != 3 {
+			t.Fatalf("HealthyCount() = %d, want 3", got)
+		}
+	}
+	// Round robin continues where Next left off
+	if got := p.Next(); got == first || got != p.Instances()[1] {
+		t.Fatalf("Next() = %s after HealthyCount, want %s", got.URL, p.Instances()[1].URL)
+	}
+
+	p.Instances()[0].healthy.Store(false)
+	p.Instances()[2].healthy.Store(false)
+	if got := p.HealthyCount(); got != 1 {
+		t.Fatalf("HealthyCount() = %d, want 1", got)
+	}
+	p.Instances()[1].healthy.Store(false)
+	if got := p.HealthyCount(); got != 0 {
+		t.Fatalf("HealthyCount() = %d, want 0", got)
+	}
+}
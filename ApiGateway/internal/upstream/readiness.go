@@ -0,0 +1,90 @@
+package upstream
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Readiness states reported by CheckReadiness.
+const (
+	StatusReady    = "ready"
+	StatusNotReady = "not_ready"
+)
+
+// InstanceReadiness is the outcome of probing one instance's readiness endpoint.
+type InstanceReadiness struct {
+	URL        string  `json:"url"`
+	Status     string  `json:"status"`
+	HTTPStatus int     `json:"http_status,omitempty"`
+	LatencyMS  float64 `json:"latency_ms"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// ServiceReadiness aggregates the readiness of an upstream's instances. A
+// service is ready while at least one of its instances is.
+type ServiceReadiness struct {
+	Status    string              `json:"status"`
+	Instances []InstanceReadiness `json:"instances"`
+}
+
+// CheckReadiness probes the health check path of every instance of every pool
+// concurrently, bounded by each pool's health check timeout, and reports the
+// result per upstream. Unlike the background health checks it reflects the
+// state of the backends right now.
+func (r *Registry) CheckReadiness(ctx context.Context, pools map[string]*Pool) map[string]ServiceReadiness {
+	var (
+		wg      sync.WaitGroup
+		results = make(map[string][]InstanceReadiness, len(pools))
+	)
+	for name, p := range pools {
+		results[name] = make([]InstanceReadiness, len(p.instances))
+		for i, inst := range p.instances {
+			wg.Add(1)
+			go func(p *Pool, inst *Instance, out *InstanceReadiness) {
+				defer wg.Done()
+				*out = p.checkReadiness(ctx, r.client, inst)
+			}(p, inst, &results[name][i])
+		}
+	}
+	wg.Wait()
+
+	report := make(map[string]ServiceReadiness, len(results))
+	for name, instances := range results {
+		status := StatusNotReady
+		for _, inst := range instances {
+			if inst.Status == StatusReady {
+				status = StatusReady
+				break
+			}
+		}
+		report[name] = ServiceReadiness{Status: status, Instances: instances}
+	}
+	return report
+}
+
+// checkReadiness probes a single instance and times the response.
+func (p *Pool) checkReadiness(ctx context.Context, client *http.Client, inst *Instance) InstanceReadiness {
+	ctx, cancel := context.WithTimeout(ctx, p.spec.HealthCheck.Timeout.Std())
+	defer cancel()
+
+	start := time.Now()
+	code, err := p.check(ctx, client, inst)
+	res := InstanceReadiness{
+		URL:        inst.URL.String(),
+		Status:     StatusNotReady,
+		HTTPStatus: code,
+		LatencyMS:  float64(time.Since(start).Microseconds()) / 1000,
+	}
+	switch {
+	case err != nil:
+		res.Error = err.Error()
+	case code < 200 || code >= 300:
+		res.Error = fmt.Sprintf("unexpected status %d", code)
+	default:
+		res.Status = StatusReady
+	}
+	return res
+}
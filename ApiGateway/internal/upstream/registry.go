@@ -0,0 +1,96 @@
+package upstream
+
+import (
+	"net/http"
+	"reflect"
+	"sync"
+
+	"apigateway/internal/config"
+	"apigateway/internal/metrics"
+)
+
+// Registry owns the upstream pools across route table reloads. Pools whose
+// configuration did not change are reused so their health state survives.
+type Registry struct {
+	client *http.Client
+
+	mu    sync.Mutex
+	pools map[string]*Pool
+}
+
+// NewRegistry creates a registry whose health checks use transport.
+func NewRegistry(transport http.RoundTripper) *Registry {
+	return &Registry{
+		client: &http.Client{Transport: transport},
+		pools:  map[string]*Pool{},
+	}
+}
+
+// Resolve returns pools for the given upstreams without changing the registry:
+// existing pools are reused when their configuration is identical and new,
+// not yet started pools are created otherwise. Pass the result to Commit once
+// it is in use, or drop it to discard.
+func (r *Registry) Resolve(upstreams map[string]config.UpstreamConfig) (map[string]*Pool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	pools := make(map[string]*Pool, len(upstreams))
+	for name, spec := range upstreams {
+		if existing, ok := r.pools[name]; ok && sameSpec(existing.spec, spec) {
+			pools[name] = existing
+			continue
+		}
+		p, err := NewPool(name, spec)
+		if err != nil {
+			return nil, err
+		}
+		pools[name] = p
+	}
+	return pools, nil
+}
+
+// Commit makes pools the active set, starting health checks for new pools
+// and stopping those that are no longer used.
+func (r *Registry) Commit(pools map[string]*Pool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for name, old := range r.pools {
+		if pools[name] != old {
+			old.Close()
+			metrics.DeleteBreakerState(name)
+		}
+	}
+	for name, p := range pools {
+		if r.pools[name] == p {
+			continue
+		}
+		if p.breaker != nil {
+			metrics.SetBreakerState(name, int(p.breaker.State()))
+		}
+		if !p.spec.HealthCheck.Disabled {
+			go p.runHealthChecks(r.client)
+		}
+	}
+	r.pools = pools
+}
+
+// Pools returns the active pools keyed by upstream name.
+func (r *Registry) Pools() map[string]*Pool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	out := make(map[string]*Pool, len(r.pools))
+	for name, p := range r.pools {
+		out[name] = p
+	}
+	return out
+}
+
+// sameSpec reports whether two configurations produce identical pools.
+func sameSpec(a, b config.UpstreamConfig) bool {
+	return a.Balancer == b.Balancer &&
+		reflect.DeepEqual(a.HealthCheck, b.HealthCheck) &&
+		reflect.DeepEqual(a.CircuitBreaker, b.CircuitBreaker) &&
+		reflect.DeepEqual(a.ResolvedInstances(), b.ResolvedInstances())
+}
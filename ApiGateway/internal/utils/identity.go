@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// IdentityHeader carries the gateway-signed identity assertion to backend services
+const IdentityHeader = "X-Gateway-Identity"
+
+// Issuer and audience of identity assertions
+const (
+	IdentityIssuer   = "api-gateway"
+	IdentityAudience = "internal"
+)
+
+// SignIdentity creates a short-lived HMAC-signed assertion of the caller's identity
+// taken from the validated access token claims, including the token's ID, issue
+// time and expiry.
+// Its lifetime is GATEWAY_IDENTITY_TTL (default 30s).
+func SignIdentity(identity *Claims) (string, error) {
+	secret := os.Getenv("GATEWAY_IDENTITY_SECRET")
+	if secret == "" {
+		return "", fmt.Errorf("GATEWAY_IDENTITY_SECRET not configured")
+	}
+
+	ttl := 30 * time.Second
+	if v := os.Getenv("GATEWAY_IDENTITY_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return "", fmt.Errorf("invalid GATEWAY_IDENTITY_TTL: %w", err)
+		}
+		ttl = d
+	}
+
+	now := time.Now()
+	claims := &Claims{
+		UserID:        identity.UserID,
+		Role:          identity.Role,
+		Permissions:   identity.Permissions,
+		EmailVerified: identity.EmailVerified,
+		// AuthService needs the token itself for logout and its notification streams
+		TokenID:         identity.ID,
+		TokenIssuedAt:   identity.IssuedAt,
+		TokenIssuedAtMs: identity.IssuedAtMs,
+		TokenExpiresAt:  identity.ExpiresAt,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    IdentityIssuer,
+			Audience:  jwt.ClaimStrings{IdentityAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+}
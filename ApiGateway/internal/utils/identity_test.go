@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testSecret = "identity-test-secret"
+
+func parseIdentity(t *testing.T, token, secret string) (*Claims, error) {
+	t.Helper()
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+		return []byte(secret), nil
+	}, jwt.WithValidMethods([]string{"HS256"}), jwt.WithIssuer(IdentityIssuer), jwt.WithAudience(IdentityAudience))
+	return claims, err
+}
+
+func TestSignIdentityCarriesAccessTokenClaims(t *testing.T) {
+	t.Setenv("GATEWAY_IDENTITY_SECRET", testSecret)
+	t.Setenv("GATEWAY_IDENTITY_TTL", "")
+
+	issued := time.Now().Add(-time.Minute).Truncate(time.Second)
+	access := &Claims{
+		UserID:        42,
+		Role:          "seller",
+		Permissions:   []string{"product:write", "order:read"},
+		EmailVerified: true,
+		IssuedAtMs:    issued.UnixMilli() + 250,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        "access-jti",
+			Issuer:    "auth-service",
+			IssuedAt:  jwt.NewNumericDate(issued),
+			ExpiresAt: jwt.NewNumericDate(issued.Add(15 * time.Minute)),
+		},
+	}
+	token, err := SignIdentity(access)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := parseIdentity(t, token, testSecret)
+	if err != nil {
+		t.Fatalf("parse assertion: %v", err)
+	}
+
+	if got.UserID != 42 || got.Role != "seller" || !got.EmailVerified || len(got.Permissions) != 2 {
+		t.Errorf("identity = %+v, want the access token's user, role, permissions and email_verified", got)
+	}
+	if got.TokenID != "access-jti" {
+		t.Errorf("token_jti = %q, want access-jti", got.TokenID)
+	}
+	if !got.TokenIssuedAt.Equal(issued) || !got.TokenExpiresAt.Equal(issued.Add(15*time.Minute)) {
+		t.Errorf("token_iat/token_exp = %v/%v, want the access token's", got.TokenIssuedAt, got.TokenExpiresAt)
+	}
+	if got.TokenIssuedAtMs != issued.UnixMilli()+250 {
+		t.Errorf("token_iat_ms = %d, want the access token's iat_ms", got.TokenIssuedAtMs)
+	}
+	if ttl := got.ExpiresAt.Sub(got.IssuedAt.Time); ttl != 30*time.Second {
+		t.Errorf("assertion lifetime = %v, want the 30s default", ttl)
+	}
+}
+
+func TestSignIdentityConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		secret  string
+		ttl     string
+		wantErr bool
+		wantTTL time.Duration
+	}{
+		{"default ttl", testSecret, "", false, 30 * time.Second},
+		{"custom ttl", testSecret, "5s", false, 5 * time.Second},
+		{"invalid ttl", testSecret, "soon", true, 0},
+		{"no secret", "", "", true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("GATEWAY_IDENTITY_SECRET", tt.secret)
+			t.Setenv("GATEWAY_IDENTITY_TTL", tt.ttl)
+			token, err := SignIdentity(&Claims{UserID: 1})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("SignIdentity succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := parseIdentity(t, token, tt.secret)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ttl := got.ExpiresAt.Sub(got.IssuedAt.Time); ttl != tt.wantTTL {
+				t.Errorf("assertion lifetime = %v, want %v", ttl, tt.wantTTL)
+			}
+		})
+	}
+}
+
+func TestSignIdentityRejectsOtherSecret(t *testing.T) {
+	t.Setenv("GATEWAY_IDENTITY_SECRET", testSecret)
+	token, err := SignIdentity(&Claims{UserID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parseIdentity(t, token, "another-secret"); err == nil {
+		t.Fatal("assertion verified with another secret")
+	}
+}
@@ -2,33 +2,32 @@ package utils
 
 import (
 	"fmt"
-	"os"
 
 	"github.com/golang-jwt/jwt/v5"
+
+	"authclient/jwks"
 )
 
 // Claims represents the JWT claims structure
 type Claims struct {
-	UserID uint   `json:"user_id"`
-	Role   string `json:"role"`
+	UserID        uint     `json:"user_id"`
+	Role          string   `json:"role"`
+	Permissions   []string `json:"permissions"`
+	EmailVerified bool     `json:"email_verified"`
+	// IssuedAtMs is iat in milliseconds, used to order the token against revocations
+	IssuedAtMs int64 `json:"iat_ms,omitempty"`
+	// Identity assertions also name the access token they were taken from
+	TokenID         string           `json:"token_jti,omitempty"`
+	TokenIssuedAt   *jwt.NumericDate `json:"token_iat,omitempty"`
+	TokenIssuedAtMs int64            `json:"token_iat_ms,omitempty"`
+	TokenExpiresAt  *jwt.NumericDate `json:"token_exp,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// ValidateToken validates a JWT token string and returns the claims
-func ValidateToken(tokenString string) (*Claims, error) {
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		return nil, fmt.Errorf("JWT_SECRET not configured")
-	}
-
-	// Parse and validate the token
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		// Verify signing method
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(jwtSecret), nil
-	})
+// ValidateToken validates a JWT token string against AuthService's published keys and returns the claims
+func ValidateToken(tokenString string, keys *jwks.Cache) (*Claims, error) {
+	// Parse and validate the token; only asymmetric algorithms are accepted
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, keys.Keyfunc, jwt.WithValidMethods(jwks.Methods))
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse token: %w", err)
@@ -3,6 +3,8 @@ package config
 import (
 	"errors"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -10,12 +12,86 @@ import (
 
 // Config holds application configuration loaded from environment variables.
 type Config struct {
-	JWTSecret          string
+	// JWTSigningAlg is the algorithm of new signing keys: RS256 or EdDSA.
+	JWTSigningAlg string
+	// JWTKeyRotation is the age at which the signing key is replaced; 0 disables rotation.
+	JWTKeyRotation time.Duration
+	// JWTKeyOverlap is how long a retired key stays published; at least JWTExpiry.
+	JWTKeyOverlap      time.Duration
 	JWTExpiry          time.Duration
+	RefreshTokenExpiry time.Duration
 	DBPath             string
 	SuperAdminName     string
 	SuperAdminEmail    string
 	SuperAdminPassword string
+	// InternalAPIToken authenticates other services on the /internal endpoints.
+	// When empty, those endpoints are disabled.
+	InternalAPIToken string
+	// PasswordResetExpiry is the lifetime of password reset tokens.
+	PasswordResetExpiry time.Duration
+	// PasswordResetURL is the page that accepts reset tokens; the token is
+	// appended as the "token" query parameter. When empty, mails carry the bare token.
+	PasswordResetURL string
+	// EmailVerificationSecret signs email verification links.
+	EmailVerificationSecret string
+	// EmailVerificationExpiry is the lifetime of verification links.
+	EmailVerificationExpiry time.Duration
+	// EmailVerificationURL receives the "token" query parameter; when empty, mails carry the bare token.
+	EmailVerificationURL string
+	// EmailVerificationResendInterval is the minimum time between verification emails to one user.
+	EmailVerificationResendInterval time.Duration
+	// TOTPIssuer names the account in authenticator apps.
+	TOTPIssuer string
+	// LoginChallengeExpiry is how long a login waits for the TOTP code.
+	LoginChallengeExpiry time.Duration
+	// LoginBackoffThreshold is the number of consecutive failed logins for one
+	// email address before each further attempt has to wait; LoginIPBackoffThreshold
+	// is the same for one client IP.
+	LoginBackoffThreshold   int
+	LoginIPBackoffThreshold int
+	// LoginBackoffBase is the first wait; it doubles with every further failure
+	// up to LoginBackoffMax.
+	LoginBackoffBase time.Duration
+	LoginBackoffMax  time.Duration
+	// LoginFailureWindow is how long failed logins are remembered.
+	LoginFailureWindow time.Duration
+	// LoginLockoutThreshold is the number of consecutive failed logins that locks
+	// an account for LoginLockoutDuration; 0 disables lockout.
+	LoginLockoutThreshold int
+	LoginLockoutDuration  time.Duration
+	// TrustedProxies lists the proxies (the gateway) whose X-Forwarded-For is
+	// believed when determining the client IP.
+	TrustedProxies []string
+	// NotificationRetention is how long read notifications are kept; 0 keeps them forever.
+	NotificationRetention time.Duration
+	// NotificationStreamHeartbeat is how often idle notification streams get a
+	// comment line, keeping proxies from closing them; it is also how often the
+	// stream's token is checked for revocation.
+	NotificationStreamHeartbeat time.Duration
+	// NotificationStreamPoll is how often streams look for notifications they
+	// were not woken for, e.g. ones created by another instance.
+	NotificationStreamPoll time.Duration
+	// NotificationMaxAttempts is how often an email or webhook delivery is
+	// tried before it is marked failed; retries wait NotificationRetryBase,
+	// doubling each time.
+	NotificationMaxAttempts int
+	NotificationRetryBase   time.Duration
+	// WebhookDriver is http, or file to append deliveries to WebhookFile.
+	WebhookDriver string
+	WebhookFile   string
+	// WebhookAllowPrivate permits webhook URLs on loopback and private addresses.
+	WebhookAllowPrivate bool
+	// Mail settings; MailDriver is log, file or smtp.
+	MailDriver   string
+	MailFrom     string
+	MailFile     string
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+	// GatewayIdentitySecret verifies identity assertions signed by the API gateway.
+	// When empty, only JWTs are accepted.
+	GatewayIdentitySecret string
 }
 
 var cfg Config
@@ -26,23 +102,144 @@ func Load() error {
 	// Load .env if found; ignore error if file doesn't exist
 	_ = godotenv.Load()
 
-	expiryStr := getenvDefault("JWT_EXPIRY", "24h")
+	expiryStr := getenvDefault("JWT_EXPIRY", "15m")
 	dur, err := time.ParseDuration(expiryStr)
 	if err != nil {
 		return errors.New("invalid JWT_EXPIRY; use Go duration format like 24h, 30m")
 	}
+	refreshExpiry, err := time.ParseDuration(getenvDefault("REFRESH_TOKEN_EXPIRY", "720h"))
+	if err != nil || refreshExpiry <= 0 {
+		return errors.New("invalid REFRESH_TOKEN_EXPIRY; use Go duration format like 720h")
+	}
+	resetExpiry, err := time.ParseDuration(getenvDefault("PASSWORD_RESET_EXPIRY", "1h"))
+	if err != nil || resetExpiry <= 0 {
+		return errors.New("invalid PASSWORD_RESET_EXPIRY; use Go duration format like 1h")
+	}
+	verifyExpiry, err := time.ParseDuration(getenvDefault("EMAIL_VERIFICATION_EXPIRY", "24h"))
+	if err != nil || verifyExpiry <= 0 {
+		return errors.New("invalid EMAIL_VERIFICATION_EXPIRY; use Go duration format like 24h")
+	}
+	resendInterval, err := time.ParseDuration(getenvDefault("EMAIL_VERIFICATION_RESEND_INTERVAL", "1m"))
+	if err != nil || resendInterval < 0 {
+		return errors.New("invalid EMAIL_VERIFICATION_RESEND_INTERVAL; use Go duration format like 1m")
+	}
+	challengeExpiry, err := time.ParseDuration(getenvDefault("LOGIN_CHALLENGE_EXPIRY", "5m"))
+	if err != nil || challengeExpiry <= 0 {
+		return errors.New("invalid LOGIN_CHALLENGE_EXPIRY; use Go duration format like 5m")
+	}
+	backoffThreshold, err := strconv.Atoi(getenvDefault("LOGIN_BACKOFF_THRESHOLD", "3"))
+	if err != nil || backoffThreshold < 1 {
+		return errors.New("invalid LOGIN_BACKOFF_THRESHOLD; use a positive number")
+	}
+	ipBackoffThreshold, err := strconv.Atoi(getenvDefault("LOGIN_IP_BACKOFF_THRESHOLD", "20"))
+	if err != nil || ipBackoffThreshold < 1 {
+		return errors.New("invalid LOGIN_IP_BACKOFF_THRESHOLD; use a positive number")
+	}
+	backoffBase, err := time.ParseDuration(getenvDefault("LOGIN_BACKOFF_BASE", "1s"))
+	if err != nil || backoffBase <= 0 {
+		return errors.New("invalid LOGIN_BACKOFF_BASE; use Go duration format like 1s")
+	}
+	backoffMax, err := time.ParseDuration(getenvDefault("LOGIN_BACKOFF_MAX", "15m"))
+	if err != nil || backoffMax < backoffBase {
+		return errors.New("invalid LOGIN_BACKOFF_MAX; it must be a Go duration of at least LOGIN_BACKOFF_BASE")
+	}
+	failureWindow, err := time.ParseDuration(getenvDefault("LOGIN_FAILURE_WINDOW", "1h"))
+	if err != nil || failureWindow <= 0 {
+		return errors.New("invalid LOGIN_FAILURE_WINDOW; use Go duration format like 1h")
+	}
+	lockoutThreshold, err := strconv.Atoi(getenvDefault("LOGIN_LOCKOUT_THRESHOLD", "10"))
+	if err != nil || lockoutThreshold < 0 {
+		return errors.New("invalid LOGIN_LOCKOUT_THRESHOLD; use a number, or 0 to disable lockout")
+	}
+	lockoutDuration, err := time.ParseDuration(getenvDefault("LOGIN_LOCKOUT_DURATION", "30m"))
+	if err != nil || lockoutDuration <= 0 {
+		return errors.New("invalid LOGIN_LOCKOUT_DURATION; use Go duration format like 30m")
+	}
+	notificationRetention, err := time.ParseDuration(getenvDefault("NOTIFICATION_RETENTION", "720h"))
+	if err != nil || notificationRetention < 0 {
+		return errors.New("invalid NOTIFICATION_RETENTION; use Go duration format like 720h, or 0 to keep read notifications")
+	}
+	streamHeartbeat, err := time.ParseDuration(getenvDefault("NOTIFICATION_STREAM_HEARTBEAT", "15s"))
+	if err != nil || streamHeartbeat <= 0 {
+		return errors.New("invalid NOTIFICATION_STREAM_HEARTBEAT; use Go duration format like 15s")
+	}
+	streamPoll, err := time.ParseDuration(getenvDefault("NOTIFICATION_STREAM_POLL", "5s"))
+	if err != nil || streamPoll <= 0 {
+		return errors.New("invalid NOTIFICATION_STREAM_POLL; use Go duration format like 5s")
+	}
+	maxAttempts, err := strconv.Atoi(getenvDefault("NOTIFICATION_MAX_ATTEMPTS", "5"))
+	if err != nil || maxAttempts < 1 {
+		return errors.New("invalid NOTIFICATION_MAX_ATTEMPTS; use a number of at least 1")
+	}
+	retryBase, err := time.ParseDuration(getenvDefault("NOTIFICATION_RETRY_BASE", "30s"))
+	if err != nil || retryBase <= 0 {
+		return errors.New("invalid NOTIFICATION_RETRY_BASE; use Go duration format like 30s")
+	}
+	webhookAllowPrivate, err := strconv.ParseBool(getenvDefault("WEBHOOK_ALLOW_PRIVATE", "false"))
+	if err != nil {
+		return errors.New("invalid WEBHOOK_ALLOW_PRIVATE; use true or false")
+	}
+	rotation, err := time.ParseDuration(getenvDefault("JWT_KEY_ROTATION", "720h"))
+	if err != nil || rotation < 0 {
+		return errors.New("invalid JWT_KEY_ROTATION; use Go duration format like 720h, or 0 to disable")
+	}
+	overlap, err := time.ParseDuration(getenvDefault("JWT_KEY_OVERLAP", expiryStr))
+	if err != nil || overlap < dur {
+		return errors.New("invalid JWT_KEY_OVERLAP; it must be a Go duration of at least JWT_EXPIRY")
+	}
 
 	cfg = Config{
-		JWTSecret:          os.Getenv("JWT_SECRET"),
+		JWTSigningAlg:      getenvDefault("JWT_SIGNING_ALG", "RS256"),
+		JWTKeyRotation:     rotation,
+		JWTKeyOverlap:      overlap,
 		JWTExpiry:          dur,
+		RefreshTokenExpiry: refreshExpiry,
 		DBPath:             getenvDefault("DB_PATH", "auth.db"),
 		SuperAdminName:     getenvDefault("SUPERADMIN_NAME", "Super Admin"),
 		SuperAdminEmail:    os.Getenv("SUPERADMIN_EMAIL"),
 		SuperAdminPassword: os.Getenv("SUPERADMIN_PASSWORD"),
+
+		PasswordResetExpiry:             resetExpiry,
+		PasswordResetURL:                os.Getenv("PASSWORD_RESET_URL"),
+		EmailVerificationSecret:         os.Getenv("EMAIL_VERIFICATION_SECRET"),
+		EmailVerificationExpiry:         verifyExpiry,
+		EmailVerificationURL:            os.Getenv("EMAIL_VERIFICATION_URL"),
+		EmailVerificationResendInterval: resendInterval,
+		TOTPIssuer:                      getenvDefault("TOTP_ISSUER", "AuthService"),
+		LoginChallengeExpiry:            challengeExpiry,
+		LoginBackoffThreshold:           backoffThreshold,
+		LoginIPBackoffThreshold:         ipBackoffThreshold,
+		LoginBackoffBase:                backoffBase,
+		LoginBackoffMax:                 backoffMax,
+		LoginFailureWindow:              failureWindow,
+		LoginLockoutThreshold:           lockoutThreshold,
+		LoginLockoutDuration:            lockoutDuration,
+		NotificationRetention:           notificationRetention,
+		NotificationStreamHeartbeat:     streamHeartbeat,
+		NotificationStreamPoll:          streamPoll,
+		NotificationMaxAttempts:         maxAttempts,
+		NotificationRetryBase:           retryBase,
+		WebhookDriver:                   getenvDefault("WEBHOOK_DRIVER", "http"),
+		WebhookFile:                     getenvDefault("WEBHOOK_FILE", "webhooks.log"),
+		WebhookAllowPrivate:             webhookAllowPrivate,
+		TrustedProxies:                  splitList(getenvDefault("TRUSTED_PROXIES", "127.0.0.1,::1")),
+		MailDriver:                      getenvDefault("MAIL_DRIVER", "log"),
+		MailFrom:                        getenvDefault("MAIL_FROM", "no-reply@localhost"),
+		MailFile:                        getenvDefault("MAIL_FILE", "mail.log"),
+		SMTPHost:                        os.Getenv("SMTP_HOST"),
+		SMTPPort:                        getenvDefault("SMTP_PORT", "587"),
+		SMTPUsername:                    os.Getenv("SMTP_USERNAME"),
+		SMTPPassword:                    os.Getenv("SMTP_PASSWORD"),
+
+		GatewayIdentitySecret: os.Getenv("GATEWAY_IDENTITY_SECRET"),
+		InternalAPIToken:      os.Getenv("INTERNAL_API_TOKEN"),
 	}
 
-	if cfg.JWTSecret == "" {
-		return errors.New("JWT_SECRET is required")
+	if cfg.JWTSigningAlg != "RS256" && cfg.JWTSigningAlg != "EdDSA" {
+		return errors.New("JWT_SIGNING_ALG must be RS256 or EdDSA")
+	}
+	if cfg.EmailVerificationSecret == "" {
+		return errors.New("EMAIL_VERIFICATION_SECRET is required")
 	}
 	if cfg.SuperAdminEmail == "" || cfg.SuperAdminPassword == "" {
 		// Not strictly required to run, but needed to seed a super admin.
@@ -62,3 +259,14 @@ func getenvDefault(key, def string) string {
 	}
 	return v
 }
+
+// splitList splits a comma-separated value, dropping empty entries.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
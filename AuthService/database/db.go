@@ -1,15 +1,22 @@
 package database
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/glebarez/sqlite"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+	otelgorm "gorm.io/plugin/opentelemetry/tracing"
 
 	"authservice/config"
+	"authservice/keys"
+	"authservice/logging"
 	"authservice/models"
 	"authservice/utils"
 )
@@ -17,31 +24,142 @@ import (
 // DB is the global database handle.
 var DB *gorm.DB
 
-// InitDatabase opens the SQLite database, runs migrations, and seeds the Super Admin.
+// InitDatabase opens the SQLite database, runs migrations, seeds the built-in
+// roles and the Super Admin and loads (or creates) the token signing keys.
 func InitDatabase() error {
 	c := config.Get()
 
 	// Open SQLite database using GORM
-	db, err := gorm.Open(sqlite.Open(c.DBPath), &gorm.Config{})
+	db, err := gorm.Open(sqlite.Open(c.DBPath), &gorm.Config{
+		Logger: logging.NewGormLogger(logger.Warn),
+		// Times are stored as text, so they must share a zone to compare
+		NowFunc: func() time.Time { return time.Now().UTC() },
+	})
 	if err != nil {
 		return fmt.Errorf("open sqlite: %w", err)
 	}
 	DB = db
 
+	// Accounts created before email verification existed are treated as verified
+	backfillVerified := db.Migrator().HasTable(&models.User{}) &&
+		!db.Migrator().HasColumn(&models.User{}, "EmailVerifiedAt")
+
 	// Migrations
-	if err := db.AutoMigrate(&models.User{}, &models.Notification{}); err != nil {
+	if err := db.AutoMigrate(
+		&models.User{}, &models.Notification{},
+		&models.RefreshToken{}, &models.TokenRevocation{}, &models.SigningKey{},
+		&models.PasswordReset{},
+		&models.RecoveryCode{}, &models.LoginChallenge{}, &models.TwoFactorPolicy{},
+		&models.LoginThrottle{}, &models.Role{}, &models.RolePermission{},
+		&models.UserEvent{}, &models.AuditEntry{},
+		&models.NotificationDelivery{}, &models.NotificationPreference{},
+	); err != nil {
 		return fmt.Errorf("migrate: %w", err)
 	}
+	if err := protectAuditLog(db); err != nil {
+		return fmt.Errorf("protect audit log: %w", err)
+	}
+	if backfillVerified {
+		if err := db.Model(&models.User{}).Where("email_verified_at IS NULL").
+			Update("email_verified_at", gorm.Expr("created_at")).Error; err != nil {
+			return fmt.Errorf("backfill email verification: %w", err)
+		}
+	}
+
+	// Built-in roles and their default permissions
+	if err := seedRoles(db); err != nil {
+		return fmt.Errorf("seed roles: %w", err)
+	}
 
 	// Seed Super Admin if not exists
 	if err := seedSuperAdmin(db); err != nil {
 		return fmt.Errorf("seed superadmin: %w", err)
 	}
 
+	if err := keys.Init(context.Background(), db); err != nil {
+		return fmt.Errorf("signing keys: %w", err)
+	}
+
+	// Record a span for every query from here on; migrations stay untraced
+	if err := db.Use(otelgorm.NewPlugin(otelgorm.WithoutMetrics())); err != nil {
+		return fmt.Errorf("enable query tracing: %w", err)
+	}
+
 	log.Println("Database Connected Sucessfully")
 	return nil
 }
 
+// protectAuditLog makes the audit log append-only: the database aborts any
+// update or delete of an audit entry.
+func protectAuditLog(db *gorm.DB) error {
+	for _, op := range []string{"UPDATE", "DELETE"} {
+		if err := db.Exec(fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS audit_entries_no_%s
+			BEFORE %s ON audit_entries
+			BEGIN SELECT RAISE(ABORT, 'audit log is append-only'); END`, strings.ToLower(op), op)).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// defaultRoles are created with these permissions when missing. Later changes
+// made through the roles API are kept.
+var defaultRoles = []struct {
+	role        models.Role
+	permissions []string
+}{
+	{
+		role:        models.Role{Name: models.RoleUser, Description: "Customer", SelfRegister: true},
+		permissions: []string{models.PermOrderCreate},
+	},
+	{
+		role: models.Role{Name: models.RoleAdmin, Description: "Seller", SelfRegister: true, RequiresApproval: true},
+		permissions: []string{
+			models.PermProductWrite, models.PermOrderCreate,
+			models.PermOrderReadAll, models.PermOrderUpdateStatus,
+		},
+	},
+	{
+		role: models.Role{Name: models.RoleSuperAdmin, Description: "Super Admin"},
+	},
+}
+
+// seedRoles creates the built-in roles. Super Admin always holds every known
+// permission, including ones added in later versions.
+func seedRoles(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, d := range defaultRoles {
+			role := d.role
+			res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&role)
+			if res.Error != nil {
+				return res.Error
+			}
+			permissions := d.permissions
+			if role.Name == models.RoleSuperAdmin {
+				permissions = make([]string, 0, len(models.Permissions))
+				for p := range models.Permissions {
+					permissions = append(permissions, p)
+				}
+			} else if res.RowsAffected == 0 {
+				continue
+			}
+			for _, p := range permissions {
+				if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+					Create(&models.RolePermission{Role: role.Name, Permission: p}).Error; err != nil {
+					return err
+				}
+			}
+		}
+		// Earlier versions let any role be granted these
+		reserved := make([]string, 0, len(models.SuperAdminPermissions))
+		for p := range models.SuperAdminPermissions {
+			reserved = append(reserved, p)
+		}
+		return tx.Where("permission IN ? AND role <> ?", reserved, models.RoleSuperAdmin).
+			Delete(&models.RolePermission{}).Error
+	})
+}
+
 func seedSuperAdmin(db *gorm.DB) error {
 	c := config.Get()
 
@@ -64,13 +182,15 @@ func seedSuperAdmin(db *gorm.DB) error {
 		return err
 	}
 
+	now := time.Now().UTC()
 	super := models.User{
-		Name:         valueOrDefault(c.SuperAdminName, "Super Admin"),
-		Email:        c.SuperAdminEmail,
-		PasswordHash: hash,
-		Role:         models.RoleSuperAdmin,
-		IsApproved:   true,
-		CreatedAt:    time.Now(),
+		Name:            valueOrDefault(c.SuperAdminName, "Super Admin"),
+		Email:           c.SuperAdminEmail,
+		PasswordHash:    hash,
+		Role:            models.RoleSuperAdmin,
+		IsApproved:      true,
+		CreatedAt:       now,
+		EmailVerifiedAt: &now,
 	}
 	if err := db.Create(&super).Error; err != nil {
 		return err
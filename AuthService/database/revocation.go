@@ -0,0 +1,21 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"authservice/models"
+)
+
+// IsTokenRevoked reports whether the access token identified by jti, issued
+// to userID at issuedAt, is on the revocation list.
+// issuedAt is compared with millisecond precision (see revocation.IssuedAt):
+// a token issued before the cutoff is revoked, one issued at or after it is not.
+func IsTokenRevoked(ctx context.Context, jti string, userID uint, issuedAt time.Time) (bool, error) {
+	var count int64
+	err := DB.WithContext(ctx).Model(&models.TokenRevocation{}).
+		Where("expires_at > ?", time.Now().UTC()).
+		Where("(jti <> '' AND jti = ?) OR (jti = '' AND user_id = ? AND issued_before > ?)", jti, userID, issuedAt.UTC()).
+		Count(&count).Error
+	return count > 0, err
+}
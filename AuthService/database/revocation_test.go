@@ -0,0 +1,70 @@
+package database
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"authservice/models"
+)
+
+func setupRevocations(t *testing.T) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "auth.db")), &gorm.Config{
+		Logger:  logger.Discard,
+		NowFunc: func() time.Time { return time.Now().UTC() },
+	})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.TokenRevocation{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	DB = db
+}
+
+func TestIsTokenRevokedUserCutoff(t *testing.T) {
+	setupRevocations(t)
+	second := time.Now().Truncate(time.Second)
+	cutoff := second.Add(600 * time.Millisecond).UTC()
+	expires := time.Now().UTC().Add(time.Hour)
+	DB.Create(&models.TokenRevocation{UserID: 7, IssuedBefore: &cutoff, ExpiresAt: expires, Reason: models.RevocationSuspended})
+	DB.Create(&models.TokenRevocation{JTI: "logged-out", UserID: 9, ExpiresAt: expires, Reason: models.RevocationLogout})
+	expired := cutoff.Add(time.Hour)
+	DB.Create(&models.TokenRevocation{UserID: 8, IssuedBefore: &expired, ExpiresAt: time.Now().UTC().Add(-time.Minute), Reason: models.RevocationSuspended})
+
+	tests := []struct {
+		name     string
+		jti      string
+		userID   uint
+		issuedAt time.Time
+		want     bool
+	}{
+		{"earlier second", "a", 7, second.Add(-time.Second), true},
+		{"before the cutoff in the same second", "a", 7, cutoff.Add(-100 * time.Millisecond), true},
+		{"just before the cutoff", "a", 7, cutoff.Add(-time.Millisecond), true},
+		{"at the cutoff", "a", 7, cutoff, false},
+		{"after the cutoff in the same second", "a", 7, cutoff.Add(100 * time.Millisecond), false},
+		{"same second without iat_ms", "a", 7, second, true},
+		{"next second", "a", 7, second.Add(time.Second), false},
+		{"another user", "a", 9, second.Add(-time.Second), false},
+		{"revoked jti", "logged-out", 9, time.Now(), true},
+		{"expired entry", "a", 8, cutoff, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := IsTokenRevoked(context.Background(), tt.jti, tt.userID, tt.issuedAt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("IsTokenRevoked(issued %v, cutoff %v) = %v, want %v", tt.issuedAt, cutoff, got, tt.want)
+			}
+		})
+	}
+}
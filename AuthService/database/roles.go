@@ -0,0 +1,20 @@
+package database
+
+import (
+	"sort"
+
+	"gorm.io/gorm"
+
+	"authservice/models"
+)
+
+// RolePermissions returns the sorted permissions granted to role.
+func RolePermissions(db *gorm.DB, role string) ([]string, error) {
+	var permissions []string
+	if err := db.Model(&models.RolePermission{}).Where("role = ?", role).
+		Pluck("permission", &permissions).Error; err != nil {
+		return nil, err
+	}
+	sort.Strings(permissions)
+	return permissions, nil
+}
@@ -3,12 +3,17 @@ package handlers
 import (
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 
 	"authservice/database"
+	"authservice/lockout"
+	"authservice/metrics"
 	"authservice/models"
+	"authservice/notify"
 	"authservice/utils"
 )
 
@@ -21,11 +26,12 @@ func ApproveAdmin(c *gin.Context) {
 		return
 	}
 	var user models.User
-	if err := database.DB.First(&user, id).Error; err != nil {
+	if err := database.DB.WithContext(c.Request.Context()).First(&user, id).Error; err != nil || user.Deleted() {
 		utils.JSONError(c, http.StatusNotFound, "user not found")
 		return
 	}
-	if user.Role != models.RoleAdmin {
+	var role models.Role
+	if err := database.DB.WithContext(c.Request.Context()).Where("name = ?", user.Role).First(&role).Error; err != nil || !role.RequiresApproval {
 		utils.JSONError(c, http.StatusBadRequest, "only admin users require approval")
 		return
 	}
@@ -33,31 +39,101 @@ func ApproveAdmin(c *gin.Context) {
 		utils.JSONOK(c, http.StatusOK, gin.H{"message": "admin already approved"})
 		return
 	}
-	// Approve and create notification in a transaction
-	if err := database.DB.Transaction(func(tx *gorm.DB) error {
+	// Approve and create notification in a transaction; an earlier rejection is withdrawn
+	if err := database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
 		user.IsApproved = true
+		user.RejectedAt = nil
+		user.RejectionReason = ""
 		if err := tx.Save(&user).Error; err != nil {
 			return err
 		}
-		notif := models.Notification{UserID: user.ID, Message: "Your admin account has been approved"}
-		if err := tx.Create(&notif).Error; err != nil {
+		if err := notify.Create(tx, user.ID, models.NotificationAccountApproved, "Your admin account has been approved", nil); err != nil {
 			return err
 		}
-		return nil
+		return recordAudit(tx, c, models.AuditUserApproved, user.ID, gin.H{"role": user.Role})
 	}); err != nil {
 		utils.JSONError(c, http.StatusInternalServerError, "failed to approve admin")
 		return
 	}
+	metrics.AdminApproved()
 
 	utils.JSONOK(c, http.StatusOK, gin.H{"message": "admin approved"})
 }
 
-// GetPendingAdminApprovals returns a list of Admin users pending approval.
+// RejectAdmin rejects the application of a user waiting for approval. The
+// reason is delivered as a notification; the account cannot log in unless it
+// is approved later.
+func RejectAdmin(c *gin.Context) {
+	var req ReasonRequest
+	if !utils.BindJSONOrAbort(c, &req) {
+		return
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		utils.JSONError(c, http.StatusBadRequest, "invalid user id")
+		return
+	}
+	var user models.User
+	if err := database.DB.WithContext(c.Request.Context()).First(&user, id).Error; err != nil || user.Deleted() {
+		utils.JSONError(c, http.StatusNotFound, "user not found")
+		return
+	}
+	if user.IsApproved {
+		utils.JSONError(c, http.StatusConflict, "user is already approved")
+		return
+	}
+	if user.Rejected() {
+		utils.JSONError(c, http.StatusConflict, "application already rejected")
+		return
+	}
+
+	reason := strings.TrimSpace(req.Reason)
+	if err := database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"rejected_at":      time.Now().UTC(),
+			"rejection_reason": reason,
+		}).Error; err != nil {
+			return err
+		}
+		if err := notify.Create(tx, user.ID, models.NotificationAccountRejected,
+			"Your seller application has been rejected: "+reason, gin.H{"reason": reason}); err != nil {
+			return err
+		}
+		return recordAudit(tx, c, models.AuditUserRejected, user.ID, gin.H{"reason": reason})
+	}); err != nil {
+		utils.JSONError(c, http.StatusInternalServerError, "failed to reject application")
+		return
+	}
+	utils.JSONOK(c, http.StatusOK, gin.H{"message": "application rejected", "user_id": user.ID})
+}
+
+// GetPendingAdminApprovals returns the users of roles that require approval
+// who are still waiting for it.
 func GetPendingAdminApprovals(c *gin.Context) {
 	var admins []models.User
-	if err := database.DB.Where("role = ? AND is_approved = ?", models.RoleAdmin, false).Find(&admins).Error; err != nil {
+	if err := database.DB.WithContext(c.Request.Context()).
+		Where("is_approved = ? AND rejected_at IS NULL AND deleted_at IS NULL", false).Find(&admins).Error; err != nil {
 		utils.JSONError(c, http.StatusInternalServerError, "failed to retrieve pending admin approvals")
 		return
 	}
 	utils.JSONOK(c, http.StatusOK, admins)
 }
+
+// UnlockUser lets Super Admin lift a lock caused by failed logins before it expires.
+func UnlockUser(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		utils.JSONError(c, http.StatusBadRequest, "invalid user id")
+		return
+	}
+	var user models.User
+	if err := database.DB.WithContext(c.Request.Context()).First(&user, id).Error; err != nil {
+		utils.JSONError(c, http.StatusNotFound, "user not found")
+		return
+	}
+	if err := lockout.Unlock(c.Request.Context(), &user); err != nil {
+		utils.JSONError(c, http.StatusInternalServerError, "failed to unlock user")
+		return
+	}
+	utils.JSONOK(c, http.StatusOK, gin.H{"message": "user unlocked", "user_id": user.ID})
+}
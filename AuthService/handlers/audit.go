@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"authservice/database"
+	"authservice/logging"
+	"authservice/metrics"
+	"authservice/models"
+	"authservice/utils"
+)
+
+// Audit log page sizes.
+const (
+	defaultAuditLimit = 50
+	maxAuditLimit     = 500
+)
+
+// auditExportBatch is the number of entries read per query while exporting.
+const auditExportBatch = 500
+
+// ListAudit returns one page of the audit log, newest first. Query
+// parameters: user (entries where the user is actor or target), actor,
+// target, action (comma separated), outcome, from and to (RFC 3339; from is
+// inclusive, to exclusive), limit (up to 500) and before, the next_cursor of
+// the previous page. next_cursor is null on the last page.
+func ListAudit(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultAuditLimit)))
+	if err != nil || limit < 1 || limit > maxAuditLimit {
+		utils.JSONError(c, http.StatusBadRequest, "limit must be between 1 and 500")
+		return
+	}
+	query, ok := auditQuery(c)
+	if !ok {
+		return
+	}
+	if before := c.Query("before"); before != "" {
+		cursor, err := strconv.ParseUint(before, 10, 64)
+		if err != nil {
+			utils.JSONError(c, http.StatusBadRequest, "invalid before cursor")
+			return
+		}
+		query = query.Where("id < ?", cursor)
+	}
+
+	// One extra row tells whether another page follows
+	entries := []models.AuditEntry{}
+	if err := query.Order("id DESC").Limit(limit + 1).Find(&entries).Error; err != nil {
+		utils.JSONError(c, http.StatusInternalServerError, "failed to fetch audit log")
+		return
+	}
+	var next *uint
+	if len(entries) > limit {
+		entries = entries[:limit]
+		next = &entries[limit-1].ID
+	}
+	utils.JSONOK(c, http.StatusOK, gin.H{"entries": entries, "next_cursor": next})
+}
+
+// ExportAudit streams the audit entries matching the filters of ListAudit,
+// oldest first, as newline delimited JSON for offline analysis. limit and
+// before do not apply.
+func ExportAudit(c *gin.Context) {
+	query, ok := auditQuery(c)
+	if !ok {
+		return
+	}
+	log := logging.FromContext(c.Request.Context())
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Content-Disposition",
+		`attachment; filename="audit-`+time.Now().UTC().Format("20060102T150405Z")+`.ndjson"`)
+	c.Status(http.StatusOK)
+
+	enc := json.NewEncoder(c.Writer)
+	var lastID uint
+	for {
+		var batch []models.AuditEntry
+		if err := query.Session(&gorm.Session{}).Where("id > ?", lastID).
+			Order("id").Limit(auditExportBatch).Find(&batch).Error; err != nil {
+			// The status is sent already; a cut off export is the only signal left
+			log.Error("export audit log", "error", err)
+			c.Abort()
+			return
+		}
+		for i := range batch {
+			if err := enc.Encode(&batch[i]); err != nil {
+				return
+			}
+		}
+		c.Writer.Flush()
+		if len(batch) < auditExportBatch {
+			return
+		}
+		lastID = batch[len(batch)-1].ID
+	}
+}
+
+// auditQuery builds the audit log query for the filters of ListAudit,
+// answering 400 when one is invalid.
+func auditQuery(c *gin.Context) (*gorm.DB, bool) {
+	query := database.DB.WithContext(c.Request.Context()).Model(&models.AuditEntry{})
+	for _, f := range []struct{ param, cond string }{
+		{"user", "(actor_id = ? OR target_user_id = ?)"},
+		{"actor", "actor_id = ?"},
+		{"target", "target_user_id = ?"},
+	} {
+		raw := c.Query(f.param)
+		if raw == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			utils.JSONError(c, http.StatusBadRequest, "invalid "+f.param+" id")
+			return nil, false
+		}
+		args := make([]interface{}, strings.Count(f.cond, "?"))
+		for i := range args {
+			args[i] = id
+		}
+		query = query.Where(f.cond, args...)
+	}
+	if raw := c.Query("action"); raw != "" {
+		actions := strings.Split(raw, ",")
+		for _, action := range actions {
+			if !slices.Contains(models.AuditActions, action) {
+				utils.JSONError(c, http.StatusBadRequest, "unknown action "+strconv.Quote(action))
+				return nil, false
+			}
+		}
+		query = query.Where("action IN ?", actions)
+	}
+	if outcome := c.Query("outcome"); outcome != "" {
+		query = query.Where("outcome = ?", outcome)
+	}
+	for _, f := range []struct{ param, cond string }{
+		{"from", "created_at >= ?"},
+		{"to", "created_at < ?"},
+	} {
+		raw := c.Query(f.param)
+		if raw == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			utils.JSONError(c, http.StatusBadRequest, "invalid "+f.param+"; use RFC 3339 like 2024-05-01T00:00:00Z")
+			return nil, false
+		}
+		// Times are stored in UTC and compared as text
+		query = query.Where(f.cond, t.UTC())
+	}
+	return query, true
+}
+
+// recordAudit stores an audit entry for a successful action of the logged in
+// user on target. details is encoded as JSON and may be nil.
+func recordAudit(tx *gorm.DB, c *gin.Context, action string, target uint, details gin.H) error {
+	entry, err := auditEntry(c, action, target, details)
+	if err != nil {
+		return err
+	}
+	entry.ActorID = c.GetUint("user_id")
+	return tx.Create(entry).Error
+}
+
+// loginAttempt counts a login attempt with the given result and records it in
+// the audit log with the email it was made for. user is nil when the email
+// matches no account; it is the actor only once the login succeeded.
+func loginAttempt(c *gin.Context, user *models.User, email, result string) {
+	metrics.LoginAttempt(result)
+
+	var target uint
+	if user != nil {
+		target = user.ID
+	}
+	entry, err := auditEntry(c, models.AuditLogin, target, gin.H{"email": email})
+	if err == nil {
+		entry.Outcome = result
+		if result == metrics.LoginSuccess {
+			entry.ActorID = target
+		}
+		err = database.DB.WithContext(c.Request.Context()).Create(entry).Error
+	}
+	if err != nil {
+		logging.FromContext(c.Request.Context()).Error("record login in audit log", "result", result, "error", err)
+	}
+}
+
+// auditEntry returns an unsaved, successful audit entry for a request, with
+// the client's IP and user agent.
+func auditEntry(c *gin.Context, action string, target uint, details gin.H) (*models.AuditEntry, error) {
+	entry := &models.AuditEntry{
+		Action:       action,
+		TargetUserID: target,
+		Outcome:      models.AuditSuccess,
+		IP:           c.ClientIP(),
+		UserAgent:    truncateUTF8(c.Request.UserAgent(), 255),
+	}
+	if details != nil {
+		raw, err := json.Marshal(details)
+		if err != nil {
+			return nil, err
+		}
+		entry.Details = raw
+	}
+	return entry, nil
+}
+
+// truncateUTF8 shortens s to at most n bytes without splitting a UTF-8 sequence.
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -1,13 +1,21 @@
 package handlers
 
 import (
+	"context"
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 
 	"authservice/database"
+	"authservice/lockout"
+	"authservice/logging"
+	"authservice/metrics"
 	"authservice/models"
 	"authservice/utils"
 )
@@ -17,11 +25,12 @@ type RegisterRequest struct {
 	Name      string `json:"name" binding:"required,min=2"`
 	Email     string `json:"email" binding:"required,email"`
 	Password  string `json:"password" binding:"required,min=6"`
-	Role      string `json:"role" binding:"omitempty,oneof=superadmin saler user"`
+	Role      string `json:"role"`
 	GSTNumber string `json:"gst_number" binding:"omitempty"` //only for the admin (Salers)
 }
 
-// Register registers a new user. Admins require approval; Super Admin creation is restricted by seeding.
+// Register registers a new user with a role open to self-registration. Accounts of
+// roles that require approval wait for it; Super Admin creation is restricted by seeding.
 func Register(c *gin.Context) {
 	var req RegisterRequest
 	if !utils.BindJSONOrAbort(c, &req) {
@@ -32,8 +41,13 @@ func Register(c *gin.Context) {
 	if req.Role == "" {
 		req.Role = models.RoleUser
 	}
-	if req.Role == models.RoleSuperAdmin {
-		utils.JSONError(c, http.StatusForbidden, "cannot self-register as superadmin")
+	var role models.Role
+	if err := database.DB.WithContext(c.Request.Context()).Where("name = ?", req.Role).First(&role).Error; err != nil {
+		utils.JSONError(c, http.StatusBadRequest, "unknown role")
+		return
+	}
+	if !role.SelfRegister {
+		utils.JSONError(c, http.StatusForbidden, "cannot self-register as "+role.Name)
 		return
 	}
 	if req.Role == models.RoleAdmin {
@@ -45,7 +59,7 @@ func Register(c *gin.Context) {
 
 	// Check if email exists
 	var existing models.User
-	if err := database.DB.Where("email = ?", req.Email).First(&existing).Error; err == nil {
+	if err := database.DB.WithContext(c.Request.Context()).Where("email = ?", req.Email).First(&existing).Error; err == nil {
 		utils.JSONError(c, http.StatusBadRequest, "email already in use")
 		return
 	}
@@ -56,25 +70,43 @@ func Register(c *gin.Context) {
 		return
 	}
 
+	now := time.Now().UTC()
 	user := models.User{
-		Name:         strings.TrimSpace(req.Name),
-		Email:        req.Email,
-		PasswordHash: hash,
-		Role:         req.Role,
-		IsApproved:   req.Role != models.RoleAdmin, // Admins require approval
-		CreatedAt:    time.Now(),
-		GSTNum:       strings.TrimSpace(req.GSTNumber),
-	}
-	if err := database.DB.Create(&user).Error; err != nil {
+		Name:               strings.TrimSpace(req.Name),
+		Email:              req.Email,
+		PasswordHash:       hash,
+		Role:               req.Role,
+		IsApproved:         !role.RequiresApproval,
+		CreatedAt:          now,
+		GSTNum:             strings.TrimSpace(req.GSTNumber),
+		VerificationSentAt: &now,
+	}
+	err = database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		entry, err := auditEntry(c, models.AuditUserRegistered, user.ID, gin.H{"role": user.Role})
+		if err != nil {
+			return err
+		}
+		entry.ActorID = user.ID
+		return tx.Create(entry).Error
+	})
+	if err != nil {
 		utils.JSONError(c, http.StatusInternalServerError, "failed to create user")
 		return
 	}
+	metrics.UserRegistered(user.Role)
+
+	// New accounts stay unverified until the emailed link is followed
+	go sendVerificationMail(context.WithoutCancel(c.Request.Context()), user)
 
 	utils.JSONOK(c, http.StatusCreated, gin.H{
-		"message":     "user registered successfully",
-		"user_id":     user.ID,
-		"is_approved": user.IsApproved,
-		"role":        user.Role,
+		"message":        "user registered successfully; check your email to verify your address",
+		"user_id":        user.ID,
+		"is_approved":    user.IsApproved,
+		"email_verified": false,
+		"role":           user.Role,
 	})
 }
 
@@ -84,43 +116,159 @@ type LoginRequest struct {
 	Password string `json:"password" binding:"required"`
 }
 
-// Login authenticates the user and returns a JWT token if approved.
+// Login authenticates the user and, if approved, returns a short-lived access
+// token together with a refresh token that starts a new token family. When a
+// TOTP code is needed, it returns a challenge token for POST /login/2fa instead.
 func Login(c *gin.Context) {
 	var req LoginRequest
 	if !utils.BindJSONOrAbort(c, &req) {
 		return
 	}
 	email := strings.ToLower(strings.TrimSpace(req.Email))
+	ctx := c.Request.Context()
+
+	// Refuse throttled clients before paying for a bcrypt comparison
+	wait, err := lockout.Wait(ctx, email, c.ClientIP())
+	if err != nil {
+		loginAttempt(c, nil, email, metrics.LoginError)
+		utils.JSONError(c, http.StatusInternalServerError, "failed to check login attempts")
+		return
+	}
+	if wait > 0 {
+		loginAttempt(c, nil, email, metrics.LoginThrottled)
+		setRetryAfter(c, wait)
+		utils.JSONError(c, http.StatusTooManyRequests, "too many failed login attempts; try again later")
+		return
+	}
 
 	var user models.User
-	if err := database.DB.Where("email = ?", email).First(&user).Error; err != nil {
+	err = database.DB.WithContext(ctx).Where("email = ?", email).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		loginFailed(c, email, nil, metrics.LoginInvalid, "invalid email or password")
+		return
+	} else if err != nil {
+		loginAttempt(c, nil, email, metrics.LoginError)
+		utils.JSONError(c, http.StatusInternalServerError, "failed to log in")
+		return
+	}
+	// Locked accounts get the answer of an unknown email, so the response does
+	// not tell whether the account exists
+	if user.Locked(time.Now()) {
+		loginAttempt(c, &user, email, metrics.LoginLocked)
 		utils.JSONError(c, http.StatusUnauthorized, "invalid email or password")
 		return
 	}
 	if !utils.CheckPassword(user.PasswordHash, req.Password) {
-		utils.JSONError(c, http.StatusUnauthorized, "invalid email or password")
+		loginFailed(c, email, &user, metrics.LoginInvalid, "invalid email or password")
 		return
 	}
-	// For admin role, ensure approved
-	if user.Role == models.RoleAdmin && !user.IsApproved {
-		utils.JSONError(c, http.StatusForbidden, "admin not approved yet")
+	if loginRefused(c, &user) {
+		return
+	}
+
+	// Users with two-factor authentication, or whose role requires it, finish
+	// logging in with a TOTP code
+	required, err := twoFactorRequired(database.DB.WithContext(ctx), user.Role)
+	if err != nil {
+		loginAttempt(c, &user, email, metrics.LoginError)
+		utils.JSONError(c, http.StatusInternalServerError, "failed to check two-factor policy")
+		return
+	}
+	if user.TwoFactorEnabled() || required {
+		startLoginChallenge(c, &user)
 		return
 	}
 
-	token, err := utils.GenerateToken(user.ID, user.Role)
+	completeLogin(c, &user, nil)
+}
+
+// loginRefused answers the login of a suspended, rejected or not yet
+// approved account and reports whether it did. LoginTwoFactor runs it again
+// since the account may have changed after the password step.
+func loginRefused(c *gin.Context, user *models.User) bool {
+	switch {
+	case user.Suspended():
+		loginAttempt(c, user, user.Email, metrics.LoginSuspended)
+		utils.JSONError(c, http.StatusForbidden, "account suspended")
+	case user.Rejected():
+		loginAttempt(c, user, user.Email, metrics.LoginNotApproved)
+		utils.JSONError(c, http.StatusForbidden, "application rejected: "+user.RejectionReason)
+	case !user.IsApproved:
+		// Roles that require approval cannot log in before it
+		loginAttempt(c, user, user.Email, metrics.LoginNotApproved)
+		utils.JSONError(c, http.StatusForbidden, "admin not approved yet")
+	default:
+		return false
+	}
+	return true
+}
+
+// completeLogin issues the tokens of a successful login, starting a new
+// refresh token family, and adds extra fields to the response.
+func completeLogin(c *gin.Context, user *models.User, extra gin.H) {
+	if err := lockout.Succeed(c.Request.Context(), user.Email); err != nil {
+		logging.FromContext(c.Request.Context()).Warn("reset failed logins", "user_id", user.ID, "error", err)
+	}
+	familyID, err := utils.NewTokenID()
+	if err != nil {
+		loginAttempt(c, user, user.Email, metrics.LoginError)
+		utils.JSONError(c, http.StatusInternalServerError, "failed to generate token")
+		return
+	}
+	tokens, err := issueTokens(database.DB.WithContext(c.Request.Context()), user, familyID)
 	if err != nil {
+		loginAttempt(c, user, user.Email, metrics.LoginError)
 		utils.JSONError(c, http.StatusInternalServerError, "failed to generate token")
 		return
 	}
+	loginAttempt(c, user, user.Email, metrics.LoginSuccess)
 
-	utils.JSONOK(c, http.StatusOK, gin.H{
-		"token": token,
+	resp := gin.H{
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"token_type":    tokens.TokenType,
+		"expires_in":    tokens.ExpiresIn,
 		"user": gin.H{
-			"id":          user.ID,
-			"name":        user.Name,
-			"email":       user.Email,
-			"role":        user.Role,
-			"is_approved": user.IsApproved,
+			"id":                 user.ID,
+			"name":               user.Name,
+			"email":              user.Email,
+			"role":               user.Role,
+			"is_approved":        user.IsApproved,
+			"email_verified":     user.EmailVerified(),
+			"two_factor_enabled": user.TwoFactorEnabled(),
 		},
-	})
+	}
+	for k, v := range extra {
+		resp[k] = v
+	}
+	utils.JSONOK(c, http.StatusOK, resp)
+}
+
+// loginFailed records a wrong password or second factor for email, which may
+// lock user, and answers the request with outcome and msg. A failure that
+// locks the account is answered like any other, so the response does not
+// reveal that the account exists; the owner is notified of the lock.
+func loginFailed(c *gin.Context, email string, user *models.User, outcome, msg string) {
+	locked, err := lockout.Fail(c.Request.Context(), email, c.ClientIP(), user)
+	if err != nil {
+		logging.FromContext(c.Request.Context()).Error("record failed login", "error", err)
+	}
+	if locked {
+		outcome = metrics.LoginLocked
+	}
+	loginAttempt(c, user, email, outcome)
+	utils.JSONError(c, http.StatusUnauthorized, msg)
+}
+
+// respondLocked answers the second step of a login for a locked account. The
+// caller has proven the password already, so the lock is reported as such.
+func respondLocked(c *gin.Context, user *models.User) {
+	loginAttempt(c, user, user.Email, metrics.LoginLocked)
+	setRetryAfter(c, time.Until(*user.LockedUntil))
+	utils.JSONError(c, http.StatusLocked, "account temporarily locked after too many failed login attempts")
+}
+
+// setRetryAfter sets the Retry-After header to wait, rounded up to seconds.
+func setRetryAfter(c *gin.Context, wait time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
 }
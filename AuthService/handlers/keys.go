@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"authservice/keys"
+	"authservice/logging"
+	"authservice/models"
+	"authservice/utils"
+)
+
+// JWKS publishes the public keys that verify access tokens, including retired
+// keys whose tokens may still be valid.
+func JWKS(c *gin.Context) {
+	set, err := keys.PublicKeys(c.Request.Context())
+	if err != nil {
+		logging.FromContext(c.Request.Context()).Error("load signing keys failed", "error", err)
+		utils.JSONError(c, http.StatusInternalServerError, "failed to load signing keys")
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=300")
+	utils.JSONOK(c, http.StatusOK, set)
+}
+
+// RotateSigningKey lets Super Admin replace the signing key right away, e.g.
+// after a suspected compromise. The previous key keeps verifying tokens until
+// JWT_KEY_OVERLAP has passed.
+func RotateSigningKey(c *gin.Context) {
+	kid, err := keys.Rotate(c.Request.Context(), func(tx *gorm.DB, kid string) error {
+		return recordAudit(tx, c, models.AuditKeyRotated, 0, gin.H{"kid": kid})
+	})
+	if err != nil {
+		logging.FromContext(c.Request.Context()).Error("signing key rotation failed", "error", err)
+		utils.JSONError(c, http.StatusInternalServerError, "failed to rotate signing key")
+		return
+	}
+	utils.JSONOK(c, http.StatusOK, gin.H{"message": "signing key rotated", "kid": kid})
+}
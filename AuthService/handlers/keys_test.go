@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"authservice/database"
+	"authservice/keys"
+	"authservice/models"
+)
+
+func TestJWKSListsRotatedKeys(t *testing.T) {
+	admin := setupTokens(t)
+	if code := callAs(t, RotateSigningKey, admin.ID, http.MethodPost, "", nil); code != http.StatusOK {
+		t.Fatalf("rotate: status %d", code)
+	}
+	var audited int64
+	database.DB.Model(&models.AuditEntry{}).Where("action = ? AND actor_id = ?", models.AuditKeyRotated, admin.ID).Count(&audited)
+	if audited != 1 {
+		t.Fatalf("got %d key.rotated entries, want 1", audited)
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+	JWKS(c)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	if strings.Contains(w.Body.String(), `"d"`) {
+		t.Fatalf("JWKS contains private key material: %s", w.Body)
+	}
+	var set keys.JWKS
+	if err := json.Unmarshal(w.Body.Bytes(), &set); err != nil {
+		t.Fatal(err)
+	}
+	// The new key and the retired one, still within its overlap
+	var stored []models.SigningKey
+	database.DB.Order("created_at DESC").Find(&stored)
+	if len(set.Keys) != 2 || len(stored) != 2 {
+		t.Fatalf("published %d keys, stored %d, want 2", len(set.Keys), len(stored))
+	}
+	for i, k := range set.Keys {
+		if k.KID != stored[i].KID || k.Use != "sig" || k.Alg != stored[i].Algorithm {
+			t.Errorf("key %d = %+v, want kid %s", i, k, stored[i].KID)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"authservice/config"
+	"authservice/database"
+	"authservice/models"
+	"authservice/notify"
+	"authservice/utils"
+)
+
+// NotificationPreferenceRequest chooses the channels of a notification type.
+// All three channels must be given.
+type NotificationPreferenceRequest struct {
+	InApp   *bool `json:"in_app" binding:"required"`
+	Email   *bool `json:"email" binding:"required"`
+	Webhook *bool `json:"webhook" binding:"required"`
+}
+
+// WebhookRequest registers the URL the logged in user's webhook notifications
+// are posted to.
+type WebhookRequest struct {
+	URL string `json:"url" binding:"required,max=512"`
+}
+
+// preferenceResponse is the effective preference of one notification type;
+// Custom tells whether the user set it for the type itself.
+type preferenceResponse struct {
+	Type    string `json:"type"`
+	InApp   bool   `json:"in_app"`
+	Email   bool   `json:"email"`
+	Webhook bool   `json:"webhook"`
+	Custom  bool   `json:"custom"`
+}
+
+// GetNotificationPreferences returns the channels the logged in user gets
+// notifications on: the default for all types ("*") and the effective
+// preference of every type. Email is only sent to verified addresses and
+// webhooks only once a URL is registered.
+func GetNotificationPreferences(c *gin.Context) {
+	user, ok := loadMe(c)
+	if !ok {
+		return
+	}
+	var prefs []models.NotificationPreference
+	if err := database.DB.WithContext(c.Request.Context()).
+		Where("user_id = ?", user.ID).Find(&prefs).Error; err != nil {
+		utils.JSONError(c, http.StatusInternalServerError, "failed to load notification preferences")
+		return
+	}
+	byType := map[string]models.NotificationPreference{}
+	for _, p := range prefs {
+		byType[p.Type] = p
+	}
+
+	def, custom := byType[models.AllNotificationTypes]
+	if !custom {
+		def = notify.DefaultPreference(models.AllNotificationTypes)
+	}
+	types := make([]preferenceResponse, 0, len(models.NotificationTypes))
+	for _, typ := range models.NotificationTypes {
+		p, custom := byType[typ]
+		if !custom {
+			p = def
+		}
+		types = append(types, preferenceResponse{typ, p.InApp, p.Email, p.Webhook, custom})
+	}
+
+	var webhookURL *string
+	if user.WebhookURL != "" {
+		webhookURL = &user.WebhookURL
+	}
+	utils.JSONOK(c, http.StatusOK, gin.H{
+		"default":        preferenceResponse{models.AllNotificationTypes, def.InApp, def.Email, def.Webhook, custom},
+		"types":          types,
+		"email_verified": user.EmailVerified(),
+		"webhook_url":    webhookURL,
+	})
+}
+
+// SetNotificationPreference chooses the channels of the notification type
+// named by :type for the logged in user; "*" sets the default for the types
+// without a preference of their own.
+func SetNotificationPreference(c *gin.Context) {
+	typ, ok := preferenceType(c)
+	if !ok {
+		return
+	}
+	var req NotificationPreferenceRequest
+	if !utils.BindJSONOrAbort(c, &req) {
+		return
+	}
+
+	pref := models.NotificationPreference{
+		UserID:  c.GetUint("user_id"),
+		Type:    typ,
+		InApp:   *req.InApp,
+		Email:   *req.Email,
+		Webhook: *req.Webhook,
+	}
+	if err := database.DB.WithContext(c.Request.Context()).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "type"}},
+		DoUpdates: clause.AssignmentColumns([]string{"in_app", "email", "webhook", "updated_at"}),
+	}).Create(&pref).Error; err != nil {
+		utils.JSONError(c, http.StatusInternalServerError, "failed to save notification preference")
+		return
+	}
+	utils.JSONOK(c, http.StatusOK, preferenceResponse{typ, pref.InApp, pref.Email, pref.Webhook, true})
+}
+
+// DeleteNotificationPreference removes the logged in user's preference for
+// the type named by :type, which then follows the default again.
+func DeleteNotificationPreference(c *gin.Context) {
+	typ, ok := preferenceType(c)
+	if !ok {
+		return
+	}
+	res := database.DB.WithContext(c.Request.Context()).
+		Where("user_id = ? AND type = ?", c.GetUint("user_id"), typ).
+		Delete(&models.NotificationPreference{})
+	if res.Error != nil {
+		utils.JSONError(c, http.StatusInternalServerError, "failed to delete notification preference")
+		return
+	}
+	if res.RowsAffected == 0 {
+		utils.JSONError(c, http.StatusNotFound, "no preference for "+strconv.Quote(typ))
+		return
+	}
+	utils.JSONOK(c, http.StatusOK, gin.H{"message": "notification preference deleted", "type": typ})
+}
+
+// SetWebhook registers the URL the logged in user's webhook notifications are
+// posted to and issues a new signing secret, returned only in this response.
+// Each request body is signed with HMAC-SHA256 in the X-Webhook-Signature
+// header.
+func SetWebhook(c *gin.Context) {
+	var req WebhookRequest
+	if !utils.BindJSONOrAbort(c, &req) {
+		return
+	}
+	url := strings.TrimSpace(req.URL)
+	if err := notify.CheckWebhookURL(url, config.Get().WebhookAllowPrivate); err != nil {
+		utils.JSONError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	user, ok := loadMe(c)
+	if !ok {
+		return
+	}
+	// The secret is kept as is since the service signs with it
+	secret, _, err := utils.NewOpaqueToken()
+	if err != nil {
+		utils.JSONError(c, http.StatusInternalServerError, "failed to generate webhook secret")
+		return
+	}
+	if err := database.DB.WithContext(c.Request.Context()).Model(user).Updates(map[string]interface{}{
+		"webhook_url":    url,
+		"webhook_secret": secret,
+	}).Error; err != nil {
+		utils.JSONError(c, http.StatusInternalServerError, "failed to save webhook")
+		return
+	}
+	utils.JSONOK(c, http.StatusOK, gin.H{
+		"webhook_url":      url,
+		"secret":           secret,
+		"signature_header": notify.SignatureHeader,
+		"message":          "store the secret now; it is not shown again",
+	})
+}
+
+// DeleteWebhook removes the logged in user's webhook. Webhook deliveries
+// still queued fail.
+func DeleteWebhook(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	err := database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"webhook_url":    "",
+			"webhook_secret": "",
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.NotificationDelivery{}).
+			Where("user_id = ? AND channel = ? AND status = ?", userID, models.ChannelWebhook, models.DeliveryPending).
+			Updates(map[string]interface{}{"status": models.DeliveryFailed, "last_error": "webhook removed"}).Error
+	})
+	if err != nil {
+		utils.JSONError(c, http.StatusInternalServerError, "failed to delete webhook")
+		return
+	}
+	utils.JSONOK(c, http.StatusOK, gin.H{"message": "webhook deleted"})
+}
+
+// ListNotificationDeliveries returns the email and webhook deliveries of one
+// of the logged in user's notifications with their status.
+func ListNotificationDeliveries(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		utils.JSONError(c, http.StatusBadRequest, "invalid notification id")
+		return
+	}
+	db := database.DB.WithContext(c.Request.Context())
+	userID := c.GetUint("user_id")
+
+	var notif models.Notification
+	err = db.Select("id").Where("id = ? AND user_id = ?", id, userID).First(&notif).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		utils.JSONError(c, http.StatusNotFound, "notification not found")
+		return
+	} else if err != nil {
+		utils.JSONError(c, http.StatusInternalServerError, "failed to fetch deliveries")
+		return
+	}
+	deliveries := []models.NotificationDelivery{}
+	if err := db.Where("notification_id = ?", notif.ID).Order("id").Find(&deliveries).Error; err != nil {
+		utils.JSONError(c, http.StatusInternalServerError, "failed to fetch deliveries")
+		return
+	}
+	utils.JSONOK(c, http.StatusOK, gin.H{"notification_id": notif.ID, "deliveries": deliveries})
+}
+
+// preferenceType returns the :type parameter, answering 400 unless it is a
+// notification type or "*".
+func preferenceType(c *gin.Context) (string, bool) {
+	typ := c.Param("type")
+	if typ != models.AllNotificationTypes && !slices.Contains(models.NotificationTypes, typ) {
+		utils.JSONError(c, http.StatusBadRequest, "unknown notification type "+strconv.Quote(typ))
+		return "", false
+	}
+	return typ, true
+}
@@ -1,28 +1,441 @@
 package handlers
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"gorm.io/gorm"
 
+	"authservice/config"
 	"authservice/database"
+	"authservice/logging"
+	"authservice/metrics"
 	"authservice/models"
+	"authservice/notify"
 	"authservice/utils"
 )
 
-// GetUnreadNotifications returns unread notifications for the logged-in user.
-func GetUnreadNotifications(c *gin.Context) {
-	v, ok := c.Get("user_id")
-	if !ok {
-		utils.JSONError(c, http.StatusUnauthorized, "missing user context")
+// Notification page sizes.
+const (
+	defaultNotificationLimit = 20
+	maxNotificationLimit     = 100
+)
+
+// maxNotificationBatch is the number of notifications other services may send
+// in one request.
+const maxNotificationBatch = 100
+
+// Outcomes of a notification sent by another service.
+const (
+	notificationCreated   = "created"
+	notificationDuplicate = "duplicate"
+	notificationSkipped   = "skipped"
+)
+
+// InternalNotificationRequest is a notification another service sends to a
+// user. The message is rendered from the template of the type with the fields
+// of the payload, which is stored too. A user gets one notification per
+// dedup_key, so senders can retry safely.
+type InternalNotificationRequest struct {
+	UserID   uint            `json:"user_id" binding:"required"`
+	Type     string          `json:"type" binding:"required"`
+	Payload  json.RawMessage `json:"payload"`
+	DedupKey string          `json:"dedup_key" binding:"required,max=128"`
+}
+
+// InternalNotificationResult reports what became of a sent notification: its
+// ID and whether it was created, a duplicate of an earlier one with the same
+// dedup_key, or skipped because the user does not exist or was deleted.
+type InternalNotificationResult struct {
+	ID     uint   `json:"id,omitempty"`
+	Status string `json:"status"`
+}
+
+// Notification stream settings.
+const (
+	// streamBatchSize is the number of notifications read per query.
+	streamBatchSize = 100
+	// streamRetry is the reconnection delay suggested to clients.
+	streamRetry = 3 * time.Second
+	// streamRecheckDelay is how long a stream woken before the notification's
+	// transaction committed waits before looking again.
+	streamRecheckDelay = 200 * time.Millisecond
+)
+
+// nextCursorHeader carries the before cursor of the next notifications page.
+const nextCursorHeader = "X-Next-Cursor"
+
+// Reasons sent with the end event of a notification stream.
+const (
+	streamEndTokenExpired = "token_expired"
+	streamEndTokenRevoked = "token_revoked"
+	streamEndShutdown     = "shutdown"
+)
+
+// ListNotifications returns the logged-in user's notifications, newest first.
+// Query parameters: status (unread, the default, read or all), type, limit
+// (up to 100) and before, the X-Next-Cursor header of the previous page. The
+// body stays a bare array; the header is missing on the last page.
+func ListNotifications(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultNotificationLimit)))
+	if err != nil || limit < 1 || limit > maxNotificationLimit {
+		utils.JSONError(c, http.StatusBadRequest, "limit must be between 1 and 100")
 		return
 	}
-	userID, _ := v.(uint)
 
-	var notifs []models.Notification
-	if err := database.DB.Where("user_id = ? AND is_read = ?", userID, false).Order("created_at DESC").Find(&notifs).Error; err != nil {
+	query := database.DB.WithContext(c.Request.Context()).Where("user_id = ? AND hidden = ?", c.GetUint("user_id"), false)
+	switch c.DefaultQuery("status", "unread") {
+	case "unread":
+		query = query.Where("is_read = ?", false)
+	case "read":
+		query = query.Where("is_read = ?", true)
+	case "all":
+	default:
+		utils.JSONError(c, http.StatusBadRequest, "status must be unread, read or all")
+		return
+	}
+	if typ := c.Query("type"); typ != "" {
+		query = query.Where("type = ?", typ)
+	}
+	if before := c.Query("before"); before != "" {
+		cursor, err := strconv.ParseUint(before, 10, 64)
+		if err != nil {
+			utils.JSONError(c, http.StatusBadRequest, "invalid before cursor")
+			return
+		}
+		query = query.Where("id < ?", cursor)
+	}
+
+	// One extra row tells whether another page follows
+	notifs := []models.Notification{}
+	if err := query.Order("id DESC").Limit(limit + 1).Find(&notifs).Error; err != nil {
 		utils.JSONError(c, http.StatusInternalServerError, "failed to fetch notifications")
 		return
 	}
-	utils.JSONOK(c, http.StatusOK, gin.H{"notifications": notifs})
+	if len(notifs) > limit {
+		notifs = notifs[:limit]
+		c.Header(nextCursorHeader, strconv.FormatUint(uint64(notifs[limit-1].ID), 10))
+	}
+	utils.JSONOK(c, http.StatusOK, notifs)
+}
+
+// CountUnreadNotifications returns the number of unread notifications of the
+// logged-in user.
+func CountUnreadNotifications(c *gin.Context) {
+	var unread int64
+	if err := database.DB.WithContext(c.Request.Context()).Model(&models.Notification{}).
+		Where("user_id = ? AND hidden = ? AND is_read = ?", c.GetUint("user_id"), false, false).
+		Count(&unread).Error; err != nil {
+		utils.JSONError(c, http.StatusInternalServerError, "failed to count notifications")
+		return
+	}
+	utils.JSONOK(c, http.StatusOK, gin.H{"unread": unread})
+}
+
+// MarkNotificationRead marks one of the logged-in user's notifications as read.
+func MarkNotificationRead(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		utils.JSONError(c, http.StatusBadRequest, "invalid notification id")
+		return
+	}
+	db := database.DB.WithContext(c.Request.Context())
+
+	var notif models.Notification
+	err = db.Where("id = ? AND user_id = ? AND hidden = ?", id, c.GetUint("user_id"), false).First(&notif).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		utils.JSONError(c, http.StatusNotFound, "notification not found")
+		return
+	} else if err != nil {
+		utils.JSONError(c, http.StatusInternalServerError, "failed to update notification")
+		return
+	}
+	if !notif.IsRead {
+		now := time.Now().UTC()
+		if err := db.Model(&notif).Updates(map[string]interface{}{"is_read": true, "read_at": now}).Error; err != nil {
+			utils.JSONError(c, http.StatusInternalServerError, "failed to update notification")
+			return
+		}
+	}
+	utils.JSONOK(c, http.StatusOK, notif)
+}
+
+// MarkAllNotificationsRead marks every unread notification of the logged-in
+// user as read and returns how many there were.
+func MarkAllNotificationsRead(c *gin.Context) {
+	res := database.DB.WithContext(c.Request.Context()).Model(&models.Notification{}).
+		Where("user_id = ? AND hidden = ? AND is_read = ?", c.GetUint("user_id"), false, false).
+		Updates(map[string]interface{}{"is_read": true, "read_at": time.Now().UTC()})
+	if res.Error != nil {
+		utils.JSONError(c, http.StatusInternalServerError, "failed to update notifications")
+		return
+	}
+	utils.JSONOK(c, http.StatusOK, gin.H{"updated": res.RowsAffected})
+}
+
+// StreamNotifications pushes the logged-in user's new notifications as
+// Server-Sent Events. Each one is a "notification" event whose id is the
+// notification ID and whose data is the notification as listed by
+// ListNotifications. A client reconnecting with Last-Event-ID (or the
+// last_event_id query parameter, for the first connection) receives what it
+// missed; otherwise the stream starts with the next notification.
+//
+// A comment line is sent every NOTIFICATION_STREAM_HEARTBEAT to keep the
+// connection open. The stream ends with an "end" event whose data names the
+// reason when the access token expires or is revoked, or the service shuts
+// down; clients reconnect with a fresh token.
+func StreamNotifications(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := logging.FromContext(ctx)
+	userID := c.GetUint("user_id")
+	db := database.DB.WithContext(ctx)
+
+	lastID, ok := streamStart(c, userID)
+	if !ok {
+		return
+	}
+	// The stream ends when the access token it was opened with expires or is revoked
+	jti := c.GetString("jti")
+	issuedAt, expiresAt := time.Now(), time.Now().Add(config.Get().JWTExpiry)
+	if iat, ok := c.Get("token_issued_at"); ok {
+		issuedAt = iat.(time.Time)
+	}
+	if exp, ok := c.Get("token_expires_at"); ok {
+		expiresAt = exp.(time.Time)
+	}
+
+	wake, unsubscribe := notify.Subscribe(userID)
+	defer unsubscribe()
+	metrics.NotificationStreamOpened()
+	defer metrics.NotificationStreamClosed()
+
+	cfg := config.Get()
+	heartbeat := time.NewTicker(cfg.NotificationStreamHeartbeat)
+	defer heartbeat.Stop()
+	poll := time.NewTicker(cfg.NotificationStreamPoll)
+	defer poll.Stop()
+	expired := time.NewTimer(time.Until(expiresAt))
+	defer expired.Stop()
+	var recheck <-chan time.Time
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	fmt.Fprintf(c.Writer, "retry: %d\n\n", streamRetry.Milliseconds())
+
+	send := func() int {
+		n, err := sendNotifications(c, db, userID, &lastID)
+		if err != nil && ctx.Err() == nil {
+			log.Warn("notification stream query failed", "user_id", userID, "error", err)
+		}
+		return n
+	}
+	send()
+	c.Writer.Flush()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case _, ok := <-wake:
+			if !ok {
+				endStream(c, streamEndShutdown)
+				return
+			}
+			if send() == 0 {
+				recheck = time.After(streamRecheckDelay)
+			}
+		case <-recheck:
+			recheck = nil
+			send()
+		case <-poll.C:
+			send()
+		case <-heartbeat.C:
+			revoked, err := database.IsTokenRevoked(ctx, jti, userID, issuedAt)
+			if err != nil && ctx.Err() == nil {
+				log.Warn("notification stream revocation check failed", "user_id", userID, "error", err)
+			}
+			if revoked {
+				endStream(c, streamEndTokenRevoked)
+				return
+			}
+			fmt.Fprint(c.Writer, ": heartbeat\n\n")
+		case <-expired.C:
+			endStream(c, streamEndTokenExpired)
+			return
+		}
+		c.Writer.Flush()
+	}
+}
+
+// streamStart returns the ID after which a notification stream starts: the
+// Last-Event-ID the client sent, or else the user's newest notification.
+func streamStart(c *gin.Context, userID uint) (uint, bool) {
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+	if lastEventID != "" {
+		id, err := strconv.ParseUint(strings.TrimSpace(lastEventID), 10, 64)
+		if err != nil {
+			utils.JSONError(c, http.StatusBadRequest, "invalid Last-Event-ID")
+			return 0, false
+		}
+		return uint(id), true
+	}
+	var newest uint
+	if err := database.DB.WithContext(c.Request.Context()).Model(&models.Notification{}).
+		Where("user_id = ?", userID).Select("COALESCE(MAX(id), 0)").Scan(&newest).Error; err != nil {
+		utils.JSONError(c, http.StatusInternalServerError, "failed to open notification stream")
+		return 0, false
+	}
+	return newest, true
+}
+
+// sendNotifications writes the user's notifications newer than *lastID as
+// events and advances *lastID past them. It returns how many it sent.
+func sendNotifications(c *gin.Context, db *gorm.DB, userID uint, lastID *uint) (int, error) {
+	sent := 0
+	for {
+		var batch []models.Notification
+		if err := db.Where("user_id = ? AND hidden = ? AND id > ?", userID, false, *lastID).
+			Order("id").Limit(streamBatchSize).Find(&batch).Error; err != nil {
+			return sent, err
+		}
+		for i := range batch {
+			data, err := json.Marshal(&batch[i])
+			if err != nil {
+				return sent, err
+			}
+			fmt.Fprintf(c.Writer, "id: %d\nevent: notification\ndata: %s\n\n", batch[i].ID, data)
+			*lastID = batch[i].ID
+			sent++
+		}
+		if len(batch) < streamBatchSize {
+			return sent, nil
+		}
+	}
+}
+
+// endStream sends the end event of a notification stream.
+func endStream(c *gin.Context, reason string) {
+	fmt.Fprintf(c.Writer, "event: end\ndata: {\"reason\":%q}\n\n", reason)
+	c.Writer.Flush()
+}
+
+// CreateInternalNotifications stores notifications sent by other services.
+// The body is one InternalNotificationRequest, answered with its result (201
+// when created), or an array of up to 100, answered with {"results": [...]}
+// in the same order. A batch is validated as a whole and stored in one
+// transaction.
+func CreateInternalNotifications(c *gin.Context) {
+	body, err := c.GetRawData()
+	if err != nil {
+		utils.JSONError(c, http.StatusBadRequest, "failed to read request body")
+		return
+	}
+	batch := bytes.HasPrefix(bytes.TrimSpace(body), []byte("["))
+	var reqs []InternalNotificationRequest
+	if batch {
+		err = binding.JSON.BindBody(body, &reqs)
+	} else {
+		var req InternalNotificationRequest
+		err = binding.JSON.BindBody(body, &req)
+		reqs = append(reqs, req)
+	}
+	if err != nil {
+		utils.JSONError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(reqs) == 0 || len(reqs) > maxNotificationBatch {
+		utils.JSONError(c, http.StatusBadRequest, "send between 1 and 100 notifications")
+		return
+	}
+
+	messages := make([]string, len(reqs))
+	userIDs := make([]uint, len(reqs))
+	for i, req := range reqs {
+		payload := map[string]any{}
+		if len(req.Payload) > 0 {
+			dec := json.NewDecoder(bytes.NewReader(req.Payload))
+			dec.UseNumber()
+			if err := dec.Decode(&payload); err != nil {
+				err = errors.New("payload must be a JSON object")
+				utils.JSONError(c, http.StatusBadRequest, batchItemError(batch, i, err))
+				return
+			}
+		}
+		if messages[i], err = notify.Render(req.Type, payload); err != nil {
+			utils.JSONError(c, http.StatusBadRequest, batchItemError(batch, i, err))
+			return
+		}
+		userIDs[i] = req.UserID
+	}
+
+	db := database.DB.WithContext(c.Request.Context())
+	var existing []uint
+	if err := db.Model(&models.User{}).Where("id IN ? AND deleted_at IS NULL", userIDs).
+		Pluck("id", &existing).Error; err != nil {
+		utils.JSONError(c, http.StatusInternalServerError, "failed to store notifications")
+		return
+	}
+	active := make(map[uint]bool, len(existing))
+	for _, id := range existing {
+		active[id] = true
+	}
+
+	results := make([]InternalNotificationResult, len(reqs))
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for i, req := range reqs {
+			if !active[req.UserID] {
+				results[i] = InternalNotificationResult{Status: notificationSkipped}
+				continue
+			}
+			var payload any
+			if len(req.Payload) > 0 {
+				payload = req.Payload
+			}
+			id, created, err := notify.CreateOnce(tx, req.UserID, req.Type, messages[i], payload, req.DedupKey)
+			if err != nil {
+				return err
+			}
+			results[i] = InternalNotificationResult{ID: id, Status: notificationDuplicate}
+			if created {
+				results[i].Status = notificationCreated
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		utils.JSONError(c, http.StatusInternalServerError, "failed to store notifications")
+		return
+	}
+
+	if batch {
+		utils.JSONOK(c, http.StatusOK, gin.H{"results": results})
+		return
+	}
+	status := http.StatusOK
+	if results[0].Status == notificationCreated {
+		status = http.StatusCreated
+	}
+	utils.JSONOK(c, status, results[0])
+}
+
+// batchItemError prefixes err with the position of the offending notification
+// in a batch.
+func batchItemError(batch bool, i int, err error) string {
+	if !batch {
+		return err.Error()
+	}
+	return fmt.Sprintf("notification %d: %v", i, err)
 }
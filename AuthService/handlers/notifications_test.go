@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"authservice/database"
+	"authservice/models"
+)
+
+func TestListNotificationsPages(t *testing.T) {
+	setupTokens(t)
+	user := createUser(t, "ann@example.com", "password")
+	var ids []uint
+	for i := 0; i < 3; i++ {
+		n := models.Notification{UserID: user.ID, Type: models.NotificationGeneral, Message: "hello " + strconv.Itoa(i)}
+		if err := database.DB.Create(&n).Error; err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, n.ID)
+	}
+
+	list := func(query string) ([]models.Notification, string) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/notifications?"+query, nil)
+		c.Set("user_id", user.ID)
+		ListNotifications(c)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", w.Code, w.Body)
+		}
+		// The body is a bare array
+		var notifs []models.Notification
+		if err := json.Unmarshal(w.Body.Bytes(), &notifs); err != nil {
+			t.Fatalf("decode %s: %v", w.Body, err)
+		}
+		return notifs, w.Header().Get(nextCursorHeader)
+	}
+
+	page, next := list("limit=2")
+	if len(page) != 2 || page[0].ID != ids[2] || page[1].ID != ids[1] {
+		t.Fatalf("first page = %+v", page)
+	}
+	if next != strconv.Itoa(int(ids[1])) {
+		t.Fatalf("%s = %q, want %d", nextCursorHeader, next, ids[1])
+	}
+	page, next = list("limit=2&before=" + next)
+	if len(page) != 1 || page[0].ID != ids[0] {
+		t.Fatalf("last page = %+v", page)
+	}
+	if next != "" {
+		t.Fatalf("%s = %q on the last page", nextCursorHeader, next)
+	}
+}
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"authservice/config"
+	"authservice/database"
+	"authservice/lockout"
+	"authservice/logging"
+	"authservice/mailer"
+	"authservice/models"
+	"authservice/utils"
+)
+
+// forgotPasswordMessage is returned whether or not the email is registered,
+// so the endpoint cannot be used to discover accounts.
+const forgotPasswordMessage = "if the email is registered, a password reset link has been sent"
+
+// resetThrottle is the minimum time between two reset emails to one account.
+const resetThrottle = time.Minute
+
+var errInvalidResetToken = errors.New("invalid or expired reset token")
+
+// ForgotPasswordRequest asks for a password reset email.
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ResetPasswordRequest redeems a reset token for a new password.
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=6"`
+}
+
+// ForgotPassword emails a single-use reset token to a registered address.
+// Earlier unused tokens of the account stop working. The response is the same
+// for unknown addresses.
+func ForgotPassword(c *gin.Context) {
+	var req ForgotPasswordRequest
+	if !utils.BindJSONOrAbort(c, &req) {
+		return
+	}
+	ctx := c.Request.Context()
+	db := database.DB.WithContext(ctx)
+
+	// Deleted accounts keep their row under an anonymized address; never reset those
+	var user models.User
+	err := db.Where("email = ? AND deleted_at IS NULL", strings.ToLower(strings.TrimSpace(req.Email))).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		utils.JSONOK(c, http.StatusAccepted, gin.H{"message": forgotPasswordMessage})
+		return
+	} else if err != nil {
+		utils.JSONError(c, http.StatusInternalServerError, "failed to request password reset")
+		return
+	}
+
+	var recent int64
+	if err := db.Model(&models.PasswordReset{}).
+		Where("user_id = ? AND created_at > ?", user.ID, time.Now().UTC().Add(-resetThrottle)).
+		Count(&recent).Error; err != nil {
+		utils.JSONError(c, http.StatusInternalServerError, "failed to request password reset")
+		return
+	}
+	if recent > 0 {
+		utils.JSONOK(c, http.StatusAccepted, gin.H{"message": forgotPasswordMessage})
+		return
+	}
+
+	token, hash, err := utils.NewOpaqueToken()
+	if err != nil {
+		utils.JSONError(c, http.StatusInternalServerError, "failed to request password reset")
+		return
+	}
+	expiry := config.Get().PasswordResetExpiry
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND used_at IS NULL", user.ID).Delete(&models.PasswordReset{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.PasswordReset{
+			UserID:    user.ID,
+			TokenHash: hash,
+			ExpiresAt: time.Now().UTC().Add(expiry),
+		}).Error
+	})
+	if err != nil {
+		utils.JSONError(c, http.StatusInternalServerError, "failed to request password reset")
+		return
+	}
+
+	// Send in the background so response time does not reveal the account
+	go sendPasswordResetMail(context.WithoutCancel(ctx), user, token, expiry)
+
+	utils.JSONOK(c, http.StatusAccepted, gin.H{"message": forgotPasswordMessage})
+}
+
+// ResetPassword sets a new password using a reset token. The token is spent,
+// every existing session of the user is revoked and a login lock is lifted.
+func ResetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if !utils.BindJSONOrAbort(c, &req) {
+		return
+	}
+
+	passwordHash, err := utils.HashPassword(req.Password)
+	if err != nil {
+		utils.JSONError(c, http.StatusInternalServerError, "failed to hash password")
+		return
+	}
+
+	now := time.Now().UTC()
+	var user models.User
+	err = database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		var reset models.PasswordReset
+		err := tx.Where("token_hash = ?", utils.HashToken(req.Token)).First(&reset).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errInvalidResetToken
+		} else if err != nil {
+			return err
+		}
+
+		// Spend the token only if it is still unused and unexpired
+		res := tx.Model(&models.PasswordReset{}).
+			Where("id = ? AND used_at IS NULL AND expires_at > ?", reset.ID, now).
+			Update("used_at", now)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errInvalidResetToken
+		}
+
+		if err := tx.First(&user, reset.UserID).Error; err != nil {
+			return err
+		}
+		// A token issued before the account was deleted must not revive it
+		if user.Deleted() {
+			return errInvalidResetToken
+		}
+		if err := tx.Model(&user).Update("password_hash", passwordHash).Error; err != nil {
+			return err
+		}
+		if err := revokeUserSessions(tx, reset.UserID, models.RevocationPasswordReset); err != nil {
+			return err
+		}
+		return recordAudit(tx, c, models.AuditPasswordReset, reset.UserID, nil)
+	})
+	if errors.Is(err, errInvalidResetToken) {
+		utils.JSONError(c, http.StatusBadRequest, err.Error())
+		return
+	} else if err != nil {
+		utils.JSONError(c, http.StatusInternalServerError, "failed to reset password")
+		return
+	}
+	// The owner proved control of the address, so a lock no longer protects them
+	if err := lockout.Unlock(c.Request.Context(), &user); err != nil {
+		logging.FromContext(c.Request.Context()).Warn("unlock after password reset failed", "user_id", user.ID, "error", err)
+	}
+	utils.JSONOK(c, http.StatusOK, gin.H{"message": "password has been reset; please log in again"})
+}
+
+// sendPasswordResetMail delivers the reset token, as a link when
+// PASSWORD_RESET_URL is configured. Failures are logged.
+func sendPasswordResetMail(ctx context.Context, user models.User, token string, expiry time.Duration) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	instructions := "Use this token to reset your password: " + token
+	if base := config.Get().PasswordResetURL; base != "" {
+		if u, err := url.Parse(base); err == nil {
+			q := u.Query()
+			q.Set("token", token)
+			u.RawQuery = q.Encode()
+			instructions = "Open this link to reset your password:\n\n" + u.String()
+		}
+	}
+
+	err := mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hello %s,\n\nWe received a request to reset your password. %s\n\n"+
+			"This expires in %s and can be used once. If you did not ask for a reset, ignore this email; "+
+			"your password stays unchanged.\n", user.Name, instructions, expiry),
+	})
+	if err != nil {
+		logging.FromContext(ctx).Error("password reset mail failed", "user_id", user.ID, "error", err)
+	}
+}
@@ -0,0 +1,289 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"authservice/database"
+	"authservice/lockout"
+	"authservice/logging"
+	"authservice/models"
+	"authservice/utils"
+)
+
+// UpdateMeRequest changes the profile of the logged in user. Omitted fields
+// stay as they are.
+type UpdateMeRequest struct {
+	Name      *string `json:"name" binding:"omitempty,min=2,max=100"`
+	GSTNumber *string `json:"gst_number"`
+}
+
+// ChangePasswordRequest replaces the password of the logged in user.
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=6"`
+}
+
+// DeleteMeRequest confirms the deletion of the logged in user's account.
+type DeleteMeRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+// GetMe returns the profile of the logged in user.
+func GetMe(c *gin.Context) {
+	user, ok := loadMe(c)
+	if !ok {
+		return
+	}
+	utils.JSONOK(c, http.StatusOK, profileResponse(user))
+}
+
+// UpdateMe changes the name and, for salers, the GST number of the logged in
+// user. A new GST number has to be approved again when the role requires
+// approval: the account waits for it and its sessions end.
+func UpdateMe(c *gin.Context) {
+	var req UpdateMeRequest
+	if !utils.BindJSONOrAbort(c, &req) {
+		return
+	}
+	user, ok := loadMe(c)
+	if !ok {
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if len(name) < 2 {
+			utils.JSONError(c, http.StatusBadRequest, "name must be at least 2 characters")
+			return
+		}
+		updates["name"] = name
+	}
+	reapprove := false
+	if req.GSTNumber != nil {
+		if user.Role != models.RoleAdmin {
+			utils.JSONError(c, http.StatusBadRequest, "only salers have a gst number")
+			return
+		}
+		gst := strings.TrimSpace(*req.GSTNumber)
+		if gst == "" {
+			utils.JSONError(c, http.StatusBadRequest, "please provide gst number")
+			return
+		}
+		if gst != user.GSTNum {
+			updates["gstnumber"] = gst
+			var role models.Role
+			if err := database.DB.WithContext(c.Request.Context()).Where("name = ?", user.Role).First(&role).Error; err != nil {
+				utils.JSONError(c, http.StatusInternalServerError, "failed to update profile")
+				return
+			}
+			reapprove = role.RequiresApproval
+		}
+	}
+	if len(updates) == 0 {
+		utils.JSONOK(c, http.StatusOK, profileResponse(user))
+		return
+	}
+	if reapprove {
+		updates["is_approved"] = false
+	}
+
+	err := database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Updates(updates).Error; err != nil {
+			return err
+		}
+		if !reapprove {
+			return nil
+		}
+		// Tokens do not carry the approval, so the account is logged out until approved
+		return revokeUserSessions(tx, user.ID, models.RevocationReapproval)
+	})
+	if err != nil {
+		utils.JSONError(c, http.StatusInternalServerError, "failed to update profile")
+		return
+	}
+
+	resp := profileResponse(user)
+	if reapprove {
+		resp["message"] = "gst number changed; your account awaits approval again"
+	}
+	utils.JSONOK(c, http.StatusOK, resp)
+}
+
+// ChangePassword replaces the password of the logged in user after checking
+// the current one. Every session, including the current one, is revoked.
+func ChangePassword(c *gin.Context) {
+	var req ChangePasswordRequest
+	if !utils.BindJSONOrAbort(c, &req) {
+		return
+	}
+	user, ok := loadMe(c)
+	if !ok {
+		return
+	}
+	if !utils.CheckPassword(user.PasswordHash, req.CurrentPassword) {
+		utils.JSONError(c, http.StatusUnauthorized, "invalid current password")
+		return
+	}
+	hash, err := utils.HashPassword(req.NewPassword)
+	if err != nil {
+		utils.JSONError(c, http.StatusInternalServerError, "failed to hash password")
+		return
+	}
+
+	err = database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Update("password_hash", hash).Error; err != nil {
+			return err
+		}
+		if err := revokeUserSessions(tx, user.ID, models.RevocationPasswordChange); err != nil {
+			return err
+		}
+		return recordAudit(tx, c, models.AuditPasswordChanged, user.ID, nil)
+	})
+	if err != nil {
+		utils.JSONError(c, http.StatusInternalServerError, "failed to change password")
+		return
+	}
+	if err := lockout.Unlock(c.Request.Context(), user); err != nil {
+		logging.FromContext(c.Request.Context()).Warn("unlock after password change failed", "user_id", user.ID, "error", err)
+	}
+	utils.JSONOK(c, http.StatusOK, gin.H{"message": "password changed; please log in again"})
+}
+
+// DeleteMe deletes the logged in user's account after checking the password.
+// The user row is anonymized rather than removed, all sessions, two-factor
+// data and notifications go, and a user.deleted event tells ProductService
+// and OrderService to remove the user's products and cancel pending orders.
+func DeleteMe(c *gin.Context) {
+	var req DeleteMeRequest
+	if !utils.BindJSONOrAbort(c, &req) {
+		return
+	}
+	user, ok := loadMe(c)
+	if !ok {
+		return
+	}
+	if user.Role == models.RoleSuperAdmin {
+		utils.JSONError(c, http.StatusForbidden, "the superadmin account cannot be deleted")
+		return
+	}
+	if !utils.CheckPassword(user.PasswordHash, req.Password) {
+		utils.JSONError(c, http.StatusUnauthorized, "invalid password")
+		return
+	}
+
+	email := user.Email
+	err := database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := anonymizeUser(tx, user); err != nil {
+			return err
+		}
+		if err := revokeUserSessions(tx, user.ID, models.RevocationAccountDeleted); err != nil {
+			return err
+		}
+		if err := tx.Create(&models.UserEvent{UserID: user.ID, Type: models.UserEventDeleted}).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, models.AuditUserDeleted, user.ID, nil)
+	})
+	if err != nil {
+		utils.JSONError(c, http.StatusInternalServerError, "failed to delete account")
+		return
+	}
+	if err := lockout.Succeed(c.Request.Context(), email); err != nil {
+		logging.FromContext(c.Request.Context()).Warn("forget failed logins of deleted account", "user_id", user.ID, "error", err)
+	}
+	utils.JSONOK(c, http.StatusOK, gin.H{"message": "account deleted"})
+}
+
+// ListUserEvents serves the user account events to the other services.
+// Callers pass the highest ID they have seen as `after` and get the newer
+// events plus the cursor to use next time.
+func ListUserEvents(c *gin.Context) {
+	after, err := strconv.ParseUint(c.DefaultQuery("after", "0"), 10, 64)
+	if err != nil {
+		utils.JSONError(c, http.StatusBadRequest, "invalid after cursor")
+		return
+	}
+
+	var events []models.UserEvent
+	if err := database.DB.WithContext(c.Request.Context()).
+		Where("id > ?", after).Order("id").Limit(500).Find(&events).Error; err != nil {
+		utils.JSONError(c, http.StatusInternalServerError, "failed to fetch user events")
+		return
+	}
+
+	cursor := uint(after)
+	if len(events) > 0 {
+		cursor = events[len(events)-1].ID
+	}
+	utils.JSONOK(c, http.StatusOK, gin.H{"events": events, "cursor": cursor})
+}
+
+// anonymizeUser replaces the personal data of user and removes the data that
+// belongs only to the account.
+func anonymizeUser(tx *gorm.DB, user *models.User) error {
+	now := time.Now().UTC()
+	if err := tx.Model(user).Updates(map[string]interface{}{
+		"name":                 "Deleted User",
+		"email":                fmt.Sprintf("deleted-%d@deleted.invalid", user.ID),
+		"password_hash":        "",
+		"gstnumber":            "",
+		"is_approved":          false,
+		"locked_until":         nil,
+		"verification_sent_at": nil,
+		"webhook_url":          "",
+		"webhook_secret":       "",
+		"deleted_at":           now,
+	}).Error; err != nil {
+		return err
+	}
+	if err := clearTwoFactor(tx, user.ID); err != nil {
+		return err
+	}
+	for _, model := range []interface{}{
+		&models.LoginChallenge{}, &models.PasswordReset{}, &models.Notification{},
+		&models.NotificationDelivery{}, &models.NotificationPreference{},
+	} {
+		if err := tx.Where("user_id = ?", user.ID).Delete(model).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadMe loads the logged in user, answering 404 when the account is gone.
+func loadMe(c *gin.Context) (*models.User, bool) {
+	var user models.User
+	err := database.DB.WithContext(c.Request.Context()).First(&user, c.GetUint("user_id")).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && user.Deleted()) {
+		utils.JSONError(c, http.StatusNotFound, "user not found")
+		return nil, false
+	} else if err != nil {
+		utils.JSONError(c, http.StatusInternalServerError, "failed to load user")
+		return nil, false
+	}
+	return &user, true
+}
+
+// profileResponse renders the profile of user as returned by the /me endpoints.
+func profileResponse(user *models.User) gin.H {
+	return gin.H{
+		"id":                 user.ID,
+		"name":               user.Name,
+		"email":              user.Email,
+		"role":               user.Role,
+		"gst_number":         user.GSTNum,
+		"is_approved":        user.IsApproved,
+		"email_verified":     user.EmailVerified(),
+		"two_factor_enabled": user.TwoFactorEnabled(),
+		"created_at":         user.CreatedAt,
+	}
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"authservice/database"
+	"authservice/models"
+	"authservice/utils"
+)
+
+// createUser stores an approved user with the given password.
+func createUser(t *testing.T, email, password string) *models.User {
+	t.Helper()
+	hash, err := utils.HashPassword(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := models.User{Name: "Test User", Email: email, PasswordHash: hash, Role: models.RoleUser, IsApproved: true}
+	if err := database.DB.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return &user
+}
+
+func TestAccountChangesAreAudited(t *testing.T) {
+	setupTokens(t)
+	user := createUser(t, "ann@example.com", "old-password")
+
+	steps := []struct {
+		name   string
+		call   func() int
+		action string
+	}{
+		{"change password", func() int {
+			return callAs(t, ChangePassword, user.ID, http.MethodPost, "",
+				ChangePasswordRequest{CurrentPassword: "old-password", NewPassword: "new-password"})
+		}, models.AuditPasswordChanged},
+		{"delete account", func() int {
+			return callAs(t, DeleteMe, user.ID, http.MethodDelete, "", DeleteMeRequest{Password: "new-password"})
+		}, models.AuditUserDeleted},
+	}
+	for _, step := range steps {
+		if status := step.call(); status != http.StatusOK {
+			t.Fatalf("%s: status %d, want 200", step.name, status)
+		}
+		var entry models.AuditEntry
+		if err := database.DB.Where("action = ?", step.action).Last(&entry).Error; err != nil {
+			t.Fatalf("%s: %s not recorded: %v", step.name, step.action, err)
+		}
+		if entry.ActorID != user.ID || entry.TargetUserID != user.ID {
+			t.Errorf("%s: actor %d, target %d; want %d for both", step.name, entry.ActorID, entry.TargetUserID, user.ID)
+		}
+	}
+}
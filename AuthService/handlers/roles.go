@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"authservice/database"
+	"authservice/models"
+	"authservice/utils"
+)
+
+// roleNamePattern restricts role names to short lowercase identifiers.
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{1,19}$`)
+
+// builtinRoles cannot be deleted; the application relies on them.
+var builtinRoles = map[string]bool{
+	models.RoleSuperAdmin: true,
+	models.RoleAdmin:      true,
+	models.RoleUser:       true,
+}
+
+var (
+	errUnknownPermission    = errors.New("unknown permission")
+	errSuperAdminPermission = errors.New("only the superadmin role may hold permission")
+)
+
+// RoleRequest sets the permissions and attributes of a role.
+type RoleRequest struct {
+	Description      string   `json:"description" binding:"max=255"`
+	Permissions      []string `json:"permissions" binding:"required"`
+	RequiresApproval bool     `json:"requires_approval"`
+	SelfRegister     bool     `json:"self_register"`
+}
+
+// CreateRoleRequest creates a role.
+type CreateRoleRequest struct {
+	Name string `json:"name" binding:"required"`
+	RoleRequest
+}
+
+// ListPermissions returns every permission that can be granted.
+func ListPermissions(c *gin.Context) {
+	names := make([]string, 0, len(models.Permissions))
+	for name := range models.Permissions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	permissions := make([]gin.H, 0, len(names))
+	for _, name := range names {
+		permissions = append(permissions, gin.H{"name": name, "description": models.Permissions[name]})
+	}
+	utils.JSONOK(c, http.StatusOK, permissions)
+}
+
+// ListRoles returns all roles with their permissions.
+func ListRoles(c *gin.Context) {
+	var roles []models.Role
+	if err := database.DB.WithContext(c.Request.Context()).Preload("Permissions").
+		Order("name").Find(&roles).Error; err != nil {
+		utils.JSONError(c, http.StatusInternalServerError, "failed to retrieve roles")
+		return
+	}
+	out := make([]gin.H, 0, len(roles))
+	for i := range roles {
+		out = append(out, roleResponse(&roles[i]))
+	}
+	utils.JSONOK(c, http.StatusOK, out)
+}
+
+// CreateRole adds a role, e.g. "support", granting the given permissions.
+func CreateRole(c *gin.Context) {
+	var req CreateRoleRequest
+	if !utils.BindJSONOrAbort(c, &req) {
+		return
+	}
+	if !roleNamePattern.MatchString(req.Name) {
+		utils.JSONError(c, http.StatusBadRequest, "role name must be 2-20 lowercase letters, digits, - or _")
+		return
+	}
+
+	role := models.Role{
+		Name:             req.Name,
+		Description:      req.Description,
+		RequiresApproval: req.RequiresApproval,
+		SelfRegister:     req.SelfRegister,
+	}
+	err := database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&models.Role{}).Where("name = ?", role.Name).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return gorm.ErrDuplicatedKey
+		}
+		if err := tx.Create(&role).Error; err != nil {
+			return err
+		}
+		if err := setRolePermissions(tx, &role, req.Permissions); err != nil {
+			return err
+		}
+		return recordAudit(tx, c, models.AuditRoleCreated, 0, roleAuditDetails(&role))
+	})
+	switch {
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		utils.JSONError(c, http.StatusConflict, "role already exists")
+		return
+	case errors.Is(err, errUnknownPermission), errors.Is(err, errSuperAdminPermission):
+		utils.JSONError(c, http.StatusBadRequest, err.Error())
+		return
+	case err != nil:
+		utils.JSONError(c, http.StatusInternalServerError, "failed to create role")
+		return
+	}
+	utils.JSONOK(c, http.StatusCreated, roleResponse(&role))
+}
+
+// UpdateRole replaces the permissions and attributes of a role. Users pick up
+// the new permissions when they next log in or refresh their access token.
+// The superadmin role always holds every permission and cannot be changed.
+func UpdateRole(c *gin.Context) {
+	name := c.Param("name")
+	if name == models.RoleSuperAdmin {
+		utils.JSONError(c, http.StatusForbidden, "the superadmin role cannot be changed")
+		return
+	}
+	var req RoleRequest
+	if !utils.BindJSONOrAbort(c, &req) {
+		return
+	}
+
+	var role models.Role
+	err := database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Preload("Permissions").Where("name = ?", name).First(&role).Error; err != nil {
+			return err
+		}
+		previous := roleAuditDetails(&role)
+		role.Description = req.Description
+		role.RequiresApproval = req.RequiresApproval
+		role.SelfRegister = req.SelfRegister
+		if err := tx.Omit("Permissions").Save(&role).Error; err != nil {
+			return err
+		}
+		if err := setRolePermissions(tx, &role, req.Permissions); err != nil {
+			return err
+		}
+		return recordAudit(tx, c, models.AuditRoleUpdated, 0, gin.H{
+			"role": role.Name, "from": previous, "to": roleAuditDetails(&role),
+		})
+	})
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		utils.JSONError(c, http.StatusNotFound, "role not found")
+		return
+	case errors.Is(err, errUnknownPermission), errors.Is(err, errSuperAdminPermission):
+		utils.JSONError(c, http.StatusBadRequest, err.Error())
+		return
+	case err != nil:
+		utils.JSONError(c, http.StatusInternalServerError, "failed to update role")
+		return
+	}
+	utils.JSONOK(c, http.StatusOK, roleResponse(&role))
+}
+
+// DeleteRole removes a role that no user holds. Built-in roles stay.
+func DeleteRole(c *gin.Context) {
+	name := c.Param("name")
+	if builtinRoles[name] {
+		utils.JSONError(c, http.StatusForbidden, "built-in roles cannot be deleted")
+		return
+	}
+
+	var holders int64
+	err := database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("role = ?", name).Count(&holders).Error; err != nil {
+			return err
+		}
+		if holders > 0 {
+			return nil
+		}
+		var role models.Role
+		if err := tx.Preload("Permissions").Where("name = ?", name).First(&role).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("role = ?", name).Delete(&models.RolePermission{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("role = ?", name).Delete(&models.TwoFactorPolicy{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("name = ?", name).Delete(&models.Role{}).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, models.AuditRoleDeleted, 0, roleAuditDetails(&role))
+	})
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		utils.JSONError(c, http.StatusNotFound, "role not found")
+		return
+	case err != nil:
+		utils.JSONError(c, http.StatusInternalServerError, "failed to delete role")
+		return
+	case holders > 0:
+		utils.JSONError(c, http.StatusConflict, "role is still assigned to users")
+		return
+	}
+	utils.JSONOK(c, http.StatusOK, gin.H{"message": "role deleted"})
+}
+
+// setRolePermissions replaces the permissions of role with known permissions.
+func setRolePermissions(tx *gorm.DB, role *models.Role, permissions []string) error {
+	role.Permissions = make([]models.RolePermission, 0, len(permissions))
+	seen := map[string]bool{}
+	for _, p := range permissions {
+		if _, ok := models.Permissions[p]; !ok {
+			return fmt.Errorf("%w %q", errUnknownPermission, p)
+		}
+		if models.SuperAdminPermissions[p] && role.Name != models.RoleSuperAdmin {
+			return fmt.Errorf("%w %q", errSuperAdminPermission, p)
+		}
+		if !seen[p] {
+			seen[p] = true
+			role.Permissions = append(role.Permissions, models.RolePermission{Role: role.Name, Permission: p})
+		}
+	}
+	if err := tx.Where("role = ?", role.Name).Delete(&models.RolePermission{}).Error; err != nil {
+		return err
+	}
+	if len(role.Permissions) == 0 {
+		return nil
+	}
+	return tx.Create(&role.Permissions).Error
+}
+
+// roleAuditDetails describes a role in the audit log: what holding it grants.
+func roleAuditDetails(role *models.Role) gin.H {
+	permissions := role.PermissionNames()
+	sort.Strings(permissions)
+	return gin.H{
+		"role":              role.Name,
+		"permissions":       permissions,
+		"requires_approval": role.RequiresApproval,
+		"self_register":     role.SelfRegister,
+	}
+}
+
+// roleResponse renders a role with its permission names.
+func roleResponse(role *models.Role) gin.H {
+	permissions := role.PermissionNames()
+	sort.Strings(permissions)
+	return gin.H{
+		"name":              role.Name,
+		"description":       role.Description,
+		"requires_approval": role.RequiresApproval,
+		"self_register":     role.SelfRegister,
+		"permissions":       permissions,
+		"created_at":        role.CreatedAt,
+		"updated_at":        role.UpdatedAt,
+	}
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"authservice/database"
+	"authservice/models"
+)
+
+// callAs runs handler for a request by actor with an optional JSON body and
+// the :name parameter set.
+func callAs(t *testing.T, handler gin.HandlerFunc, actor uint, method, name string, body interface{}) int {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(method, "/roles/"+name, &buf)
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Params = gin.Params{{Key: "name", Value: name}}
+	c.Set("user_id", actor)
+	handler(c)
+	return w.Code
+}
+
+func TestRoleChangesAreAudited(t *testing.T) {
+	admin := setupTokens(t)
+
+	steps := []struct {
+		handler gin.HandlerFunc
+		method  string
+		body    interface{}
+		status  int
+		action  string
+		check   func(t *testing.T, details map[string]interface{})
+	}{
+		{CreateRole, http.MethodPost, CreateRoleRequest{Name: "support", RoleRequest: RoleRequest{
+			Permissions: []string{models.PermUserRead},
+		}}, http.StatusCreated, models.AuditRoleCreated, func(t *testing.T, d map[string]interface{}) {
+			if d["role"] != "support" || len(d["permissions"].([]interface{})) != 1 {
+				t.Errorf("details = %v", d)
+			}
+		}},
+		{UpdateRole, http.MethodPut, RoleRequest{
+			Permissions: []string{models.PermUserRead, models.PermUserApprove}, SelfRegister: true,
+		}, http.StatusOK, models.AuditRoleUpdated, func(t *testing.T, d map[string]interface{}) {
+			from := d["from"].(map[string]interface{})
+			to := d["to"].(map[string]interface{})
+			if len(from["permissions"].([]interface{})) != 1 || len(to["permissions"].([]interface{})) != 2 ||
+				from["self_register"] != false || to["self_register"] != true {
+				t.Errorf("details = %v, want the old and new permissions and flags", d)
+			}
+		}},
+		{DeleteRole, http.MethodDelete, nil, http.StatusOK, models.AuditRoleDeleted, func(t *testing.T, d map[string]interface{}) {
+			if d["role"] != "support" || len(d["permissions"].([]interface{})) != 2 {
+				t.Errorf("details = %v", d)
+			}
+		}},
+	}
+	for _, step := range steps {
+		if status := callAs(t, step.handler, admin.ID, step.method, "support", step.body); status != step.status {
+			t.Fatalf("%s: status %d, want %d", step.action, status, step.status)
+		}
+		var entry models.AuditEntry
+		if err := database.DB.Where("action = ?", step.action).Last(&entry).Error; err != nil {
+			t.Fatalf("%s not recorded: %v", step.action, err)
+		}
+		if entry.ActorID != admin.ID {
+			t.Errorf("%s: actor %d, want %d", step.action, entry.ActorID, admin.ID)
+		}
+		var details map[string]interface{}
+		if err := json.Unmarshal(entry.Details, &details); err != nil {
+			t.Fatal(err)
+		}
+		step.check(t, details)
+	}
+}
+
+func TestSuperAdminPermissionsCannotBeGranted(t *testing.T) {
+	admin := setupTokens(t)
+	for _, tt := range []struct {
+		handler gin.HandlerFunc
+		method  string
+		name    string
+		body    interface{}
+	}{
+		{CreateRole, http.MethodPost, "auditor", CreateRoleRequest{Name: "auditor", RoleRequest: RoleRequest{
+			Permissions: []string{models.PermAuditRead},
+		}}},
+		{UpdateRole, http.MethodPut, models.RoleAdmin, RoleRequest{Permissions: []string{models.PermAuditRead}}},
+	} {
+		if status := callAs(t, tt.handler, admin.ID, tt.method, tt.name, tt.body); status != http.StatusBadRequest {
+			t.Errorf("granting %s to %s: status %d, want 400", models.PermAuditRead, tt.name, status)
+		}
+	}
+	var holders []string
+	database.DB.Model(&models.RolePermission{}).Where("permission = ?", models.PermAuditRead).Pluck("role", &holders)
+	if len(holders) != 1 || holders[0] != models.RoleSuperAdmin {
+		t.Fatalf("%s held by %v, want superadmin only", models.PermAuditRead, holders)
+	}
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"authservice/config"
+	"authservice/database"
+	"authservice/models"
+	"authservice/utils"
+)
+
+// LogoutRequest optionally carries the refresh token to retire with the session.
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Logout revokes the access token used for the request and, when given, the
+// refresh token family it belongs to.
+func Logout(c *gin.Context) {
+	var req LogoutRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		utils.JSONError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	jti := c.GetString("jti")
+	if jti == "" {
+		utils.JSONError(c, http.StatusBadRequest, "logout requires the access token in the Authorization header")
+		return
+	}
+	userID := c.GetUint("user_id")
+	expiresAt := time.Now().UTC().Add(config.Get().JWTExpiry)
+	if exp, ok := c.Get("token_expires_at"); ok {
+		expiresAt = exp.(time.Time)
+	}
+
+	err := database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&models.TokenRevocation{
+			JTI:       jti,
+			UserID:    userID,
+			ExpiresAt: expiresAt,
+			Reason:    models.RevocationLogout,
+		}).Error; err != nil {
+			return err
+		}
+		if req.RefreshToken == "" {
+			return nil
+		}
+		var stored models.RefreshToken
+		err := tx.Where("token_hash = ? AND user_id = ?", utils.HashToken(req.RefreshToken), userID).First(&stored).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		return revokeTokenFamily(tx, stored.FamilyID)
+	})
+	if err != nil {
+		utils.JSONError(c, http.StatusInternalServerError, "failed to log out")
+		return
+	}
+	utils.JSONOK(c, http.StatusOK, gin.H{"message": "logged out"})
+}
+
+// RevokeUserSessions lets Super Admin end every session of a user: all
+// access tokens issued so far are revoked and all refresh tokens retired.
+func RevokeUserSessions(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		utils.JSONError(c, http.StatusBadRequest, "invalid user id")
+		return
+	}
+	db := database.DB.WithContext(c.Request.Context())
+
+	var user models.User
+	if err := db.First(&user, id).Error; err != nil {
+		utils.JSONError(c, http.StatusNotFound, "user not found")
+		return
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		return revokeUserSessions(tx, user.ID, models.RevocationSessions)
+	})
+	if err != nil {
+		utils.JSONError(c, http.StatusInternalServerError, "failed to revoke sessions")
+		return
+	}
+	utils.JSONOK(c, http.StatusOK, gin.H{"message": "sessions revoked", "user_id": user.ID})
+}
+
+// revokeUserSessions revokes every access token issued to userID so far and
+// retires all of the user's refresh tokens. The cutoff is truncated to the
+// millisecond precision of iat_ms, so tokens issued after this call stay valid.
+func revokeUserSessions(tx *gorm.DB, userID uint, reason string) error {
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	if err := tx.Create(&models.TokenRevocation{
+		UserID:       userID,
+		IssuedBefore: &now,
+		// Tokens issued before now are all expired by then
+		ExpiresAt: now.Add(config.Get().JWTExpiry),
+		Reason:    reason,
+	}).Error; err != nil {
+		return err
+	}
+	return tx.Model(&models.RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", now).Error
+}
+
+// ListRevocations serves the active revocation list to the gateway and the
+// other services. Callers pass the highest ID they have seen as `after` and
+// get the newer entries plus the cursor to use next time.
+func ListRevocations(c *gin.Context) {
+	after, err := strconv.ParseUint(c.DefaultQuery("after", "0"), 10, 64)
+	if err != nil {
+		utils.JSONError(c, http.StatusBadRequest, "invalid after cursor")
+		return
+	}
+
+	var entries []models.TokenRevocation
+	if err := database.DB.WithContext(c.Request.Context()).
+		Where("id > ? AND expires_at > ?", after, time.Now().UTC()).
+		Order("id").Find(&entries).Error; err != nil {
+		utils.JSONError(c, http.StatusInternalServerError, "failed to fetch revocations")
+		return
+	}
+
+	cursor := uint(after)
+	if len(entries) > 0 {
+		cursor = entries[len(entries)-1].ID
+	}
+	utils.JSONOK(c, http.StatusOK, gin.H{"revocations": entries, "cursor": cursor})
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+
+	"authclient/revocation"
+
+	"authservice/database"
+	"authservice/models"
+	"authservice/utils"
+)
+
+func TestRevokeUserSessionsCoversEarlierTokensOnly(t *testing.T) {
+	user := setupTokens(t)
+	before := login(t, user)
+	if err := revokeUserSessions(database.DB, user.ID, models.RevocationSuspended); err != nil {
+		t.Fatal(err)
+	}
+	after := login(t, user)
+
+	for _, tt := range []struct {
+		name  string
+		token string
+		want  bool
+	}{
+		{"issued before", before.AccessToken, true},
+		{"issued after", after.AccessToken, false},
+	} {
+		claims, err := utils.ParseToken(tt.token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Both tokens are usually issued within the same second
+		revoked, err := database.IsTokenRevoked(context.Background(), claims.ID, claims.UserID,
+			revocation.IssuedAt(claims.IssuedAt, claims.IssuedAtMs))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if revoked != tt.want {
+			t.Errorf("token %s: revoked = %v, want %v", tt.name, revoked, tt.want)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"authservice/config"
+	"authservice/database"
+	"authservice/logging"
+	"authservice/metrics"
+	"authservice/models"
+	"authservice/utils"
+)
+
+// errRefreshTokenReused is returned when a refresh token was rotated concurrently.
+var errRefreshTokenReused = errors.New("refresh token reused")
+
+// tokenPair is the access/refresh token pair returned on login and refresh.
+type tokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+// RefreshRequest represents the expected payload for token refresh.
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// issueTokens creates an access token carrying the current permissions of the
+// user's role and stores a new refresh token in the given family.
+func issueTokens(tx *gorm.DB, user *models.User, familyID string) (*tokenPair, error) {
+	c := config.Get()
+	permissions, err := database.RolePermissions(tx, user.Role)
+	if err != nil {
+		return nil, err
+	}
+	access, err := utils.GenerateToken(user.ID, user.Role, permissions, user.EmailVerified())
+	if err != nil {
+		return nil, err
+	}
+	refresh, hash, err := utils.NewOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	rt := models.RefreshToken{
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		TokenHash: hash,
+		ExpiresAt: time.Now().UTC().Add(c.RefreshTokenExpiry),
+	}
+	if err := tx.Create(&rt).Error; err != nil {
+		return nil, err
+	}
+	return &tokenPair{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(c.JWTExpiry.Seconds()),
+	}, nil
+}
+
+// revokeTokenFamily revokes every refresh token of a family that is still active.
+func revokeTokenFamily(tx *gorm.DB, familyID string) error {
+	return tx.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now().UTC()).Error
+}
+
+// RefreshToken exchanges a refresh token for a new access/refresh token pair.
+// Each refresh token is single use: it is marked rotated and replaced by a new
+// token of the same family. Presenting a rotated token again means it leaked,
+// so the whole family is revoked and the user has to log in again.
+func RefreshToken(c *gin.Context) {
+	var req RefreshRequest
+	if !utils.BindJSONOrAbort(c, &req) {
+		return
+	}
+	ctx := c.Request.Context()
+	db := database.DB.WithContext(ctx)
+
+	var stored models.RefreshToken
+	if err := db.Where("token_hash = ?", utils.HashToken(req.RefreshToken)).First(&stored).Error; err != nil {
+		metrics.TokenRefresh(metrics.RefreshInvalid)
+		utils.JSONError(c, http.StatusUnauthorized, "invalid refresh token")
+		return
+	}
+
+	now := time.Now().UTC()
+	switch {
+	case stored.RevokedAt != nil:
+		metrics.TokenRefresh(metrics.RefreshRevoked)
+		utils.JSONError(c, http.StatusUnauthorized, "refresh token revoked")
+		return
+	case stored.RotatedAt != nil:
+		rejectReusedToken(c, db, &stored)
+		return
+	case now.After(stored.ExpiresAt):
+		metrics.TokenRefresh(metrics.RefreshExpired)
+		utils.JSONError(c, http.StatusUnauthorized, "refresh token expired")
+		return
+	}
+
+	var user models.User
+	if err := db.First(&user, stored.UserID).Error; err != nil || user.Deleted() {
+		metrics.TokenRefresh(metrics.RefreshInvalid)
+		utils.JSONError(c, http.StatusUnauthorized, "invalid refresh token")
+		return
+	}
+	if user.Suspended() {
+		metrics.TokenRefresh(metrics.RefreshRevoked)
+		utils.JSONError(c, http.StatusForbidden, "account suspended")
+		return
+	}
+
+	var tokens *tokenPair
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// Only one caller may rotate a token, even under concurrent refreshes
+		res := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND rotated_at IS NULL AND revoked_at IS NULL", stored.ID).
+			Update("rotated_at", now)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errRefreshTokenReused
+		}
+		var err error
+		tokens, err = issueTokens(tx, &user, stored.FamilyID)
+		return err
+	})
+	if errors.Is(err, errRefreshTokenReused) {
+		rejectReusedToken(c, db, &stored)
+		return
+	}
+	if err != nil {
+		metrics.TokenRefresh(metrics.RefreshError)
+		utils.JSONError(c, http.StatusInternalServerError, "failed to refresh token")
+		return
+	}
+
+	metrics.TokenRefresh(metrics.RefreshSuccess)
+	utils.JSONOK(c, http.StatusOK, tokens)
+}
+
+// rejectReusedToken revokes the family of a replayed refresh token and answers 401.
+func rejectReusedToken(c *gin.Context, db *gorm.DB, stored *models.RefreshToken) {
+	metrics.TokenRefresh(metrics.RefreshReused)
+	logging.FromContext(c.Request.Context()).Warn("refresh token reuse detected; revoking token family",
+		"user_id", stored.UserID, "family_id", stored.FamilyID, "client_ip", c.ClientIP())
+	if err := revokeTokenFamily(db, stored.FamilyID); err != nil {
+		logging.FromContext(c.Request.Context()).Error("failed to revoke token family",
+			"family_id", stored.FamilyID, "error", err)
+	}
+	utils.JSONError(c, http.StatusUnauthorized, "refresh token reuse detected; please log in again")
+}
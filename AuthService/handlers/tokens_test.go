@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"authservice/config"
+	"authservice/database"
+	"authservice/models"
+	"authservice/utils"
+)
+
+// setupTokens initialises a fresh database and returns the seeded Super Admin.
+func setupTokens(t *testing.T) *models.User {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	t.Setenv("DB_PATH", filepath.Join(t.TempDir(), "auth.db"))
+	t.Setenv("EMAIL_VERIFICATION_SECRET", "test-secret")
+	t.Setenv("SUPERADMIN_EMAIL", "root@example.com")
+	t.Setenv("SUPERADMIN_PASSWORD", "secret-password")
+	if err := config.Load(); err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	if err := database.InitDatabase(); err != nil {
+		t.Fatalf("init database: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := database.DB.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	var user models.User
+	if err := database.DB.Where("email = ?", "root@example.com").First(&user).Error; err != nil {
+		t.Fatalf("load super admin: %v", err)
+	}
+	return &user
+}
+
+// login issues a token pair for user in a new family.
+func login(t *testing.T, user *models.User) *tokenPair {
+	t.Helper()
+	family, err := utils.NewTokenID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := issueTokens(database.DB, user, family)
+	if err != nil {
+		t.Fatalf("issue tokens: %v", err)
+	}
+	return tokens
+}
+
+// refresh calls RefreshToken with token and returns the status and, on
+// success, the new token pair.
+func refresh(t *testing.T, token string) (int, *tokenPair) {
+	t.Helper()
+	body, _ := json.Marshal(RefreshRequest{RefreshToken: token})
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/token/refresh", bytes.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	RefreshToken(c)
+
+	if w.Code != http.StatusOK {
+		return w.Code, nil
+	}
+	var tokens tokenPair
+	if err := json.Unmarshal(w.Body.Bytes(), &tokens); err != nil {
+		t.Fatalf("decode response %s: %v", w.Body, err)
+	}
+	return w.Code, &tokens
+}
+
+func TestRefreshTokenRotates(t *testing.T) {
+	user := setupTokens(t)
+	first := login(t, user)
+
+	status, second := refresh(t, first.RefreshToken)
+	if status != http.StatusOK {
+		t.Fatalf("refresh = %d, want 200", status)
+	}
+	if second.RefreshToken == first.RefreshToken || second.AccessToken == "" {
+		t.Fatal("refresh did not issue a new token pair")
+	}
+	claims, err := utils.ParseToken(second.AccessToken)
+	if err != nil || claims.UserID != user.ID {
+		t.Fatalf("access token claims = %+v, %v; want user %d", claims, err, user.ID)
+	}
+
+	var tokens []models.RefreshToken
+	database.DB.Where("user_id = ?", user.ID).Order("id").Find(&tokens)
+	if len(tokens) != 2 || tokens[0].FamilyID != tokens[1].FamilyID {
+		t.Fatalf("want two refresh tokens of one family, got %+v", tokens)
+	}
+	if tokens[0].RotatedAt == nil || tokens[1].RotatedAt != nil {
+		t.Fatal("only the presented token should be marked rotated")
+	}
+
+	if status, _ := refresh(t, second.RefreshToken); status != http.StatusOK {
+		t.Fatalf("refresh with the rotated-in token = %d, want 200", status)
+	}
+}
+
+func TestRefreshTokenReuseRevokesFamily(t *testing.T) {
+	user := setupTokens(t)
+	first := login(t, user)
+	other := login(t, user)
+
+	_, second := refresh(t, first.RefreshToken)
+	if status, _ := refresh(t, first.RefreshToken); status != http.StatusUnauthorized {
+		t.Fatalf("replayed refresh = %d, want 401", status)
+	}
+	// The token that replaced the replayed one is revoked with its family
+	if status, _ := refresh(t, second.RefreshToken); status != http.StatusUnauthorized {
+		t.Fatalf("refresh after reuse = %d, want 401", status)
+	}
+	// Other sessions of the user are not affected
+	if status, _ := refresh(t, other.RefreshToken); status != http.StatusOK {
+		t.Fatalf("refresh of another family = %d, want 200", status)
+	}
+}
+
+func TestRefreshTokenRejected(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(user *models.User, token *models.RefreshToken)
+		want   int
+	}{
+		{"expired", func(_ *models.User, rt *models.RefreshToken) {
+			database.DB.Model(rt).Update("expires_at", time.Now().UTC().Add(-time.Minute))
+		}, http.StatusUnauthorized},
+		{"revoked", func(_ *models.User, rt *models.RefreshToken) {
+			database.DB.Model(rt).Update("revoked_at", time.Now().UTC())
+		}, http.StatusUnauthorized},
+		{"suspended user", func(u *models.User, _ *models.RefreshToken) {
+			database.DB.Model(u).Update("suspended_at", time.Now().UTC())
+		}, http.StatusForbidden},
+		{"deleted user", func(u *models.User, _ *models.RefreshToken) {
+			database.DB.Model(u).Update("deleted_at", time.Now().UTC())
+		}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := setupTokens(t)
+			tokens := login(t, user)
+			var rt models.RefreshToken
+			if err := database.DB.Where("token_hash = ?", utils.HashToken(tokens.RefreshToken)).First(&rt).Error; err != nil {
+				t.Fatal(err)
+			}
+			tt.modify(user, &rt)
+			if status, _ := refresh(t, tokens.RefreshToken); status != tt.want {
+				t.Fatalf("refresh = %d, want %d", status, tt.want)
+			}
+		})
+	}
+
+	t.Run("unknown", func(t *testing.T) {
+		setupTokens(t)
+		if status, _ := refresh(t, "not-a-refresh-token"); status != http.StatusUnauthorized {
+			t.Fatalf("refresh = %d, want 401", status)
+		}
+	})
+}
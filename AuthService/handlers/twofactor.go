@@ -0,0 +1,561 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"authservice/config"
+	"authservice/database"
+	"authservice/lockout"
+	"authservice/metrics"
+	"authservice/models"
+	"authservice/utils"
+)
+
+// recoveryCodeCount is the number of recovery codes handed out at a time.
+const recoveryCodeCount = 10
+
+// maxChallengeAttempts is the number of wrong codes after which a login
+// challenge is spent and the user has to enter the password again.
+const maxChallengeAttempts = 5
+
+var (
+	errInvalidChallenge     = errors.New("invalid or expired login challenge")
+	errInvalidTwoFactorCode = errors.New("invalid two-factor code")
+)
+
+// TwoFactorLoginRequest completes a login challenge with a TOTP code or a
+// recovery code.
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code"`
+	RecoveryCode   string `json:"recovery_code"`
+}
+
+// ChallengeRequest identifies a pending login challenge.
+type ChallengeRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+}
+
+// TwoFactorCodeRequest carries a TOTP code or a recovery code.
+type TwoFactorCodeRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// DisableTwoFactorRequest re-authenticates the user before 2FA is turned off.
+type DisableTwoFactorRequest struct {
+	Password     string `json:"password" binding:"required"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// TwoFactorPolicyRequest sets whether a role requires two-factor authentication.
+type TwoFactorPolicyRequest struct {
+	Required *bool `json:"required" binding:"required"`
+}
+
+// LoginTwoFactor completes a login challenge. Enrolled users send a TOTP code
+// or a recovery code; wrong codes count as failed logins of the account. Users whose role requires 2FA but who have not enrolled
+// first call POST /login/2fa/enroll and then confirm here with their first
+// code; they receive their recovery codes with the tokens.
+func LoginTwoFactor(c *gin.Context) {
+	var req TwoFactorLoginRequest
+	if !utils.BindJSONOrAbort(c, &req) {
+		return
+	}
+	db := database.DB.WithContext(c.Request.Context())
+
+	challenge, user, err := loadChallenge(db, req.ChallengeToken)
+	if errors.Is(err, errInvalidChallenge) {
+		utils.JSONError(c, http.StatusUnauthorized, err.Error())
+		return
+	} else if err != nil {
+		utils.JSONError(c, http.StatusInternalServerError, "failed to load login challenge")
+		return
+	}
+	if loginRefused(c, user) {
+		return
+	}
+	if user.Locked(time.Now()) {
+		respondLocked(c, user)
+		return
+	}
+	wait, err := lockout.Wait(c.Request.Context(), user.Email, c.ClientIP())
+	if err != nil {
+		utils.JSONError(c, http.StatusInternalServerError, "failed to check login attempts")
+		return
+	}
+	if wait > 0 {
+		loginAttempt(c, user, user.Email, metrics.LoginThrottled)
+		setRetryAfter(c, wait)
+		utils.JSONError(c, http.StatusTooManyRequests, "too many failed login attempts; try again later")
+		return
+	}
+
+	var recoveryCodes []string
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var ok bool
+		if user.TwoFactorEnabled() {
+			ok, err = verifySecondFactor(tx, user, req.Code, req.RecoveryCode)
+		} else if user.TOTPSecret != "" {
+			// Enrolment during login: the first code confirms the new secret
+			var step int64
+			if step, ok = utils.VerifyTOTP(user.TOTPSecret, req.Code, user.TOTPLastStep, time.Now()); ok {
+				recoveryCodes, err = enableTwoFactor(tx, user, step)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errInvalidTwoFactorCode
+		}
+		res := tx.Model(&models.LoginChallenge{}).
+			Where("id = ? AND used_at IS NULL", challenge.ID).
+			Update("used_at", time.Now().UTC())
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errInvalidChallenge
+		}
+		return nil
+	})
+	switch {
+	case errors.Is(err, errInvalidTwoFactorCode):
+		// Count the attempt against the challenge and the account
+		db.Model(&models.LoginChallenge{}).Where("id = ?", challenge.ID).
+			Update("attempts", gorm.Expr("attempts + 1"))
+		loginFailed(c, user.Email, user, metrics.LoginInvalidTOTP, err.Error())
+		return
+	case errors.Is(err, errInvalidChallenge):
+		utils.JSONError(c, http.StatusUnauthorized, err.Error())
+		return
+	case err != nil:
+		loginAttempt(c, user, user.Email, metrics.LoginError)
+		utils.JSONError(c, http.StatusInternalServerError, "failed to verify two-factor code")
+		return
+	}
+
+	var extra gin.H
+	if recoveryCodes != nil {
+		extra = gin.H{"recovery_codes": recoveryCodes}
+	}
+	completeLogin(c, user, extra)
+}
+
+// EnrollTwoFactorLogin starts TOTP enrolment for a user whose role requires
+// 2FA but who has not enrolled yet, authenticated by the login challenge.
+func EnrollTwoFactorLogin(c *gin.Context) {
+	var req ChallengeRequest
+	if !utils.BindJSONOrAbort(c, &req) {
+		return
+	}
+	db := database.DB.WithContext(c.Request.Context())
+
+	_, user, err := loadChallenge(db, req.ChallengeToken)
+	if errors.Is(err, errInvalidChallenge) {
+		utils.JSONError(c, http.StatusUnauthorized, err.Error())
+		return
+	} else if err != nil {
+		utils.JSONError(c, http.StatusInternalServerError, "failed to load login challenge")
+		return
+	}
+	beginEnrollment(c, db, user)
+}
+
+// EnrollTwoFactor starts TOTP enrolment for the logged in user. It returns
+// the secret and its provisioning URI; 2FA is enabled by ConfirmTwoFactor.
+func EnrollTwoFactor(c *gin.Context) {
+	db := database.DB.WithContext(c.Request.Context())
+	var user models.User
+	if err := db.First(&user, c.GetUint("user_id")).Error; err != nil {
+		utils.JSONError(c, http.StatusNotFound, "user not found")
+		return
+	}
+	beginEnrollment(c, db, &user)
+}
+
+// ConfirmTwoFactor enables 2FA once the user proves the authenticator works
+// by sending its current code, and returns the recovery codes. They are shown
+// only this once.
+func ConfirmTwoFactor(c *gin.Context) {
+	var req TwoFactorCodeRequest
+	if !utils.BindJSONOrAbort(c, &req) {
+		return
+	}
+	db := database.DB.WithContext(c.Request.Context())
+
+	var user models.User
+	if err := db.First(&user, c.GetUint("user_id")).Error; err != nil {
+		utils.JSONError(c, http.StatusNotFound, "user not found")
+		return
+	}
+	if user.TwoFactorEnabled() {
+		utils.JSONError(c, http.StatusConflict, "two-factor authentication already enabled")
+		return
+	}
+	if user.TOTPSecret == "" {
+		utils.JSONError(c, http.StatusBadRequest, "start enrolment with POST /2fa/enroll first")
+		return
+	}
+	step, ok := utils.VerifyTOTP(user.TOTPSecret, req.Code, user.TOTPLastStep, time.Now())
+	if !ok {
+		utils.JSONError(c, http.StatusBadRequest, errInvalidTwoFactorCode.Error())
+		return
+	}
+
+	var codes []string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = enableTwoFactor(tx, &user, step)
+		return err
+	})
+	if err != nil {
+		utils.JSONError(c, http.StatusInternalServerError, "failed to enable two-factor authentication")
+		return
+	}
+	utils.JSONOK(c, http.StatusOK, gin.H{
+		"message":        "two-factor authentication enabled; store the recovery codes safely",
+		"recovery_codes": codes,
+	})
+}
+
+// DisableTwoFactor turns 2FA off after checking the password and a current
+// code. Users whose role requires 2FA cannot turn it off.
+func DisableTwoFactor(c *gin.Context) {
+	var req DisableTwoFactorRequest
+	if !utils.BindJSONOrAbort(c, &req) {
+		return
+	}
+	db := database.DB.WithContext(c.Request.Context())
+
+	var user models.User
+	if err := db.First(&user, c.GetUint("user_id")).Error; err != nil {
+		utils.JSONError(c, http.StatusNotFound, "user not found")
+		return
+	}
+	if !user.TwoFactorEnabled() {
+		utils.JSONError(c, http.StatusConflict, "two-factor authentication is not enabled")
+		return
+	}
+	required, err := twoFactorRequired(db, user.Role)
+	if err != nil {
+		utils.JSONError(c, http.StatusInternalServerError, "failed to check two-factor policy")
+		return
+	}
+	if required {
+		utils.JSONError(c, http.StatusForbidden, "two-factor authentication is required for your role")
+		return
+	}
+	if !utils.CheckPassword(user.PasswordHash, req.Password) {
+		utils.JSONError(c, http.StatusUnauthorized, "invalid password")
+		return
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		ok, err := verifySecondFactor(tx, &user, req.Code, req.RecoveryCode)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errInvalidTwoFactorCode
+		}
+		return clearTwoFactor(tx, user.ID)
+	})
+	if errors.Is(err, errInvalidTwoFactorCode) {
+		utils.JSONError(c, http.StatusUnauthorized, err.Error())
+		return
+	} else if err != nil {
+		utils.JSONError(c, http.StatusInternalServerError, "failed to disable two-factor authentication")
+		return
+	}
+	utils.JSONOK(c, http.StatusOK, gin.H{"message": "two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes of the logged in user
+// after checking a current TOTP code.
+func RegenerateRecoveryCodes(c *gin.Context) {
+	var req TwoFactorCodeRequest
+	if !utils.BindJSONOrAbort(c, &req) {
+		return
+	}
+	db := database.DB.WithContext(c.Request.Context())
+
+	var user models.User
+	if err := db.First(&user, c.GetUint("user_id")).Error; err != nil {
+		utils.JSONError(c, http.StatusNotFound, "user not found")
+		return
+	}
+	if !user.TwoFactorEnabled() {
+		utils.JSONError(c, http.StatusConflict, "two-factor authentication is not enabled")
+		return
+	}
+
+	var codes []string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		ok, err := verifySecondFactor(tx, &user, req.Code, "")
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errInvalidTwoFactorCode
+		}
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if errors.Is(err, errInvalidTwoFactorCode) {
+		utils.JSONError(c, http.StatusUnauthorized, err.Error())
+		return
+	} else if err != nil {
+		utils.JSONError(c, http.StatusInternalServerError, "failed to regenerate recovery codes")
+		return
+	}
+	utils.JSONOK(c, http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// ResetUserTwoFactor lets Super Admin remove the 2FA enrolment of a user who
+// lost both the authenticator and the recovery codes. The user's sessions are
+// revoked; if the role requires 2FA, the user enrols again at the next login.
+func ResetUserTwoFactor(c *gin.Context) {
+	user, ok := loadTargetUser(c)
+	if !ok {
+		return
+	}
+	err := database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := clearTwoFactor(tx, user.ID); err != nil {
+			return err
+		}
+		if err := revokeUserSessions(tx, user.ID, models.RevocationTwoFactorReset); err != nil {
+			return err
+		}
+		return recordAudit(tx, c, models.AuditUserTwoFactorReset, user.ID, nil)
+	})
+	if err != nil {
+		utils.JSONError(c, http.StatusInternalServerError, "failed to reset two-factor authentication")
+		return
+	}
+	utils.JSONOK(c, http.StatusOK, gin.H{"message": "two-factor authentication reset", "user_id": user.ID})
+}
+
+// GetTwoFactorPolicies lists for every role whether it requires 2FA.
+func GetTwoFactorPolicies(c *gin.Context) {
+	var stored []models.TwoFactorPolicy
+	if err := database.DB.WithContext(c.Request.Context()).Find(&stored).Error; err != nil {
+		utils.JSONError(c, http.StatusInternalServerError, "failed to retrieve two-factor policies")
+		return
+	}
+	var roles []string
+	if err := database.DB.WithContext(c.Request.Context()).Model(&models.Role{}).
+		Order("name").Pluck("name", &roles).Error; err != nil {
+		utils.JSONError(c, http.StatusInternalServerError, "failed to retrieve two-factor policies")
+		return
+	}
+	byRole := map[string]models.TwoFactorPolicy{}
+	for _, p := range stored {
+		byRole[p.Role] = p
+	}
+	policies := make([]models.TwoFactorPolicy, 0, len(roles))
+	for _, role := range roles {
+		p, ok := byRole[role]
+		if !ok {
+			p = models.TwoFactorPolicy{Role: role}
+		}
+		policies = append(policies, p)
+	}
+	utils.JSONOK(c, http.StatusOK, policies)
+}
+
+// SetTwoFactorPolicy lets Super Admin require (or stop requiring) 2FA for a
+// role. Affected users without 2FA enrol at their next login.
+func SetTwoFactorPolicy(c *gin.Context) {
+	role := c.Param("role")
+	var count int64
+	if err := database.DB.WithContext(c.Request.Context()).Model(&models.Role{}).
+		Where("name = ?", role).Count(&count).Error; err != nil {
+		utils.JSONError(c, http.StatusInternalServerError, "failed to update two-factor policy")
+		return
+	}
+	if count == 0 {
+		utils.JSONError(c, http.StatusBadRequest, "unknown role")
+		return
+	}
+	var req TwoFactorPolicyRequest
+	if !utils.BindJSONOrAbort(c, &req) {
+		return
+	}
+
+	policy := models.TwoFactorPolicy{Role: role, Required: *req.Required, UpdatedBy: c.GetUint("user_id")}
+	err := database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		previous, err := twoFactorRequired(tx, role)
+		if err != nil {
+			return err
+		}
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "role"}},
+			DoUpdates: clause.AssignmentColumns([]string{"required", "updated_by", "updated_at"}),
+		}).Create(&policy).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, models.AuditTwoFactorPolicySet, 0,
+			gin.H{"role": role, "from": previous, "to": policy.Required})
+	})
+	if err != nil {
+		utils.JSONError(c, http.StatusInternalServerError, "failed to update two-factor policy")
+		return
+	}
+	utils.JSONOK(c, http.StatusOK, policy)
+}
+
+// startLoginChallenge answers a correct password with a challenge token that
+// POST /login/2fa exchanges for the tokens.
+func startLoginChallenge(c *gin.Context, user *models.User) {
+	token, hash, err := utils.NewOpaqueToken()
+	if err != nil {
+		loginAttempt(c, user, user.Email, metrics.LoginError)
+		utils.JSONError(c, http.StatusInternalServerError, "failed to start two-factor login")
+		return
+	}
+	expiry := config.Get().LoginChallengeExpiry
+	if err := database.DB.WithContext(c.Request.Context()).Create(&models.LoginChallenge{
+		UserID:    user.ID,
+		TokenHash: hash,
+		ExpiresAt: time.Now().UTC().Add(expiry),
+	}).Error; err != nil {
+		loginAttempt(c, user, user.Email, metrics.LoginError)
+		utils.JSONError(c, http.StatusInternalServerError, "failed to start two-factor login")
+		return
+	}
+	loginAttempt(c, user, user.Email, metrics.LoginChallenged)
+
+	utils.JSONOK(c, http.StatusOK, gin.H{
+		"two_factor_required": true,
+		"enrollment_required": !user.TwoFactorEnabled(),
+		"challenge_token":     token,
+		"expires_in":          int(expiry.Seconds()),
+	})
+}
+
+// loadChallenge returns the pending challenge for token and its user.
+func loadChallenge(db *gorm.DB, token string) (*models.LoginChallenge, *models.User, error) {
+	var challenge models.LoginChallenge
+	err := db.Where("token_hash = ? AND used_at IS NULL AND expires_at > ? AND attempts < ?",
+		utils.HashToken(token), time.Now().UTC(), maxChallengeAttempts).First(&challenge).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, errInvalidChallenge
+	} else if err != nil {
+		return nil, nil, err
+	}
+	var user models.User
+	err = db.First(&user, challenge.UserID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && user.Deleted()) {
+		return nil, nil, errInvalidChallenge
+	} else if err != nil {
+		return nil, nil, err
+	}
+	return &challenge, &user, nil
+}
+
+// beginEnrollment stores a new, not yet enabled TOTP secret for user and
+// returns it with its provisioning URI.
+func beginEnrollment(c *gin.Context, db *gorm.DB, user *models.User) {
+	if user.TwoFactorEnabled() {
+		utils.JSONError(c, http.StatusConflict, "two-factor authentication already enabled")
+		return
+	}
+	secret, err := utils.NewTOTPSecret()
+	if err != nil {
+		utils.JSONError(c, http.StatusInternalServerError, "failed to generate secret")
+		return
+	}
+	if err := db.Model(user).Update("totp_secret", secret).Error; err != nil {
+		utils.JSONError(c, http.StatusInternalServerError, "failed to start enrolment")
+		return
+	}
+	utils.JSONOK(c, http.StatusOK, gin.H{
+		"secret":      secret,
+		"otpauth_uri": utils.TOTPProvisioningURI(config.Get().TOTPIssuer, user.Email, secret),
+	})
+}
+
+// verifySecondFactor checks a TOTP code, or else a recovery code, of an
+// enrolled user and consumes it so it cannot be used again.
+func verifySecondFactor(tx *gorm.DB, user *models.User, code, recoveryCode string) (bool, error) {
+	if code != "" {
+		step, ok := utils.VerifyTOTP(user.TOTPSecret, code, user.TOTPLastStep, time.Now())
+		if !ok {
+			return false, nil
+		}
+		res := tx.Model(&models.User{}).
+			Where("id = ? AND totp_last_step < ?", user.ID, step).
+			Update("totp_last_step", step)
+		return res.RowsAffected == 1, res.Error
+	}
+	if recoveryCode != "" {
+		res := tx.Model(&models.RecoveryCode{}).
+			Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, utils.HashRecoveryCode(recoveryCode)).
+			Update("used_at", time.Now().UTC())
+		return res.RowsAffected == 1, res.Error
+	}
+	return false, nil
+}
+
+// enableTwoFactor marks the user's pending secret as confirmed at step and
+// issues fresh recovery codes.
+func enableTwoFactor(tx *gorm.DB, user *models.User, step int64) ([]string, error) {
+	now := time.Now().UTC()
+	if err := tx.Model(user).Updates(map[string]interface{}{
+		"totp_enabled_at": now,
+		"totp_last_step":  step,
+	}).Error; err != nil {
+		return nil, err
+	}
+	return replaceRecoveryCodes(tx, user.ID)
+}
+
+// replaceRecoveryCodes deletes the user's recovery codes and stores new ones.
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+	codes, hashes, err := utils.NewRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]models.RecoveryCode, len(hashes))
+	for i, h := range hashes {
+		rows[i] = models.RecoveryCode{UserID: userID, CodeHash: h}
+	}
+	if err := tx.Create(&rows).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// clearTwoFactor removes the TOTP secret and recovery codes of a user.
+func clearTwoFactor(tx *gorm.DB, userID uint) error {
+	if err := tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"totp_secret":     "",
+		"totp_enabled_at": nil,
+		"totp_last_step":  0,
+	}).Error; err != nil {
+		return err
+	}
+	return tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error
+}
+
+// twoFactorRequired reports whether the policy requires 2FA for role.
+func twoFactorRequired(db *gorm.DB, role string) (bool, error) {
+	var policy models.TwoFactorPolicy
+	err := db.Where("role = ?", role).First(&policy).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	return policy.Required, err
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"authservice/database"
+	"authservice/models"
+	"authservice/utils"
+)
+
+// twoFactorChallenge enrols user in 2FA and returns a pending login challenge
+// token and a recovery code that completes it.
+func twoFactorChallenge(t *testing.T, user *models.User) (token, code string) {
+	t.Helper()
+	now := time.Now().UTC()
+	if err := database.DB.Model(user).Updates(map[string]interface{}{
+		"totp_secret": "JBSWY3DPEHPK3PXP", "totp_enabled_at": now,
+	}).Error; err != nil {
+		t.Fatal(err)
+	}
+	codes, hashes, err := utils.NewRecoveryCodes(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.DB.Create(&models.RecoveryCode{UserID: user.ID, CodeHash: hashes[0]}).Error; err != nil {
+		t.Fatal(err)
+	}
+	token, hash, err := utils.NewOpaqueToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.DB.Create(&models.LoginChallenge{
+		UserID: user.ID, TokenHash: hash, ExpiresAt: now.Add(time.Minute),
+	}).Error; err != nil {
+		t.Fatal(err)
+	}
+	return token, codes[0]
+}
+
+func TestLoginTwoFactorRechecksAccount(t *testing.T) {
+	setupTokens(t)
+
+	tests := []struct {
+		name   string
+		change map[string]interface{}
+		want   int
+	}{
+		{"active", nil, http.StatusOK},
+		{"suspended", map[string]interface{}{"suspended_at": time.Now().UTC()}, http.StatusForbidden},
+		{"rejected", map[string]interface{}{"rejected_at": time.Now().UTC()}, http.StatusForbidden},
+		{"not approved", map[string]interface{}{"is_approved": false}, http.StatusForbidden},
+		{"deleted", map[string]interface{}{"deleted_at": time.Now().UTC()}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := createUser(t, tt.name+"@example.com", "password")
+			token, code := twoFactorChallenge(t, user)
+			// The account changes between the password step and the code
+			if tt.change != nil {
+				if err := database.DB.Model(user).Updates(tt.change).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			body, _ := json.Marshal(TwoFactorLoginRequest{ChallengeToken: token, RecoveryCode: code})
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/login/2fa", bytes.NewReader(body))
+			c.Request.Header.Set("Content-Type", "application/json")
+			LoginTwoFactor(c)
+
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			var families int64
+			database.DB.Model(&models.RefreshToken{}).Where("user_id = ?", user.ID).Count(&families)
+			if issued := families > 0; issued != (tt.want == http.StatusOK) {
+				t.Errorf("refresh tokens issued = %v", issued)
+			}
+		})
+	}
+}
+
+func TestTwoFactorPolicyChangesAreAudited(t *testing.T) {
+	admin := setupTokens(t)
+
+	for _, required := range []bool{true, false} {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		body, _ := json.Marshal(TwoFactorPolicyRequest{Required: &required})
+		c.Request = httptest.NewRequest(http.MethodPut, "/2fa/policies/"+models.RoleUser, bytes.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Params = gin.Params{{Key: "role", Value: models.RoleUser}}
+		c.Set("user_id", admin.ID)
+		SetTwoFactorPolicy(c)
+		if w.Code != http.StatusOK {
+			t.Fatalf("set required=%v: status %d: %s", required, w.Code, w.Body)
+		}
+	}
+
+	var entries []models.AuditEntry
+	if err := database.DB.Where("action = ?", models.AuditTwoFactorPolicySet).Order("id").Find(&entries).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d audit entries, want 2", len(entries))
+	}
+	for i, want := range []string{
+		`{"from":false,"role":"user","to":true}`,
+		`{"from":true,"role":"user","to":false}`,
+	} {
+		if entries[i].ActorID != admin.ID || string(entries[i].Details) != want {
+			t.Errorf("entry %d = actor %d %s, want actor %d %s", i, entries[i].ActorID, entries[i].Details, admin.ID, want)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"authservice/database"
+	"authservice/models"
+	"authservice/notify"
+	"authservice/utils"
+)
+
+// User listing page sizes.
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// userStatusFilters maps the status filter of ListUsers to its condition.
+var userStatusFilters = map[string]string{
+	"active":     "deleted_at IS NULL AND suspended_at IS NULL AND is_approved = true",
+	"pending":    "deleted_at IS NULL AND is_approved = false AND rejected_at IS NULL",
+	"rejected":   "deleted_at IS NULL AND rejected_at IS NOT NULL",
+	"suspended":  "deleted_at IS NULL AND suspended_at IS NOT NULL",
+	"unverified": "deleted_at IS NULL AND email_verified_at IS NULL",
+	"deleted":    "deleted_at IS NOT NULL",
+}
+
+// ReasonRequest carries the reason of an administrative action, shown to the user.
+type ReasonRequest struct {
+	Reason string `json:"reason" binding:"required,max=255"`
+}
+
+// ChangeRoleRequest assigns a role to a user.
+type ChangeRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// ListUsers returns one page of users, newest first. Query parameters:
+// q (part of name or email), role, status (active, pending, rejected,
+// suspended, unverified or deleted), page (from 1) and page_size (up to 100).
+// Deleted accounts are only listed when asked for.
+func ListUsers(c *gin.Context) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		utils.JSONError(c, http.StatusBadRequest, "invalid page")
+		return
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("page_size", strconv.Itoa(defaultPageSize)))
+	if err != nil || pageSize < 1 || pageSize > maxPageSize {
+		utils.JSONError(c, http.StatusBadRequest, "page_size must be between 1 and 100")
+		return
+	}
+
+	query := database.DB.WithContext(c.Request.Context()).Model(&models.User{})
+	if status := c.Query("status"); status != "" {
+		cond, ok := userStatusFilters[status]
+		if !ok {
+			utils.JSONError(c, http.StatusBadRequest, "unknown status "+strconv.Quote(status))
+			return
+		}
+		query = query.Where(cond)
+	} else {
+		query = query.Where("deleted_at IS NULL")
+	}
+	if role := c.Query("role"); role != "" {
+		query = query.Where("role = ?", role)
+	}
+	if q := strings.ToLower(strings.TrimSpace(c.Query("q"))); q != "" {
+		pattern := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(q) + "%"
+		query = query.Where(`(LOWER(name) LIKE ? ESCAPE '\' OR email LIKE ? ESCAPE '\')`, pattern, pattern)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		utils.JSONError(c, http.StatusInternalServerError, "failed to retrieve users")
+		return
+	}
+	users := []models.User{}
+	if err := query.Order("created_at DESC, id DESC").
+		Offset((page - 1) * pageSize).Limit(pageSize).Find(&users).Error; err != nil {
+		utils.JSONError(c, http.StatusInternalServerError, "failed to retrieve users")
+		return
+	}
+	utils.JSONOK(c, http.StatusOK, gin.H{
+		"users":     users,
+		"page":      page,
+		"page_size": pageSize,
+		"total":     total,
+	})
+}
+
+// SuspendUser suspends an account: it cannot log in or refresh tokens and
+// every session is revoked, so its access tokens are rejected everywhere.
+// The user is notified with the reason.
+func SuspendUser(c *gin.Context) {
+	var req ReasonRequest
+	if !utils.BindJSONOrAbort(c, &req) {
+		return
+	}
+	user, ok := loadTargetUser(c)
+	if !ok {
+		return
+	}
+	if user.Suspended() {
+		utils.JSONError(c, http.StatusConflict, "user is already suspended")
+		return
+	}
+
+	reason := strings.TrimSpace(req.Reason)
+	err := database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Updates(map[string]interface{}{
+			"suspended_at":      time.Now().UTC(),
+			"suspension_reason": reason,
+		}).Error; err != nil {
+			return err
+		}
+		if err := revokeUserSessions(tx, user.ID, models.RevocationSuspended); err != nil {
+			return err
+		}
+		if err := notify.Create(tx, user.ID, models.NotificationAccountSuspended,
+			"Your account has been suspended: "+reason, gin.H{"reason": reason}); err != nil {
+			return err
+		}
+		return recordAudit(tx, c, models.AuditUserSuspended, user.ID, gin.H{"reason": reason})
+	})
+	if err != nil {
+		utils.JSONError(c, http.StatusInternalServerError, "failed to suspend user")
+		return
+	}
+	utils.JSONOK(c, http.StatusOK, gin.H{"message": "user suspended", "user_id": user.ID})
+}
+
+// ReactivateUser lifts the suspension of an account and notifies the user.
+func ReactivateUser(c *gin.Context) {
+	user, ok := loadTargetUser(c)
+	if !ok {
+		return
+	}
+	if !user.Suspended() {
+		utils.JSONError(c, http.StatusConflict, "user is not suspended")
+		return
+	}
+
+	err := database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Updates(map[string]interface{}{
+			"suspended_at":      nil,
+			"suspension_reason": "",
+		}).Error; err != nil {
+			return err
+		}
+		if err := notify.Create(tx, user.ID, models.NotificationAccountReactivated,
+			"Your account has been reactivated", nil); err != nil {
+			return err
+		}
+		return recordAudit(tx, c, models.AuditUserReactivated, user.ID, nil)
+	})
+	if err != nil {
+		utils.JSONError(c, http.StatusInternalServerError, "failed to reactivate user")
+		return
+	}
+	utils.JSONOK(c, http.StatusOK, gin.H{"message": "user reactivated", "user_id": user.ID})
+}
+
+// ChangeUserRole assigns another role to a user. Accounts given a role that
+// requires approval count as approved. The user's sessions are revoked so the
+// permissions of the new role apply right away. The superadmin role can be
+// neither assigned nor taken away.
+func ChangeUserRole(c *gin.Context) {
+	var req ChangeRoleRequest
+	if !utils.BindJSONOrAbort(c, &req) {
+		return
+	}
+	user, ok := loadTargetUser(c)
+	if !ok {
+		return
+	}
+	if req.Role == models.RoleSuperAdmin {
+		utils.JSONError(c, http.StatusForbidden, "the superadmin role cannot be assigned")
+		return
+	}
+	if req.Role == user.Role {
+		utils.JSONError(c, http.StatusConflict, "user already has role "+user.Role)
+		return
+	}
+
+	previous := user.Role
+	err := database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		var role models.Role
+		if err := tx.Where("name = ?", req.Role).First(&role).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(user).Updates(map[string]interface{}{
+			"role":             role.Name,
+			"is_approved":      true,
+			"rejected_at":      nil,
+			"rejection_reason": "",
+		}).Error; err != nil {
+			return err
+		}
+		if err := revokeUserSessions(tx, user.ID, models.RevocationRoleChanged); err != nil {
+			return err
+		}
+		if err := notify.Create(tx, user.ID, models.NotificationRoleChanged,
+			"Your role has been changed to "+role.Name+"; please log in again", gin.H{"role": role.Name}); err != nil {
+			return err
+		}
+		return recordAudit(tx, c, models.AuditUserRoleChanged, user.ID, gin.H{"from": previous, "to": role.Name})
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		utils.JSONError(c, http.StatusBadRequest, "unknown role")
+		return
+	} else if err != nil {
+		utils.JSONError(c, http.StatusInternalServerError, "failed to change role")
+		return
+	}
+	utils.JSONOK(c, http.StatusOK, gin.H{"message": "role changed", "user_id": user.ID, "role": user.Role})
+}
+
+// loadTargetUser loads the user named by the :id parameter for an
+// administrative action. Deleted accounts are not found; the acting user and
+// superadmins cannot be targeted.
+func loadTargetUser(c *gin.Context) (*models.User, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		utils.JSONError(c, http.StatusBadRequest, "invalid user id")
+		return nil, false
+	}
+	var user models.User
+	err = database.DB.WithContext(c.Request.Context()).First(&user, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && user.Deleted()) {
+		utils.JSONError(c, http.StatusNotFound, "user not found")
+		return nil, false
+	} else if err != nil {
+		utils.JSONError(c, http.StatusInternalServerError, "failed to load user")
+		return nil, false
+	}
+	if user.ID == c.GetUint("user_id") {
+		utils.JSONError(c, http.StatusForbidden, "cannot change your own account")
+		return nil, false
+	}
+	if user.Role == models.RoleSuperAdmin {
+		utils.JSONError(c, http.StatusForbidden, "superadmin accounts cannot be changed")
+		return nil, false
+	}
+	return &user, true
+}
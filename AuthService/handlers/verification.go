@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"authservice/config"
+	"authservice/database"
+	"authservice/logging"
+	"authservice/mailer"
+	"authservice/models"
+	"authservice/utils"
+)
+
+// VerifyEmailRequest carries a verification token in a JSON body; links use
+// the token query parameter instead.
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// VerifyEmail marks the address a verification token was issued for as
+// verified. It accepts the token from the link (GET ?token=) or a JSON body.
+// Access tokens carry the verification status, so clients refresh afterwards.
+func VerifyEmail(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" && c.Request.Method == http.MethodPost {
+		var req VerifyEmailRequest
+		if !utils.BindJSONOrAbort(c, &req) {
+			return
+		}
+		token = req.Token
+	}
+
+	userID, email, err := utils.ParseEmailVerification(token)
+	if err != nil {
+		utils.JSONError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	db := database.DB.WithContext(c.Request.Context())
+
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil || user.Email != email {
+		// Deleted user or changed address
+		utils.JSONError(c, http.StatusBadRequest, utils.ErrInvalidVerificationToken.Error())
+		return
+	}
+	if user.EmailVerified() {
+		utils.JSONOK(c, http.StatusOK, gin.H{"message": "email already verified"})
+		return
+	}
+	if err := db.Model(&user).Update("email_verified_at", time.Now().UTC()).Error; err != nil {
+		utils.JSONError(c, http.StatusInternalServerError, "failed to verify email")
+		return
+	}
+	utils.JSONOK(c, http.StatusOK, gin.H{"message": "email verified; refresh your access token to apply it"})
+}
+
+// ResendVerification sends a new verification email to the logged in user,
+// at most once per EMAIL_VERIFICATION_RESEND_INTERVAL.
+func ResendVerification(c *gin.Context) {
+	db := database.DB.WithContext(c.Request.Context())
+
+	var user models.User
+	if err := db.First(&user, c.GetUint("user_id")).Error; err != nil {
+		utils.JSONError(c, http.StatusNotFound, "user not found")
+		return
+	}
+	if user.EmailVerified() {
+		utils.JSONError(c, http.StatusConflict, "email already verified")
+		return
+	}
+
+	// Claim the send slot atomically so concurrent requests cannot both send
+	interval := config.Get().EmailVerificationResendInterval
+	now := time.Now().UTC()
+	res := db.Model(&models.User{}).
+		Where("id = ? AND (verification_sent_at IS NULL OR verification_sent_at <= ?)", user.ID, now.Add(-interval)).
+		Update("verification_sent_at", now)
+	if res.Error != nil {
+		utils.JSONError(c, http.StatusInternalServerError, "failed to resend verification email")
+		return
+	}
+	if res.RowsAffected == 0 {
+		wait := interval
+		if user.VerificationSentAt != nil {
+			wait = time.Until(user.VerificationSentAt.Add(interval))
+		}
+		setRetryAfter(c, wait)
+		utils.JSONError(c, http.StatusTooManyRequests, "verification email sent recently; try again later")
+		return
+	}
+
+	go sendVerificationMail(context.WithoutCancel(c.Request.Context()), user)
+	utils.JSONOK(c, http.StatusAccepted, gin.H{"message": "verification email sent"})
+}
+
+// ListUnverifiedUsers lets Super Admin review accounts whose email address
+// has not been verified yet, oldest first.
+func ListUnverifiedUsers(c *gin.Context) {
+	var users []models.User
+	if err := database.DB.WithContext(c.Request.Context()).
+		Where("email_verified_at IS NULL AND deleted_at IS NULL").
+		Order("created_at").Find(&users).Error; err != nil {
+		utils.JSONError(c, http.StatusInternalServerError, "failed to retrieve unverified users")
+		return
+	}
+	utils.JSONOK(c, http.StatusOK, users)
+}
+
+// sendVerificationMail delivers a signed verification token, as a link when
+// EMAIL_VERIFICATION_URL is configured. Failures are logged.
+func sendVerificationMail(ctx context.Context, user models.User) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	log := logging.FromContext(ctx)
+
+	token, err := utils.SignEmailVerification(user.ID, user.Email)
+	if err != nil {
+		log.Error("sign verification token failed", "user_id", user.ID, "error", err)
+		return
+	}
+	c := config.Get()
+	instructions := "Use this token to verify your email address: " + token
+	if base := c.EmailVerificationURL; base != "" {
+		if u, err := url.Parse(base); err == nil {
+			q := u.Query()
+			q.Set("token", token)
+			u.RawQuery = q.Encode()
+			instructions = "Open this link to verify your email address:\n\n" + u.String()
+		}
+	}
+
+	err = mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hello %s,\n\nThanks for registering. %s\n\n"+
+			"The link expires in %s. Until your address is verified you cannot place orders or list products.\n",
+			user.Name, instructions, c.EmailVerificationExpiry),
+	})
+	if err != nil {
+		log.Error("verification mail failed", "user_id", user.ID, "error", err)
+	}
+}
@@ -0,0 +1,367 @@
+// Package keys manages the asymmetric keys that sign access tokens. Keys live
+// in the database so every AuthService instance signs with the same key; they
+// are rotated on a schedule and published as a JSON Web Key Set.
+package keys
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+
+	"authservice/config"
+	"authservice/models"
+)
+
+// Supported signing algorithms.
+const (
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// reloadInterval bounds how often an unknown kid or a JWKS request reloads the
+// keys from the database, which picks up rotations made by other instances.
+const reloadInterval = 10 * time.Second
+
+// JWK is the public half of a signing key in JSON Web Key format (RFC 7517).
+type JWK struct {
+	KeyType string `json:"kty"`
+	Use     string `json:"use"`
+	Alg     string `json:"alg"`
+	KID     string `json:"kid"`
+	Curve   string `json:"crv,omitempty"`
+	N       string `json:"n,omitempty"`
+	E       string `json:"e,omitempty"`
+	X       string `json:"x,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// signingKey is a parsed SigningKey.
+type signingKey struct {
+	kid     string
+	alg     string
+	private crypto.Signer
+	public  crypto.PublicKey
+}
+
+var (
+	db *gorm.DB
+
+	mu        sync.RWMutex
+	active    *signingKey
+	published []*signingKey
+	loadedAt  time.Time
+)
+
+// Init loads the keys from database and creates the first signing key, or a
+// new one when the active key is due for rotation.
+func Init(ctx context.Context, database *gorm.DB) error {
+	db = database
+	return refresh(ctx)
+}
+
+// Run rotates the signing key when it reaches JWT_KEY_ROTATION and picks up
+// keys rotated by other instances, checking every interval until ctx is done.
+func Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := refresh(ctx); err != nil && ctx.Err() == nil {
+			slog.Warn("signing key refresh failed", "error", err)
+		}
+	}
+}
+
+// Rotate creates a new signing key and retires the current one, which stays
+// published for JWT_KEY_OVERLAP. It returns the kid of the new key. record,
+// when not nil, runs in the same transaction, e.g. to write the audit log.
+func Rotate(ctx context.Context, record func(tx *gorm.DB, kid string) error) (string, error) {
+	key, err := generate(config.Get().JWTSigningAlg)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now().UTC()
+	key.CreatedAt = now
+	err = db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.SigningKey{}).
+			Where("retired_at IS NULL").
+			Update("retired_at", now).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(key).Error; err != nil {
+			return err
+		}
+		if record != nil {
+			return record(tx, key.KID)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("store signing key: %w", err)
+	}
+	slog.Info("signing key rotated", "kid", key.KID, "alg", key.Algorithm)
+	return key.KID, load(ctx)
+}
+
+// Sign signs claims with the active key and sets the kid header.
+func Sign(claims jwt.Claims) (string, error) {
+	mu.RLock()
+	key := active
+	mu.RUnlock()
+	if key == nil {
+		return "", errors.New("no active signing key")
+	}
+
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.alg), claims)
+	token.Header["kid"] = key.kid
+	return token.SignedString(key.private)
+}
+
+// Keyfunc resolves the public key that verifies token from its kid header.
+func Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, errors.New("token has no kid header")
+	}
+	key := lookup(kid)
+	if key == nil && reloadDue() {
+		if err := load(context.Background()); err != nil {
+			return nil, err
+		}
+		key = lookup(kid)
+	}
+	if key == nil {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if token.Method.Alg() != key.alg {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return key.public, nil
+}
+
+// PublicKeys returns the published keys as a JWKS, reloading them from the
+// database at most every reloadInterval.
+func PublicKeys(ctx context.Context) (JWKS, error) {
+	if reloadDue() {
+		if err := load(ctx); err != nil {
+			return JWKS{}, err
+		}
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+
+	set := JWKS{Keys: make([]JWK, 0, len(published))}
+	for _, k := range published {
+		jwk, err := toJWK(k.kid, k.alg, k.public)
+		if err != nil {
+			return JWKS{}, err
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set, nil
+}
+
+// refresh loads the keys, rotates when no usable key exists or the active one
+// is older than JWT_KEY_ROTATION, and deletes keys past their overlap period.
+func refresh(ctx context.Context) error {
+	c := config.Get()
+	if err := db.WithContext(ctx).
+		Where("retired_at < ?", time.Now().UTC().Add(-c.JWTKeyOverlap)).
+		Delete(&models.SigningKey{}).Error; err != nil {
+		return fmt.Errorf("delete expired signing keys: %w", err)
+	}
+
+	var current models.SigningKey
+	err := db.WithContext(ctx).Where("retired_at IS NULL").Order("created_at DESC").First(&current).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		_, err = Rotate(ctx, nil)
+		return err
+	case err != nil:
+		return fmt.Errorf("load signing key: %w", err)
+	case current.Algorithm != c.JWTSigningAlg,
+		c.JWTKeyRotation > 0 && time.Since(current.CreatedAt) >= c.JWTKeyRotation:
+		_, err = Rotate(ctx, nil)
+		return err
+	}
+	return load(ctx)
+}
+
+// load replaces the in-memory keys with the active and published keys stored
+// in the database.
+func load(ctx context.Context) error {
+	var stored []models.SigningKey
+	if err := db.WithContext(ctx).
+		Where("retired_at IS NULL OR retired_at >= ?", time.Now().UTC().Add(-config.Get().JWTKeyOverlap)).
+		Order("created_at DESC").Find(&stored).Error; err != nil {
+		return fmt.Errorf("load signing keys: %w", err)
+	}
+
+	var newActive *signingKey
+	keys := make([]*signingKey, 0, len(stored))
+	for _, s := range stored {
+		k, err := parse(s)
+		if err != nil {
+			return fmt.Errorf("signing key %s: %w", s.KID, err)
+		}
+		if newActive == nil && s.RetiredAt == nil {
+			newActive = k
+		}
+		keys = append(keys, k)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	active = newActive
+	published = keys
+	loadedAt = time.Now()
+	return nil
+}
+
+func lookup(kid string) *signingKey {
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, k := range published {
+		if k.kid == kid {
+			return k
+		}
+	}
+	return nil
+}
+
+func reloadDue() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return time.Since(loadedAt) >= reloadInterval
+}
+
+// generate creates a key for alg, identified by its JWK thumbprint.
+func generate(alg string) (*models.SigningKey, error) {
+	var (
+		private crypto.Signer
+		err     error
+	)
+	switch alg {
+	case AlgRS256:
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	case AlgEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("generate %s key: %w", alg, err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+	kid, err := thumbprint(private.Public())
+	if err != nil {
+		return nil, err
+	}
+	return &models.SigningKey{
+		KID:        kid,
+		Algorithm:  alg,
+		PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+	}, nil
+}
+
+func parse(s models.SigningKey) (*signingKey, error) {
+	block, _ := pem.Decode([]byte(s.PrivateKey))
+	if block == nil {
+		return nil, errors.New("invalid PEM")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	private, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+	return &signingKey{kid: s.KID, alg: s.Algorithm, private: private, public: private.Public()}, nil
+}
+
+// toJWK encodes a public key as a JWK.
+func toJWK(kid, alg string, public crypto.PublicKey) (JWK, error) {
+	switch k := public.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			KeyType: "RSA",
+			Use:     "sig",
+			Alg:     alg,
+			KID:     kid,
+			N:       base64.RawURLEncoding.EncodeToString(k.N.Bytes()),
+			E:       base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes()),
+		}, nil
+	case ed25519.PublicKey:
+		return JWK{
+			KeyType: "OKP",
+			Use:     "sig",
+			Alg:     alg,
+			KID:     kid,
+			Curve:   "Ed25519",
+			X:       base64.RawURLEncoding.EncodeToString(k),
+		}, nil
+	default:
+		return JWK{}, fmt.Errorf("unsupported public key type %T", public)
+	}
+}
+
+// thumbprint computes the RFC 7638 JWK thumbprint of a public key.
+func thumbprint(public crypto.PublicKey) (string, error) {
+	jwk, err := toJWK("", "", public)
+	if err != nil {
+		return "", err
+	}
+	// Required members only, in lexicographic order
+	var members any
+	switch jwk.KeyType {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.KeyType, jwk.N}
+	default:
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Curve, jwk.KeyType, jwk.X}
+	}
+	b, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,152 @@
+package keys
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"authservice/config"
+	"authservice/models"
+)
+
+// setupKeys loads the configuration for alg and initialises the keys on a
+// fresh database.
+func setupKeys(t *testing.T, alg string) {
+	t.Helper()
+	t.Setenv("EMAIL_VERIFICATION_SECRET", "test-secret")
+	t.Setenv("SUPERADMIN_EMAIL", "root@example.com")
+	t.Setenv("SUPERADMIN_PASSWORD", "secret-password")
+	t.Setenv("JWT_SIGNING_ALG", alg)
+	t.Setenv("JWT_KEY_OVERLAP", "1h")
+	if err := config.Load(); err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	database, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "auth.db")), &gorm.Config{
+		Logger:  logger.Discard,
+		NowFunc: func() time.Time { return time.Now().UTC() },
+	})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	if err := database.AutoMigrate(&models.SigningKey{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if err := Init(context.Background(), database); err != nil {
+		t.Fatalf("init keys: %v", err)
+	}
+}
+
+// signed returns a token signed with the active key and its kid.
+func signed(t *testing.T) (token, kid string) {
+	t.Helper()
+	token, err := Sign(jwt.RegisteredClaims{Subject: "1", ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))})
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, &jwt.RegisteredClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token, parsed.Header["kid"].(string)
+}
+
+func verifies(token string) bool {
+	_, err := jwt.Parse(token, Keyfunc)
+	return err == nil
+}
+
+// publishedKIDs returns the kids of the JWKS, checking that it holds public
+// keys only.
+func publishedKIDs(t *testing.T) []string {
+	t.Helper()
+	set, err := PublicKeys(context.Background())
+	if err != nil {
+		t.Fatalf("public keys: %v", err)
+	}
+	b, _ := json.Marshal(set)
+	if strings.Contains(string(b), `"d"`) || strings.Contains(string(b), "PRIVATE") {
+		t.Fatalf("JWKS contains private key material: %s", b)
+	}
+	kids := make([]string, 0, len(set.Keys))
+	for _, k := range set.Keys {
+		kids = append(kids, k.KID)
+	}
+	return kids
+}
+
+func TestRotationKeepsPreviousKeyUntilOverlapEnds(t *testing.T) {
+	for _, alg := range []string{AlgRS256, AlgEdDSA} {
+		t.Run(alg, func(t *testing.T) {
+			setupKeys(t, alg)
+			oldToken, oldKID := signed(t)
+
+			newKID, err := Rotate(context.Background(), nil)
+			if err != nil {
+				t.Fatalf("rotate: %v", err)
+			}
+			newToken, kid := signed(t)
+			if kid != newKID || kid == oldKID {
+				t.Fatalf("signed with %s after rotating from %s to %s", kid, oldKID, newKID)
+			}
+			if !verifies(oldToken) || !verifies(newToken) {
+				t.Fatal("tokens of the previous or the new key do not verify during the overlap")
+			}
+			if got := publishedKIDs(t); len(got) != 2 || got[0] != newKID || got[1] != oldKID {
+				t.Fatalf("published %v, want [%s %s]", got, newKID, oldKID)
+			}
+
+			// The overlap of the previous key ends
+			if err := db.Model(&models.SigningKey{KID: oldKID}).
+				Update("retired_at", time.Now().UTC().Add(-2*time.Hour)).Error; err != nil {
+				t.Fatal(err)
+			}
+			if err := refresh(context.Background()); err != nil {
+				t.Fatalf("refresh: %v", err)
+			}
+			if verifies(oldToken) {
+				t.Fatal("token of an expired key still verifies")
+			}
+			if !verifies(newToken) {
+				t.Fatal("token of the active key no longer verifies")
+			}
+			if got := publishedKIDs(t); len(got) != 1 || got[0] != newKID {
+				t.Fatalf("published %v, want [%s]", got, newKID)
+			}
+		})
+	}
+}
+
+func TestKeyfuncRejects(t *testing.T) {
+	setupKeys(t, AlgRS256)
+	token, kid := signed(t)
+
+	tests := []struct {
+		name   string
+		header map[string]interface{}
+	}{
+		{"missing kid", map[string]interface{}{"alg": AlgRS256}},
+		{"unknown kid", map[string]interface{}{"alg": AlgRS256, "kid": "unknown"}},
+		{"other algorithm", map[string]interface{}{"alg": AlgEdDSA, "kid": kid}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, _, err := jwt.NewParser().ParseUnverified(token, &jwt.RegisteredClaims{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			parsed.Header = tt.header
+			parsed.Method = jwt.GetSigningMethod(tt.header["alg"].(string))
+			if _, err := Keyfunc(parsed); err == nil {
+				t.Fatal("Keyfunc accepted the token")
+			}
+		})
+	}
+}
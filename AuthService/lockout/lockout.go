@@ -0,0 +1,181 @@
+// Package lockout slows down password guessing. Failed logins are counted per
+// email address and per client IP; once a key passes its threshold every
+// further attempt has to wait, twice as long after each failure. An account
+// whose email collects LOGIN_LOCKOUT_THRESHOLD consecutive failures is locked
+// for LOGIN_LOCKOUT_DURATION and its owner is notified.
+//
+// Checks happen before the password is compared, so throttled requests do not
+// cost a bcrypt comparison.
+package lockout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"authservice/config"
+	"authservice/database"
+	"authservice/models"
+	"authservice/notify"
+)
+
+// emailKey and ipKey return the throttle keys of an email address and a client IP.
+func emailKey(email string) string { return "email:" + email }
+func ipKey(ip string) string       { return "ip:" + ip }
+
+// Wait returns how long the client has to wait before the next login attempt
+// for email from ip is accepted; zero when it may try now.
+func Wait(ctx context.Context, email, ip string) (time.Duration, error) {
+	now := time.Now().UTC()
+	var throttles []models.LoginThrottle
+	if err := database.DB.WithContext(ctx).
+		Where("throttle_key IN ? AND blocked_until > ?", []string{emailKey(email), ipKey(ip)}, now).
+		Find(&throttles).Error; err != nil {
+		return 0, err
+	}
+	var wait time.Duration
+	for _, t := range throttles {
+		if d := t.BlockedUntil.Sub(now); d > wait {
+			wait = d
+		}
+	}
+	return wait, nil
+}
+
+// Fail records a failed login for email from ip. user is the account the
+// email belongs to, or nil. When the failure locks the account, Fail returns
+// true and notifies the owner.
+func Fail(ctx context.Context, email, ip string, user *models.User) (bool, error) {
+	c := config.Get()
+	db := database.DB.WithContext(ctx)
+
+	if _, err := recordFailure(db, ipKey(ip), c.LoginIPBackoffThreshold); err != nil {
+		return false, err
+	}
+	failures, err := recordFailure(db, emailKey(email), c.LoginBackoffThreshold)
+	if err != nil {
+		return false, err
+	}
+	if user == nil || c.LoginLockoutThreshold == 0 || failures < c.LoginLockoutThreshold {
+		return false, nil
+	}
+	return lock(db, user, c.LoginLockoutDuration)
+}
+
+// Succeed forgets the failed logins of email. Failures of the client IP are
+// kept, so one valid account does not reset the counter of a guessing client.
+func Succeed(ctx context.Context, email string) error {
+	return database.DB.WithContext(ctx).Where("throttle_key = ?", emailKey(email)).
+		Delete(&models.LoginThrottle{}).Error
+}
+
+// Unlock lifts the lock of user and forgets the failed logins of their email.
+func Unlock(ctx context.Context, user *models.User) error {
+	return database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", user.ID).
+			Update("locked_until", nil).Error; err != nil {
+			return err
+		}
+		return tx.Where("throttle_key = ?", emailKey(user.Email)).Delete(&models.LoginThrottle{}).Error
+	})
+}
+
+// Run deletes forgotten failures every interval until ctx is done.
+func Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			now := time.Now().UTC()
+			if err := database.DB.WithContext(ctx).
+				Where("last_failure_at < ? AND blocked_until < ?", now.Add(-config.Get().LoginFailureWindow), now).
+				Delete(&models.LoginThrottle{}).Error; err != nil && !errors.Is(err, context.Canceled) {
+				slog.WarnContext(ctx, "prune login throttles failed", "error", err)
+			}
+		}
+	}
+}
+
+// recordFailure counts a failure for key and, past threshold, blocks the key
+// for an exponentially growing time. It returns the consecutive failures.
+// The count is incremented by the database in a single upsert, so concurrent
+// failures are all counted.
+func recordFailure(db *gorm.DB, key string, threshold int) (int, error) {
+	c := config.Get()
+	now := time.Now().UTC()
+	t := models.LoginThrottle{Key: key, Failures: 1, LastFailureAt: now}
+	err := db.Clauses(
+		clause.OnConflict{
+			Columns: []clause.Column{{Name: "throttle_key"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				// Failures older than the window are forgotten
+				"failures": gorm.Expr("CASE WHEN last_failure_at < ? THEN 1 ELSE failures + 1 END",
+					now.Add(-c.LoginFailureWindow)),
+				"last_failure_at": now,
+			}),
+		},
+		clause.Returning{Columns: []clause.Column{{Name: "failures"}}},
+	).Create(&t).Error
+	if err != nil || t.Failures < threshold {
+		return t.Failures, err
+	}
+	// Only the latest failure sets the block; a concurrent later failure
+	// has counted higher and sets a longer one
+	err = db.Model(&models.LoginThrottle{}).
+		Where("throttle_key = ? AND failures = ?", key, t.Failures).
+		Update("blocked_until", now.Add(backoff(t.Failures-threshold, c.LoginBackoffBase, c.LoginBackoffMax))).Error
+	return t.Failures, err
+}
+
+// backoff returns base doubled n times, capped at max.
+func backoff(n int, base, max time.Duration) time.Duration {
+	d := base
+	for i := 0; i < n && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
+
+// lock locks the account and notifies its owner, unless it is locked already.
+// The failures of its email start over, so the next lock needs a full series.
+func lock(db *gorm.DB, user *models.User, duration time.Duration) (bool, error) {
+	now := time.Now().UTC()
+	until := now.Add(duration)
+	locked := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&models.User{}).
+			Where("id = ? AND (locked_until IS NULL OR locked_until <= ?)", user.ID, now).
+			Update("locked_until", until)
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		locked = true
+		if err := tx.Model(&models.LoginThrottle{}).Where("throttle_key = ?", emailKey(user.Email)).
+			Update("failures", 0).Error; err != nil {
+			return err
+		}
+		return notify.Create(tx, user.ID, models.NotificationAccountLocked,
+			fmt.Sprintf("Your account was locked after too many failed login attempts until %s. "+
+				"If this was not you, reset your password.", until.UTC().Format("2006-01-02 15:04 MST")),
+			map[string]time.Time{"locked_until": until})
+	})
+	if err != nil {
+		return false, err
+	}
+	if locked {
+		user.LockedUntil = &until
+		slog.WarnContext(db.Statement.Context, "account locked", "user_id", user.ID, "locked_until", until)
+	}
+	return locked, nil
+}
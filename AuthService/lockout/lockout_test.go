@@ -0,0 +1,140 @@
+package lockout
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"authservice/config"
+	"authservice/database"
+	"authservice/models"
+)
+
+// setup loads a test configuration and points the database at a fresh file.
+func setup(t *testing.T) *gorm.DB {
+	t.Helper()
+	t.Setenv("EMAIL_VERIFICATION_SECRET", "test-secret")
+	t.Setenv("SUPERADMIN_EMAIL", "root@example.com")
+	t.Setenv("SUPERADMIN_PASSWORD", "secret")
+	t.Setenv("LOGIN_BACKOFF_BASE", "1s")
+	t.Setenv("LOGIN_BACKOFF_MAX", "1m")
+	t.Setenv("LOGIN_FAILURE_WINDOW", "1h")
+	if err := config.Load(); err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+
+	dsn := filepath.Join(t.TempDir(), "auth.db") + "?_pragma=busy_timeout(5000)"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.LoginThrottle{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	database.DB = db
+	return db
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		n    int
+		want time.Duration
+	}{
+		{0, time.Second},
+		{1, 2 * time.Second},
+		{3, 8 * time.Second},
+		{6, time.Minute},
+		{100, time.Minute},
+	}
+	for _, tt := range tests {
+		if got := backoff(tt.n, time.Second, time.Minute); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestRecordFailureBlocksPastThreshold(t *testing.T) {
+	db := setup(t)
+
+	tests := []struct {
+		failures    int
+		wantBlocked time.Duration
+	}{
+		{1, 0},
+		{2, 0},
+		{3, time.Second},
+		{4, 2 * time.Second},
+		{5, 4 * time.Second},
+	}
+	for _, tt := range tests {
+		got, err := recordFailure(db, "email:a@example.com", 3)
+		if err != nil {
+			t.Fatalf("recordFailure: %v", err)
+		}
+		if got != tt.failures {
+			t.Fatalf("failures = %d, want %d", got, tt.failures)
+		}
+		var throttle models.LoginThrottle
+		if err := db.First(&throttle, "throttle_key = ?", "email:a@example.com").Error; err != nil {
+			t.Fatalf("load throttle: %v", err)
+		}
+		blocked := time.Until(throttle.BlockedUntil)
+		if tt.wantBlocked == 0 && blocked > 0 {
+			t.Errorf("after %d failures blocked for %v, want not blocked", tt.failures, blocked)
+		}
+		if tt.wantBlocked > 0 && (blocked <= tt.wantBlocked-time.Second || blocked > tt.wantBlocked) {
+			t.Errorf("after %d failures blocked for %v, want %v", tt.failures, blocked, tt.wantBlocked)
+		}
+	}
+}
+
+func TestRecordFailureForgetsOldFailures(t *testing.T) {
+	db := setup(t)
+
+	old := models.LoginThrottle{Key: "ip:10.0.0.1", Failures: 7, LastFailureAt: time.Now().Add(-2 * time.Hour)}
+	if err := db.Create(&old).Error; err != nil {
+		t.Fatalf("create throttle: %v", err)
+	}
+	got, err := recordFailure(db, "ip:10.0.0.1", 20)
+	if err != nil {
+		t.Fatalf("recordFailure: %v", err)
+	}
+	if got != 1 {
+		t.Errorf("failures = %d, want 1 after the window passed", got)
+	}
+}
+
+func TestRecordFailureCountsConcurrentFailures(t *testing.T) {
+	db := setup(t)
+
+	const attempts = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, attempts)
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := recordFailure(db, "email:b@example.com", 100); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("recordFailure: %v", err)
+	}
+
+	var throttle models.LoginThrottle
+	if err := db.First(&throttle, "throttle_key = ?", "email:b@example.com").Error; err != nil {
+		t.Fatalf("load throttle: %v", err)
+	}
+	if throttle.Failures != attempts {
+		t.Errorf("failures = %d, want %d", throttle.Failures, attempts)
+	}
+}
@@ -0,0 +1,73 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// GormLogger adapts GORM's logger to slog, tagging each query with the
+// request ID carried by its context.
+type GormLogger struct {
+	Level         logger.LogLevel
+	SlowThreshold time.Duration
+}
+
+// NewGormLogger returns a GORM logger logging at level and flagging queries slower than 200ms.
+func NewGormLogger(level logger.LogLevel) *GormLogger {
+	return &GormLogger{Level: level, SlowThreshold: 200 * time.Millisecond}
+}
+
+// LogMode returns a copy of the logger with a different level.
+func (l *GormLogger) LogMode(level logger.LogLevel) logger.Interface {
+	c := *l
+	c.Level = level
+	return &c
+}
+
+// Info logs a GORM informational message.
+func (l *GormLogger) Info(ctx context.Context, msg string, args ...interface{}) {
+	if l.Level >= logger.Info {
+		FromContext(ctx).Info(fmt.Sprintf(msg, args...))
+	}
+}
+
+// Warn logs a GORM warning.
+func (l *GormLogger) Warn(ctx context.Context, msg string, args ...interface{}) {
+	if l.Level >= logger.Warn {
+		FromContext(ctx).Warn(fmt.Sprintf(msg, args...))
+	}
+}
+
+// Error logs a GORM error.
+func (l *GormLogger) Error(ctx context.Context, msg string, args ...interface{}) {
+	if l.Level >= logger.Error {
+		FromContext(ctx).Error(fmt.Sprintf(msg, args...))
+	}
+}
+
+// Trace logs a finished query: failures at error, slow queries at warn and,
+// at Info level, every query.
+func (l *GormLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	if l.Level <= logger.Silent {
+		return
+	}
+	elapsed := time.Since(begin)
+	durationMS := float64(elapsed.Microseconds()) / 1000
+
+	switch {
+	case err != nil && l.Level >= logger.Error && !errors.Is(err, gorm.ErrRecordNotFound):
+		sql, rows := fc()
+		FromContext(ctx).Error("query failed", "sql", sql, "rows", rows, "duration_ms", durationMS, "error", err)
+	case l.SlowThreshold > 0 && elapsed > l.SlowThreshold && l.Level >= logger.Warn:
+		sql, rows := fc()
+		FromContext(ctx).Warn("slow query", "sql", sql, "rows", rows, "duration_ms", durationMS)
+	case l.Level >= logger.Info:
+		sql, rows := fc()
+		FromContext(ctx).Info("query", "sql", sql, "rows", rows, "duration_ms", durationMS)
+	}
+}
@@ -0,0 +1,177 @@
+// Package mailer sends transactional email such as password reset links.
+// The transport is selected by MAIL_DRIVER: smtp for real delivery, file or
+// log for local development and tests.
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"authservice/config"
+)
+
+// Mail drivers selectable with MAIL_DRIVER.
+const (
+	DriverLog  = "log"
+	DriverFile = "file"
+	DriverSMTP = "smtp"
+)
+
+// Message is a plain text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers messages.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+var current Mailer = LogMailer{}
+
+// Init selects the mailer configured by MAIL_DRIVER.
+func Init(c config.Config) error {
+	switch c.MailDriver {
+	case "", DriverLog:
+		current = LogMailer{}
+	case DriverFile:
+		current = &FileMailer{Path: c.MailFile, From: c.MailFrom}
+	case DriverSMTP:
+		if c.SMTPHost == "" {
+			return errors.New("SMTP_HOST is required for the smtp mail driver")
+		}
+		current = &SMTPMailer{
+			Addr:     net.JoinHostPort(c.SMTPHost, c.SMTPPort),
+			Host:     c.SMTPHost,
+			Username: c.SMTPUsername,
+			Password: c.SMTPPassword,
+			From:     c.MailFrom,
+		}
+	default:
+		return fmt.Errorf("unknown MAIL_DRIVER %q", c.MailDriver)
+	}
+	return nil
+}
+
+// Use replaces the mailer, e.g. with a fake in tests.
+func Use(m Mailer) { current = m }
+
+// Send delivers msg with the configured mailer.
+func Send(ctx context.Context, msg Message) error {
+	return current.Send(ctx, msg)
+}
+
+// LogMailer writes messages to the structured log instead of sending them.
+type LogMailer struct{}
+
+// Send logs msg, including its body.
+func (LogMailer) Send(ctx context.Context, msg Message) error {
+	slog.InfoContext(ctx, "email", "to", msg.To, "subject", msg.Subject, "body", msg.Body)
+	return nil
+}
+
+// FileMailer appends messages in RFC 5322 format to a file, one after another.
+type FileMailer struct {
+	Path string
+	From string
+
+	mu sync.Mutex
+}
+
+// Send appends msg to the file.
+func (m *FileMailer) Send(_ context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, err := os.OpenFile(m.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("open mail file: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(append(format(m.From, msg), "\r\n"...)); err != nil {
+		return fmt.Errorf("write mail file: %w", err)
+	}
+	return nil
+}
+
+// SMTPMailer sends messages through an SMTP server, using STARTTLS when the
+// server offers it and PLAIN authentication when a username is set.
+type SMTPMailer struct {
+	Addr     string
+	Host     string
+	Username string
+	Password string
+	From     string
+}
+
+// Send delivers msg. ctx bounds the whole SMTP conversation.
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", m.Addr)
+	if err != nil {
+		return fmt.Errorf("smtp dial: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	c, err := smtp.NewClient(conn, m.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("smtp handshake: %w", err)
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: m.Host}); err != nil {
+			return fmt.Errorf("smtp starttls: %w", err)
+		}
+	}
+	if m.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", m.Username, m.Password, m.Host)); err != nil {
+			return fmt.Errorf("smtp auth: %w", err)
+		}
+	}
+	if err := c.Mail(m.From); err != nil {
+		return fmt.Errorf("smtp mail from: %w", err)
+	}
+	if err := c.Rcpt(msg.To); err != nil {
+		return fmt.Errorf("smtp rcpt to: %w", err)
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("smtp data: %w", err)
+	}
+	if _, err := w.Write(format(m.From, msg)); err != nil {
+		return fmt.Errorf("smtp data: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("smtp data: %w", err)
+	}
+	return c.Quit()
+}
+
+// format renders msg with the headers required for delivery.
+func format(from string, msg Message) []byte {
+	var b strings.Builder
+	b.WriteString("From: " + from + "\r\n")
+	b.WriteString("To: " + msg.To + "\r\n")
+	b.WriteString("Subject: " + msg.Subject + "\r\n")
+	b.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	b.WriteString("\r\n")
+	return []byte(b.String())
+}
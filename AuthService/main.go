@@ -1,15 +1,31 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 
 	"authservice/config"
 	"authservice/database"
 	"authservice/handlers"
+	"authservice/health"
+	"authservice/keys"
+	"authservice/lockout"
+	"authservice/logging"
+	"authservice/mailer"
+	"authservice/metrics"
 	"authservice/middleware"
+	"authservice/models"
+	"authservice/notify"
+	"authservice/tracing"
 )
 
 // bootstrap sets up configuration, database, routes, and starts the server.
@@ -19,36 +35,171 @@ func bootstrap() {
 		log.Fatalf("failed to load config: %v", err)
 	}
 
+	// Structured JSON logs; the standard log package is routed through slog too
+	logging.Setup("auth-service")
+
+	// Stop serving and flush traces on SIGINT/SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Tracing exporter is selected by OTEL_TRACES_EXPORTER (none, otlp, stdout, file)
+	shutdownTracing, err := tracing.Setup(ctx, "auth-service")
+	if err != nil {
+		log.Fatalf("failed to set up tracing: %v", err)
+	}
+
+	// Mail transport for verification and password reset emails (MAIL_DRIVER: log, file, smtp)
+	if err := mailer.Init(config.Get()); err != nil {
+		log.Fatalf("failed to set up mailer: %v", err)
+	}
+	// Webhook transport for notifications (WEBHOOK_DRIVER: http, file)
+	if err := notify.Init(config.Get()); err != nil {
+		log.Fatalf("failed to set up notification channels: %v", err)
+	}
+
 	// Initialize database and run migrations/seeders
 	if err := database.InitDatabase(); err != nil {
 		log.Fatalf("failed to initialize database: %v", err)
 	}
+	// Rotate the signing key when due and pick up rotations by other instances
+	go keys.Run(ctx, time.Minute)
+	// Forget old failed logins
+	go lockout.Run(ctx, 10*time.Minute)
+	// Delete read notifications past NOTIFICATION_RETENTION
+	go notify.Run(ctx, time.Hour)
+	// Deliver queued email and webhook notifications
+	go notify.RunDispatcher(ctx, 5*time.Second)
+
+	r := gin.New()
+	// Client IPs (used to throttle logins) come from X-Forwarded-For only when set by the gateway
+	if err := r.SetTrustedProxies(config.Get().TrustedProxies); err != nil {
+		log.Fatalf("invalid TRUSTED_PROXIES: %v", err)
+	}
+	r.Use(otelgin.Middleware("auth-service", otelgin.WithFilter(tracing.ShouldTrace)))
+	r.Use(gin.Recovery(), middleware.RequestIDMiddleware(), middleware.LoggingMiddleware(), metrics.Middleware())
+
+	// Check
+	r.GET("/Check", func(c *gin.Context) {
+		c.JSON(200, gin.H{"status": "ok", "service": "auth-service"})
+	})
 
-	r := gin.Default()
+	// Liveness and readiness (database reachable)
+	r.GET("/healthz", health.Liveness("auth-service"))
+	r.GET("/readyz", health.Readiness("auth-service", health.Database(database.DB)))
+
+	// Prometheus metrics
+	r.GET("/metrics", metrics.Handler())
+
+	// Public keys verifying access tokens
+	r.GET("/.well-known/jwks.json", handlers.JWKS)
 
 	// Public routes
 	r.POST("/register", handlers.Register)
 	r.POST("/login", handlers.Login)
+	r.POST("/login/2fa", handlers.LoginTwoFactor)
+	r.POST("/login/2fa/enroll", handlers.EnrollTwoFactorLogin)
+	r.POST("/token/refresh", handlers.RefreshToken)
+	r.POST("/password/forgot", handlers.ForgotPassword)
+	r.POST("/password/reset", handlers.ResetPassword)
+	r.GET("/email/verify", handlers.VerifyEmail)
+	r.POST("/email/verify", handlers.VerifyEmail)
 
 	// Protected routes: require valid JWT
 	auth := r.Group("/")
 	auth.Use(middleware.AuthMiddleware())
 	{
-		// Notifications for any logged in user
-		auth.GET("/notifications", handlers.GetUnreadNotifications)
+		// End the current session
+		auth.POST("/logout", handlers.Logout)
+		// Send a new email verification link
+		auth.POST("/email/resend", handlers.ResendVerification)
+
+		// Profile of the logged in user
+		auth.GET("/me", handlers.GetMe)
+		auth.PATCH("/me", handlers.UpdateMe)
+		auth.POST("/me/password", handlers.ChangePassword)
+		auth.DELETE("/me", handlers.DeleteMe)
+
+		// Two-factor authentication of the logged in user
+		auth.POST("/2fa/enroll", handlers.EnrollTwoFactor)
+		auth.POST("/2fa/confirm", handlers.ConfirmTwoFactor)
+		auth.POST("/2fa/disable", handlers.DisableTwoFactor)
+		auth.POST("/2fa/recovery-codes", handlers.RegenerateRecoveryCodes)
+
+		// Notification inbox of the logged in user
+		auth.GET("/notifications", handlers.ListNotifications)
+		auth.GET("/notifications/unread-count", handlers.CountUnreadNotifications)
+		auth.GET("/notifications/stream", handlers.StreamNotifications)
+		auth.PATCH("/notifications/:id/read", handlers.MarkNotificationRead)
+		auth.POST("/notifications/read-all", handlers.MarkAllNotificationsRead)
+		auth.GET("/notifications/:id/deliveries", handlers.ListNotificationDeliveries)
+		auth.GET("/notifications/preferences", handlers.GetNotificationPreferences)
+		auth.PUT("/notifications/preferences/:type", handlers.SetNotificationPreference)
+		auth.DELETE("/notifications/preferences/:type", handlers.DeleteNotificationPreference)
+		auth.PUT("/notifications/webhook", handlers.SetWebhook)
+		auth.DELETE("/notifications/webhook", handlers.DeleteWebhook)
 
-		// Super Admin only: approve Admins
-		auth.PUT("/approve-admin/:id", middleware.RequireRoles("superadmin"), handlers.ApproveAdmin)
-		// to get the list of pending admin approval requests
-		auth.GET("/approve-request", middleware.RequireRoles("superadmin"), handlers.GetPendingAdminApprovals)
+		// user:approve - approve accounts of roles that require approval
+		auth.PUT("/approve-admin/:id", middleware.RequirePermission(models.PermUserApprove), handlers.ApproveAdmin)
+		auth.GET("/approve-request", middleware.RequirePermission(models.PermUserApprove), handlers.GetPendingAdminApprovals)
+		auth.POST("/users/:id/reject", middleware.RequirePermission(models.PermUserApprove), handlers.RejectAdmin)
+		// user:read - search accounts; accounts that have not verified their email yet
+		auth.GET("/users", middleware.RequirePermission(models.PermUserRead), handlers.ListUsers)
+		auth.GET("/users/unverified", middleware.RequirePermission(models.PermUserRead), handlers.ListUnverifiedUsers)
+		// user:manage - suspend and reactivate, revoke every session, lift a login lock, remove a 2FA enrolment
+		auth.POST("/users/:id/suspend", middleware.RequirePermission(models.PermUserManage), handlers.SuspendUser)
+		auth.POST("/users/:id/reactivate", middleware.RequirePermission(models.PermUserManage), handlers.ReactivateUser)
+		auth.POST("/users/:id/revoke-sessions", middleware.RequirePermission(models.PermUserManage), handlers.RevokeUserSessions)
+		auth.POST("/users/:id/unlock", middleware.RequirePermission(models.PermUserManage), handlers.UnlockUser)
+		auth.DELETE("/users/:id/2fa", middleware.RequirePermission(models.PermUserManage), handlers.ResetUserTwoFactor)
+		// key:rotate - replace the token signing key now
+		auth.POST("/keys/rotate", middleware.RequirePermission(models.PermKeyRotate), handlers.RotateSigningKey)
+		// role:manage - roles, their permissions, who holds them and which roles must use 2FA
+		auth.GET("/permissions", middleware.RequirePermission(models.PermRoleManage), handlers.ListPermissions)
+		auth.GET("/roles", middleware.RequirePermission(models.PermRoleManage), handlers.ListRoles)
+		auth.POST("/roles", middleware.RequirePermission(models.PermRoleManage), handlers.CreateRole)
+		auth.PUT("/roles/:name", middleware.RequirePermission(models.PermRoleManage), handlers.UpdateRole)
+		auth.DELETE("/roles/:name", middleware.RequirePermission(models.PermRoleManage), handlers.DeleteRole)
+		auth.PUT("/users/:id/role", middleware.RequirePermission(models.PermRoleManage), handlers.ChangeUserRole)
+		auth.GET("/2fa/policies", middleware.RequirePermission(models.PermRoleManage), handlers.GetTwoFactorPolicies)
+		auth.PUT("/2fa/policies/:role", middleware.RequirePermission(models.PermRoleManage), handlers.SetTwoFactorPolicy)
+		// audit:read - search the audit log and export it as NDJSON
+		auth.GET("/audit", middleware.RequirePermission(models.PermAuditRead), handlers.ListAudit)
+		auth.GET("/audit/export", middleware.RequirePermission(models.PermAuditRead), handlers.ExportAudit)
+	}
+
+	// Service-to-service endpoints: require INTERNAL_API_TOKEN
+	internal := r.Group("/internal")
+	internal.Use(middleware.RequireInternalToken())
+	{
+		// Access token revocation list synced by the gateway and the services
+		internal.GET("/revocations", handlers.ListRevocations)
+		// Account events (deletions) applied by the services to their data
+		internal.GET("/user-events", handlers.ListUserEvents)
+		// Notifications sent to users by ProductService and OrderService
+		internal.POST("/notifications", handlers.CreateInternalNotifications)
 	}
 
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8001"
 	}
-	if err := r.Run(":" + port); err != nil {
-		log.Fatalf("server failed: %v", err)
+	server := &http.Server{Addr: ":" + port, Handler: r}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("server failed: %v", err)
+		}
+	}()
+
+	// Drain in-flight requests, then flush buffered spans
+	<-ctx.Done()
+	log.Println("auth service shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("server shutdown failed: %v", err)
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		log.Printf("failed to flush traces: %v", err)
 	}
 }
 
@@ -0,0 +1,148 @@
+// Package metrics holds the Prometheus collectors of the auth service and the
+// handler exposing them in the text exposition format.
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Login outcomes recorded by LoginAttempt.
+const (
+	LoginSuccess     = "success"
+	LoginInvalid     = "invalid_credentials"
+	LoginNotApproved = "not_approved"
+	LoginError       = "error"
+	LoginChallenged  = "totp_required"
+	LoginInvalidTOTP = "invalid_totp"
+	LoginThrottled   = "throttled"
+	LoginLocked      = "locked"
+	LoginSuspended   = "suspended"
+)
+
+// Notification delivery outcomes recorded by NotificationDelivery.
+const (
+	DeliverySent   = "sent"
+	DeliveryRetry  = "retry"
+	DeliveryFailed = "failed"
+)
+
+// Token refresh outcomes recorded by TokenRefresh.
+const (
+	RefreshSuccess = "success"
+	RefreshInvalid = "invalid"
+	RefreshExpired = "expired"
+	RefreshRevoked = "revoked"
+	RefreshReused  = "reused"
+	RefreshError   = "error"
+)
+
+// unmatchedRoute labels requests that matched no route so the route label
+// stays bounded by the registered routes.
+const unmatchedRoute = "unmatched"
+
+var (
+	requestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests handled, by route template and status.",
+	}, []string{"method", "route", "status"})
+
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Latency of HTTP requests, by route template and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	loginAttempts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_login_attempts_total",
+		Help: "Login attempts, by outcome.",
+	}, []string{"result"})
+
+	registrations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_registrations_total",
+		Help: "Users registered, by role.",
+	}, []string{"role"})
+
+	tokenRefreshes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_token_refreshes_total",
+		Help: "Refresh token exchanges, by outcome; reused means a replayed token revoked its family.",
+	}, []string{"result"})
+
+	adminApprovals = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "auth_admin_approvals_total",
+		Help: "Seller accounts approved by a superadmin.",
+	})
+
+	notificationStreams = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "auth_notification_streams",
+		Help: "Open notification streams.",
+	})
+
+	notificationDeliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_notification_deliveries_total",
+		Help: "Email and webhook delivery attempts, by channel and outcome.",
+	}, []string{"channel", "result"})
+)
+
+// Middleware records the request counter and latency histogram of every request.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		status := strconv.Itoa(c.Writer.Status())
+		requestsTotal.WithLabelValues(c.Request.Method, route, status).Inc()
+		requestDuration.WithLabelValues(c.Request.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+// Handler serves all registered metrics in the Prometheus text format.
+func Handler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.Handler())
+}
+
+// LoginAttempt counts a login attempt with the given outcome.
+func LoginAttempt(result string) {
+	loginAttempts.WithLabelValues(result).Inc()
+}
+
+// UserRegistered counts a newly registered user.
+func UserRegistered(role string) {
+	registrations.WithLabelValues(role).Inc()
+}
+
+// AdminApproved counts an approved seller account.
+func AdminApproved() {
+	adminApprovals.Inc()
+}
+
+// TokenRefresh counts a refresh token exchange with the given outcome.
+func TokenRefresh(result string) {
+	tokenRefreshes.WithLabelValues(result).Inc()
+}
+
+// NotificationStreamOpened counts an open notification stream; call
+// NotificationStreamClosed when it ends.
+func NotificationStreamOpened() {
+	notificationStreams.Inc()
+}
+
+// NotificationStreamClosed uncounts a notification stream that ended.
+func NotificationStreamClosed() {
+	notificationStreams.Dec()
+}
+
+// NotificationDelivery counts an attempt to deliver a notification on channel
+// with the given outcome.
+func NotificationDelivery(channel, result string) {
+	notificationDeliveries.WithLabelValues(channel, result).Inc()
+}
@@ -1,17 +1,45 @@
 package middleware
 
 import (
+	"crypto/subtle"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
 
+	"authclient/revocation"
+
+	"authservice/config"
+	"authservice/database"
+	"authservice/logging"
 	"authservice/utils"
 )
 
+// InternalTokenHeader carries the shared token of service-to-service calls.
+const InternalTokenHeader = "X-Internal-Token"
+
 // AuthMiddleware validates JWT from the Authorization header and sets user info in context.
+// Revoked tokens are rejected. A gateway identity assertion, when configured and present,
+// is accepted instead of the JWT; the gateway has checked revocation already.
+// Either way the context holds user_id, role, permissions, email_verified and
+// the jti, token_issued_at and token_expires_at of the access token.
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if assertion := c.GetHeader(utils.IdentityHeader); assertion != "" && config.Get().GatewayIdentitySecret != "" {
+			claims, err := utils.ParseIdentityAssertion(assertion)
+			if err != nil {
+				utils.JSONError(c, http.StatusUnauthorized, "invalid gateway identity: "+err.Error())
+				c.Abort()
+				return
+			}
+			setIdentity(c, claims, claims.TokenID,
+				revocation.IssuedAt(claims.TokenIssuedAt, claims.TokenIssuedAtMs), claims.TokenExpiresAt)
+			c.Next()
+			return
+		}
+
 		auth := c.GetHeader("Authorization")
 		if auth == "" || !strings.HasPrefix(strings.ToLower(auth), "bearer ") {
 			utils.JSONError(c, http.StatusUnauthorized, "missing or invalid authorization header")
@@ -25,29 +53,80 @@ func AuthMiddleware() gin.HandlerFunc {
 			c.Abort()
 			return
 		}
-		// Store claims in context
-		c.Set("user_id", claims.UserID)
-		c.Set("role", claims.Role)
+		issuedAt := revocation.IssuedAt(claims.IssuedAt, claims.IssuedAtMs)
+		revoked, err := database.IsTokenRevoked(c.Request.Context(), claims.ID, claims.UserID, issuedAt)
+		if err != nil {
+			logging.FromContext(c.Request.Context()).Error("revocation check failed", "error", err)
+			utils.JSONError(c, http.StatusInternalServerError, "failed to verify token")
+			c.Abort()
+			return
+		}
+		if revoked {
+			utils.JSONError(c, http.StatusUnauthorized, "token has been revoked")
+			c.Abort()
+			return
+		}
+		setIdentity(c, claims, claims.ID, issuedAt, claims.ExpiresAt)
 		c.Next()
 	}
 }
 
-// RequireRoles ensures the authenticated user has one of the allowed roles.
-func RequireRoles(roles ...string) gin.HandlerFunc {
-	allowed := map[string]struct{}{}
-	for _, r := range roles {
-		allowed[r] = struct{}{}
+// setIdentity stores the caller and the access token they authenticated with
+// in the context. Gateway identity assertions carry the token's ID, issue time
+// and expiry in their own claims, so both paths set the same keys.
+func setIdentity(c *gin.Context, claims *utils.Claims, jti string, issuedAt time.Time, expiresAt *jwt.NumericDate) {
+	c.Set("user_id", claims.UserID)
+	c.Set("role", claims.Role)
+	c.Set("permissions", claims.Permissions)
+	c.Set("email_verified", claims.EmailVerified)
+	c.Set("jti", jti)
+	if !issuedAt.IsZero() {
+		c.Set("token_issued_at", issuedAt.UTC())
+	}
+	if expiresAt != nil {
+		c.Set("token_expires_at", expiresAt.UTC())
 	}
+}
+
+// RequirePermission ensures the authenticated user's token grants every one
+// of the given permissions.
+func RequirePermission(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, p := range permissions {
+			if !HasPermission(c, p) {
+				utils.JSONError(c, http.StatusForbidden, "missing permission "+p)
+				c.Abort()
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// HasPermission reports whether the authenticated user's token grants permission.
+func HasPermission(c *gin.Context, permission string) bool {
+	granted, _ := c.Get("permissions")
+	list, _ := granted.([]string)
+	for _, p := range list {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireInternalToken restricts a route to other services presenting the
+// shared INTERNAL_API_TOKEN. The route answers 404 while no token is configured.
+func RequireInternalToken() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		val, exists := c.Get("role")
-		if !exists {
-			utils.JSONError(c, http.StatusForbidden, "role not found in context")
+		expected := config.Get().InternalAPIToken
+		if expected == "" {
+			utils.JSONError(c, http.StatusNotFound, "not found")
 			c.Abort()
 			return
 		}
-		role, _ := val.(string)
-		if _, ok := allowed[role]; !ok {
-			utils.JSONError(c, http.StatusForbidden, "insufficient role")
+		if subtle.ConstantTimeCompare([]byte(c.GetHeader(InternalTokenHeader)), []byte(expected)) != 1 {
+			utils.JSONError(c, http.StatusUnauthorized, "invalid internal token")
 			c.Abort()
 			return
 		}
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Audit actions.
+const (
+	AuditLogin              = "auth.login"
+	AuditUserRegistered     = "user.registered"
+	AuditUserApproved       = "user.approved"
+	AuditUserSuspended      = "user.suspended"
+	AuditUserReactivated    = "user.reactivated"
+	AuditUserRejected       = "user.rejected"
+	AuditUserRoleChanged    = "user.role_changed"
+	AuditUserTwoFactorReset = "user.2fa_reset"
+	AuditRoleCreated        = "role.created"
+	AuditRoleUpdated        = "role.updated"
+	AuditRoleDeleted        = "role.deleted"
+	AuditUserDeleted        = "user.deleted"
+	AuditPasswordChanged    = "user.password_changed"
+	AuditPasswordReset      = "user.password_reset"
+	AuditKeyRotated         = "key.rotated"
+	AuditTwoFactorPolicySet = "role.2fa_policy_changed"
+)
+
+// AuditActions lists every audit action.
+var AuditActions = []string{
+	AuditLogin, AuditUserRegistered, AuditUserApproved, AuditUserSuspended,
+	AuditUserReactivated, AuditUserRejected, AuditUserRoleChanged, AuditUserTwoFactorReset,
+	AuditRoleCreated, AuditRoleUpdated, AuditRoleDeleted,
+	AuditUserDeleted, AuditPasswordChanged, AuditPasswordReset, AuditKeyRotated,
+	AuditTwoFactorPolicySet,
+}
+
+// AuditSuccess is the outcome of actions that succeeded. Logins record the
+// login result instead, e.g. invalid_credentials or locked.
+const AuditSuccess = "success"
+
+// AuditEntry records a security relevant action: who did what to which user,
+// from where and with which outcome. Entries are never changed or deleted;
+// the database refuses to. ActorID is 0 when nobody was logged in, e.g. for
+// a login with an unknown email. Details holds action specific data as a JSON
+// object.
+type AuditEntry struct {
+	ID           uint            `gorm:"primaryKey" json:"id"`
+	ActorID      uint            `gorm:"index;not null" json:"actor_id"`
+	Action       string          `gorm:"size:64;index;not null" json:"action"`
+	TargetUserID uint            `gorm:"index" json:"target_user_id,omitempty"`
+	Outcome      string          `gorm:"size:32;index;not null;default:success" json:"outcome"`
+	IP           string          `gorm:"size:45" json:"ip,omitempty"`
+	UserAgent    string          `gorm:"size:255" json:"user_agent,omitempty"`
+	Details      json.RawMessage `gorm:"type:text" json:"details,omitempty"`
+	CreatedAt    time.Time       `gorm:"autoCreateTime;index" json:"created_at"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// LoginThrottle counts consecutive failed logins for one email address or
+// client IP. Key is "email:<address>" or "ip:<address>".
+type LoginThrottle struct {
+	Key           string    `gorm:"column:throttle_key;primaryKey;size:200" json:"key"`
+	Failures      int       `gorm:"not null;default:0" json:"failures"`
+	LastFailureAt time.Time `gorm:"index;not null" json:"last_failure_at"`
+	// BlockedUntil is when the next attempt for this key is accepted again.
+	BlockedUntil time.Time `gorm:"not null" json:"blocked_until"`
+}
@@ -1,12 +1,53 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
+
+// Notification types; clients use them, with the payload, to render and link
+// a notification.
+const (
+	NotificationGeneral            = "general"
+	NotificationAccountApproved    = "account.approved"
+	NotificationAccountRejected    = "account.rejected"
+	NotificationAccountSuspended   = "account.suspended"
+	NotificationAccountReactivated = "account.reactivated"
+	NotificationAccountLocked      = "account.locked"
+	NotificationRoleChanged        = "account.role_changed"
+
+	// Sent by ProductService and OrderService through POST /internal/notifications.
+	NotificationOrderPlaced        = "order.placed"
+	NotificationOrderReceived      = "order.received"
+	NotificationOrderStatusChanged = "order.status_changed"
+	NotificationLowStock           = "product.low_stock"
+)
+
+// NotificationTypes lists every notification type, e.g. to choose channels for.
+var NotificationTypes = []string{
+	NotificationGeneral,
+	NotificationAccountApproved, NotificationAccountRejected, NotificationAccountSuspended,
+	NotificationAccountReactivated, NotificationAccountLocked, NotificationRoleChanged,
+	NotificationOrderPlaced, NotificationOrderReceived, NotificationOrderStatusChanged,
+	NotificationLowStock,
+}
 
 // Notification represents a notification for a user.
 type Notification struct {
-	ID        uint      `gorm:"primaryKey" json:"id"`
-	UserID    uint      `gorm:"index;not null" json:"user_id"`
-	Message   string    `gorm:"size:255;not null" json:"message"`
-	IsRead    bool      `gorm:"not null;default:false" json:"is_read"`
-	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	ID      uint   `gorm:"primaryKey" json:"id"`
+	UserID  uint   `gorm:"index;uniqueIndex:idx_notifications_dedup;not null" json:"user_id"`
+	Type    string `gorm:"size:64;not null;default:general" json:"type"`
+	Message string `gorm:"size:255;not null" json:"message"`
+	// Payload is a JSON object with the data the notification refers to, e.g.
+	// {"order_id": 7}.
+	Payload   json.RawMessage `gorm:"type:text" json:"payload,omitempty"`
+	IsRead    bool            `gorm:"not null;default:false" json:"is_read"`
+	ReadAt    *time.Time      `gorm:"index" json:"read_at,omitempty"`
+	CreatedAt time.Time       `gorm:"autoCreateTime" json:"created_at"`
+	// DedupKey, when set, is unique per user so a sender retrying a
+	// notification does not store it twice.
+	DedupKey *string `gorm:"size:128;uniqueIndex:idx_notifications_dedup" json:"-"`
+	// Hidden is set when the user turned off the in-app channel for the type;
+	// the notification then only goes out by email or webhook.
+	Hidden bool `gorm:"not null;default:false" json:"-"`
 }
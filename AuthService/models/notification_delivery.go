@@ -0,0 +1,53 @@
+package models
+
+import "time"
+
+// Notification channels. In-app notifications are the inbox itself; the
+// other channels are delivered by the dispatcher.
+const (
+	ChannelInApp   = "in_app"
+	ChannelEmail   = "email"
+	ChannelWebhook = "webhook"
+)
+
+// Delivery states.
+const (
+	DeliveryPending = "pending"
+	DeliverySent    = "sent"
+	DeliveryFailed  = "failed"
+)
+
+// AllNotificationTypes is the preference type matching every notification
+// type without a preference of its own.
+const AllNotificationTypes = "*"
+
+// NotificationDelivery is a notification queued for, or delivered on, an
+// email or webhook channel. Failed attempts are retried with backoff until
+// NOTIFICATION_MAX_ATTEMPTS.
+type NotificationDelivery struct {
+	ID             uint   `gorm:"primaryKey" json:"id"`
+	NotificationID uint   `gorm:"index;not null" json:"notification_id"`
+	UserID         uint   `gorm:"index;not null" json:"-"`
+	Channel        string `gorm:"size:16;not null" json:"channel"`
+	Status         string `gorm:"size:16;not null;index:idx_delivery_due" json:"status"`
+	Attempts       int    `gorm:"not null;default:0" json:"attempts"`
+	// NextAttemptAt is when a pending delivery is tried next; once sent or
+	// failed, when it was last tried.
+	NextAttemptAt time.Time  `gorm:"not null;index:idx_delivery_due" json:"next_attempt_at"`
+	LastError     string     `gorm:"size:255" json:"last_error,omitempty"`
+	SentAt        *time.Time `json:"sent_at,omitempty"`
+	CreatedAt     time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt     time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// NotificationPreference chooses the channels a user gets notifications of
+// Type on. Type AllNotificationTypes applies to the types without a
+// preference of their own.
+type NotificationPreference struct {
+	UserID    uint      `gorm:"primaryKey" json:"-"`
+	Type      string    `gorm:"primaryKey;size:64" json:"type"`
+	InApp     bool      `gorm:"not null" json:"in_app"`
+	Email     bool      `gorm:"not null" json:"email"`
+	Webhook   bool      `gorm:"not null" json:"webhook"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// RefreshToken is an opaque, single-use refresh token. Only the SHA-256 hash of
+// the token is stored. Tokens issued by rotating one another share a FamilyID,
+// which starts at login; replaying a rotated token revokes the whole family.
+type RefreshToken struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"index;not null" json:"user_id"`
+	FamilyID  string     `gorm:"size:64;index;not null" json:"family_id"`
+	TokenHash string     `gorm:"size:64;uniqueIndex;not null" json:"-"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	RotatedAt *time.Time `json:"rotated_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
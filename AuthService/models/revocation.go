@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// Revocation reasons.
+const (
+	RevocationLogout         = "logout"
+	RevocationSessions       = "revoke_sessions"
+	RevocationPasswordReset  = "password_reset"
+	RevocationPasswordChange = "password_change"
+	RevocationReapproval     = "reapproval"
+	RevocationAccountDeleted = "account_deleted"
+	RevocationSuspended      = "suspended"
+	RevocationRoleChanged    = "role_changed"
+	RevocationTwoFactorReset = "2fa_reset"
+)
+
+// TokenRevocation is an entry of the access token revocation list. It revokes
+// a single token when JTI is set, or every token of UserID issued before
+// IssuedBefore otherwise (in whole milliseconds, the precision of the tokens'
+// iat_ms claim). Entries are kept until ExpiresAt, after which the
+// tokens they cover have expired anyway. The gateway and the other services
+// sync the list incrementally using ID as cursor.
+type TokenRevocation struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	JTI          string     `gorm:"size:64;index" json:"jti,omitempty"`
+	UserID       uint       `gorm:"index;not null" json:"user_id"`
+	IssuedBefore *time.Time `json:"issued_before,omitempty"`
+	ExpiresAt    time.Time  `gorm:"index;not null" json:"expires_at"`
+	Reason       string     `gorm:"size:32;not null" json:"reason"`
+	CreatedAt    time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
@@ -0,0 +1,70 @@
+package models
+
+import "time"
+
+// Permissions checked by the services. Roles grant them; code never checks
+// role names for authorization.
+const (
+	PermProductWrite      = "product:write"
+	PermOrderCreate       = "order:create"
+	PermOrderReadAll      = "order:read_all"
+	PermOrderUpdateStatus = "order:update_status"
+	PermUserRead          = "user:read"
+	PermUserApprove       = "user:approve"
+	PermUserManage        = "user:manage"
+	PermRoleManage        = "role:manage"
+	PermKeyRotate         = "key:rotate"
+	PermGatewayStatus     = "gateway:status"
+	PermAuditRead         = "audit:read"
+)
+
+// Permissions lists every known permission with a description. Roles can
+// only be granted permissions from this list.
+var Permissions = map[string]string{
+	PermProductWrite:      "Create, update and delete products and list own products",
+	PermOrderCreate:       "Place orders",
+	PermOrderReadAll:      "View the orders of all users",
+	PermOrderUpdateStatus: "Change the status of orders",
+	PermUserRead:          "List and search user accounts",
+	PermUserApprove:       "Approve or reject accounts of roles that require approval",
+	PermUserManage:        "Suspend and reactivate accounts, revoke sessions, unlock accounts and reset two-factor authentication",
+	PermRoleManage:        "Manage roles, their permissions, user role assignments and two-factor policies",
+	PermKeyRotate:         "Rotate the token signing key",
+	PermGatewayStatus:     "View gateway upstream status",
+	PermAuditRead:         "Search and export the audit log",
+}
+
+// SuperAdminPermissions are held by the superadmin role only and cannot be
+// granted to other roles: reading the audit log shows every admin's actions.
+var SuperAdminPermissions = map[string]bool{
+	PermAuditRead: true,
+}
+
+// Role is a named set of permissions assigned to users.
+type Role struct {
+	Name        string `gorm:"primaryKey;size:20" json:"name"`
+	Description string `gorm:"size:255" json:"description"`
+	// RequiresApproval keeps new accounts of this role waiting until a user
+	// with user:approve approves them.
+	RequiresApproval bool `gorm:"not null;default:false" json:"requires_approval"`
+	// SelfRegister allows choosing this role at registration.
+	SelfRegister bool             `gorm:"not null;default:false" json:"self_register"`
+	Permissions  []RolePermission `gorm:"foreignKey:Role;references:Name;constraint:OnDelete:CASCADE" json:"-"`
+	CreatedAt    time.Time        `json:"created_at"`
+	UpdatedAt    time.Time        `json:"updated_at"`
+}
+
+// PermissionNames returns the names of the permissions loaded with the role.
+func (r *Role) PermissionNames() []string {
+	names := make([]string, 0, len(r.Permissions))
+	for _, p := range r.Permissions {
+		names = append(names, p.Permission)
+	}
+	return names
+}
+
+// RolePermission grants a permission to a role.
+type RolePermission struct {
+	Role       string `gorm:"primaryKey;size:20"`
+	Permission string `gorm:"primaryKey;size:64"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// SigningKey is a private key that signs access tokens, stored as PKCS#8 PEM.
+// The newest key that is not retired signs new tokens. Retired keys stay
+// published for verification until the overlap period ends and are then deleted.
+type SigningKey struct {
+	KID        string     `gorm:"primaryKey;size:64" json:"kid"`
+	Algorithm  string     `gorm:"size:16;not null" json:"alg"`
+	PrivateKey string     `gorm:"type:text;not null" json:"-"`
+	CreatedAt  time.Time  `gorm:"not null" json:"created_at"`
+	RetiredAt  *time.Time `gorm:"index" json:"retired_at,omitempty"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// RecoveryCode is a single-use code that replaces a TOTP code when the
+// authenticator is lost. Only the SHA-256 hash of the code is stored.
+type RecoveryCode struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"index;not null" json:"user_id"`
+	CodeHash  string     `gorm:"size:64;not null" json:"-"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// LoginChallenge is the second step of a login that needs a TOTP code. The
+// client gets the opaque token after the password check; only its hash is
+// stored. Attempts counts wrong codes.
+type LoginChallenge struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"index;not null" json:"user_id"`
+	TokenHash string     `gorm:"size:64;uniqueIndex;not null" json:"-"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	Attempts  int        `gorm:"not null;default:0" json:"attempts"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// TwoFactorPolicy records whether users of a role must use two-factor
+// authentication. Roles without a row do not require it.
+type TwoFactorPolicy struct {
+	Role      string    `gorm:"primaryKey;size:20" json:"role"`
+	Required  bool      `gorm:"not null" json:"required"`
+	UpdatedBy uint      `json:"updated_by"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
@@ -19,4 +19,60 @@ type User struct {
 	IsApproved   bool      `gorm:"not null;default:false" json:"is_approved"`
 	CreatedAt    time.Time `gorm:"autoCreateTime" json:"created_at"`
 	GSTNum       string    `gorm:"column:gstnumber" json:"gstnumber"`
+	// EmailVerifiedAt is set once the user followed the verification link.
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	// VerificationSentAt is when the last verification email was sent; it throttles resends.
+	VerificationSentAt *time.Time `json:"verification_sent_at,omitempty"`
+	// TOTPSecret is the base32 TOTP secret; set but not yet enabled during enrolment.
+	TOTPSecret string `gorm:"size:64" json:"-"`
+	// TOTPEnabledAt is set once enrolment was confirmed with a valid code.
+	TOTPEnabledAt *time.Time `json:"totp_enabled_at"`
+	// TOTPLastStep is the time step of the last accepted code, preventing replay.
+	TOTPLastStep int64 `gorm:"not null;default:0" json:"-"`
+	// LockedUntil is set when the account was locked after too many failed logins.
+	LockedUntil *time.Time `json:"locked_until,omitempty"`
+	// DeletedAt is set when the user deleted their account. The row is kept,
+	// anonymized, so IDs referenced by other services stay unique.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// SuspendedAt is set while an administrator has suspended the account.
+	SuspendedAt      *time.Time `json:"suspended_at,omitempty"`
+	SuspensionReason string     `gorm:"size:255" json:"suspension_reason,omitempty"`
+	// RejectedAt is set when the application for a role that requires
+	// approval was rejected; approving the account later clears it.
+	RejectedAt      *time.Time `json:"rejected_at,omitempty"`
+	RejectionReason string     `gorm:"size:255" json:"rejection_reason,omitempty"`
+	// WebhookURL receives the user's notifications on the webhook channel,
+	// signed with WebhookSecret.
+	WebhookURL    string `gorm:"size:512" json:"-"`
+	WebhookSecret string `gorm:"size:64" json:"-"`
+}
+
+// Suspended reports whether an administrator has suspended the account.
+func (u *User) Suspended() bool {
+	return u.SuspendedAt != nil
+}
+
+// Rejected reports whether the application for the user's role was rejected.
+func (u *User) Rejected() bool {
+	return u.RejectedAt != nil
+}
+
+// Deleted reports whether the user deleted their account.
+func (u *User) Deleted() bool {
+	return u.DeletedAt != nil
+}
+
+// Locked reports whether the account is locked at now.
+func (u *User) Locked(now time.Time) bool {
+	return u.LockedUntil != nil && u.LockedUntil.After(now)
+}
+
+// TwoFactorEnabled reports whether the user logs in with a TOTP code.
+func (u *User) TwoFactorEnabled() bool {
+	return u.TOTPEnabledAt != nil
+}
+
+// EmailVerified reports whether the user has verified their email address.
+func (u *User) EmailVerified() bool {
+	return u.EmailVerifiedAt != nil
 }
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// User event types.
+const (
+	UserEventDeleted = "user.deleted"
+)
+
+// UserEvent records a change to a user account that other services act on,
+// e.g. a deleted account whose products and pending orders must go. The
+// services poll the events incrementally using ID as cursor.
+type UserEvent struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"index;not null" json:"user_id"`
+	Type      string    `gorm:"size:32;not null" json:"type"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
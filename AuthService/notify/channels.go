@@ -0,0 +1,261 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"authservice/config"
+	"authservice/mailer"
+	"authservice/models"
+)
+
+// Webhook drivers selectable with WEBHOOK_DRIVER.
+const (
+	WebhookDriverHTTP = "http"
+	WebhookDriverFile = "file"
+)
+
+// SignatureHeader carries the HMAC-SHA256 of a webhook body, keyed with the
+// user's webhook secret, as "sha256=<hex>".
+const SignatureHeader = "X-Webhook-Signature"
+
+// webhookTimeout bounds one webhook request.
+const webhookTimeout = 10 * time.Second
+
+// errPermanent marks delivery errors that retrying cannot fix.
+var errPermanent = errors.New("permanent delivery error")
+
+// Channel delivers a notification to a user outside the app.
+type Channel interface {
+	Deliver(ctx context.Context, user *models.User, n *models.Notification) error
+}
+
+// channels are the delivery channels by name, set up by Init.
+var channels = map[string]Channel{
+	models.ChannelEmail:   emailChannel{},
+	models.ChannelWebhook: &httpWebhook{client: newWebhookClient(false)},
+}
+
+// Init sets up the webhook channel configured by WEBHOOK_DRIVER. Emails go
+// through the mailer configured by MAIL_DRIVER.
+func Init(c config.Config) error {
+	switch c.WebhookDriver {
+	case "", WebhookDriverHTTP:
+		channels[models.ChannelWebhook] = &httpWebhook{client: newWebhookClient(c.WebhookAllowPrivate)}
+	case WebhookDriverFile:
+		channels[models.ChannelWebhook] = &fileWebhook{path: c.WebhookFile}
+	default:
+		return fmt.Errorf("unknown WEBHOOK_DRIVER %q", c.WebhookDriver)
+	}
+	return nil
+}
+
+// Use replaces the channel named name, e.g. with a fake in tests.
+func Use(name string, ch Channel) { channels[name] = ch }
+
+// emailChannel sends notifications as plain text email.
+type emailChannel struct{}
+
+// Deliver emails n to the user's address.
+func (emailChannel) Deliver(ctx context.Context, user *models.User, n *models.Notification) error {
+	return mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: truncate(n.Message, 78),
+		Body: fmt.Sprintf("Hello %s,\n\n%s\n\nYou can choose how you are notified in your notification preferences.\n",
+			user.Name, n.Message),
+	})
+}
+
+// webhookEvent is the JSON body posted to webhooks.
+type webhookEvent struct {
+	ID        uint            `json:"id"`
+	UserID    uint            `json:"user_id"`
+	Type      string          `json:"type"`
+	Message   string          `json:"message"`
+	Payload   json.RawMessage `json:"payload,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// webhookBody encodes n as posted to webhooks.
+func webhookBody(n *models.Notification) ([]byte, error) {
+	return json.Marshal(webhookEvent{
+		ID:        n.ID,
+		UserID:    n.UserID,
+		Type:      n.Type,
+		Message:   n.Message,
+		Payload:   n.Payload,
+		CreatedAt: n.CreatedAt,
+	})
+}
+
+// Sign returns the SignatureHeader value of body for secret.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// httpWebhook posts notifications to the user's webhook URL. Responses other
+// than 2xx are failures.
+type httpWebhook struct {
+	client *http.Client
+}
+
+// Deliver posts n, signed with the user's secret, to the user's webhook URL.
+func (w *httpWebhook) Deliver(ctx context.Context, user *models.User, n *models.Notification) error {
+	if user.WebhookURL == "" {
+		return permanentError("no webhook url")
+	}
+	body, err := webhookBody(n)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, user.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%w: %v", errPermanent, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, Sign(user.WebhookSecret, body))
+	req.Header.Set("X-Webhook-Event", n.Type)
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	return nil
+}
+
+// newWebhookClient returns the client of the http webhook channel. Unless
+// allowPrivate is set it refuses to connect to addresses that are not public
+// (see publicAddr), so users cannot make the service call internal hosts.
+// Redirects are not followed.
+func newWebhookClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	if !allowPrivate {
+		dialer.Control = func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if addr, err := netip.ParseAddr(host); err != nil || !publicAddr(addr) {
+				return fmt.Errorf("%w: webhook address %s is not public", errPermanent, host)
+			}
+			return nil
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// CheckWebhookURL reports why raw cannot be used as a webhook URL: it must be
+// an absolute http or https URL and, unless allowPrivate is set, must not
+// name a loopback or private address. Host names are checked again when the
+// webhook is called, after they are resolved.
+func CheckWebhookURL(raw string, allowPrivate bool) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("webhook url must be an absolute http or https url")
+	}
+	if u.User != nil {
+		return errors.New("webhook url must not contain credentials")
+	}
+	if allowPrivate {
+		return nil
+	}
+	host := u.Hostname()
+	if addr, err := netip.ParseAddr(host); (err == nil && !publicAddr(addr)) || strings.EqualFold(host, "localhost") {
+		return errors.New("webhook url must not point to a private address")
+	}
+	return nil
+}
+
+// nonPublicPrefixes are unicast ranges that IsGlobalUnicast and IsPrivate do
+// not rule out but that are not reachable on the internet.
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),     // "this network"
+	netip.MustParsePrefix("100.64.0.0/10"), // carrier-grade NAT
+}
+
+// publicAddr reports whether addr is routable on the internet. IPv4-mapped
+// IPv6 addresses are judged by the IPv4 address they carry.
+func publicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+	for _, p := range nonPublicPrefixes {
+		if p.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// fileWebhook appends the webhook requests it would send to a file, one JSON
+// object per line, for local development and tests.
+type fileWebhook struct {
+	path string
+
+	mu sync.Mutex
+}
+
+// Deliver appends the URL, signature and body of the request for n.
+func (w *fileWebhook) Deliver(_ context.Context, user *models.User, n *models.Notification) error {
+	if user.WebhookURL == "" {
+		return permanentError("no webhook url")
+	}
+	body, err := webhookBody(n)
+	if err != nil {
+		return err
+	}
+	line, err := json.Marshal(struct {
+		URL       string          `json:"url"`
+		Signature string          `json:"signature"`
+		Body      json.RawMessage `json:"body"`
+	}{user.WebhookURL, Sign(user.WebhookSecret, body), body})
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("open webhook file: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("write webhook file: %w", err)
+	}
+	return nil
+}
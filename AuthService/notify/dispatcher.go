@@ -0,0 +1,179 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+
+	"authservice/config"
+	"authservice/database"
+	"authservice/metrics"
+	"authservice/models"
+)
+
+const (
+	// dispatchBatchSize is how many due deliveries are loaded at a time.
+	dispatchBatchSize = 50
+	// deliveryLease postpones a claimed delivery so other instances skip it
+	// while it is being sent; it is retried after the lease if this instance
+	// dies meanwhile.
+	deliveryLease = 2 * time.Minute
+	// deliveryTimeout bounds one delivery attempt.
+	deliveryTimeout = 30 * time.Second
+	// maxRetryDelay caps the backoff between attempts.
+	maxRetryDelay = time.Hour
+)
+
+// dispatcherWake has room for one signal, so a burst of queued deliveries
+// wakes the dispatcher once.
+var dispatcherWake = make(chan struct{}, 1)
+
+// wakeDispatcher tells the dispatcher of this instance that deliveries were
+// queued. Like stream wake-ups it may fire before the transaction commits;
+// the dispatcher polls as well.
+func wakeDispatcher() {
+	select {
+	case dispatcherWake <- struct{}{}:
+	default:
+	}
+}
+
+// RunDispatcher delivers due email and webhook deliveries, every interval and
+// whenever deliveries are queued, until ctx is done. Failed attempts are
+// retried after NOTIFICATION_RETRY_BASE, doubling up to an hour, until
+// NOTIFICATION_MAX_ATTEMPTS. Several instances may run it on one database:
+// each delivery is claimed before it is sent.
+func RunDispatcher(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-dispatcherWake:
+			// Give the transaction that queued the deliveries time to commit
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(200 * time.Millisecond):
+			}
+		}
+		dispatchDue(ctx)
+	}
+}
+
+// dispatchDue sends the deliveries that are due, batch by batch.
+func dispatchDue(ctx context.Context) {
+	for ctx.Err() == nil {
+		var due []models.NotificationDelivery
+		err := database.DB.WithContext(ctx).
+			Where("status = ? AND next_attempt_at <= ?", models.DeliveryPending, time.Now().UTC()).
+			Order("next_attempt_at, id").Limit(dispatchBatchSize).Find(&due).Error
+		if err != nil {
+			if !errors.Is(err, context.Canceled) {
+				slog.WarnContext(ctx, "load due notification deliveries failed", "error", err)
+			}
+			return
+		}
+		for i := range due {
+			if ctx.Err() != nil {
+				return
+			}
+			dispatch(ctx, &due[i])
+		}
+		if len(due) < dispatchBatchSize {
+			return
+		}
+	}
+}
+
+// dispatch claims d and, unless another instance got it first, attempts it
+// and records the outcome.
+func dispatch(ctx context.Context, d *models.NotificationDelivery) {
+	now := time.Now().UTC()
+	res := database.DB.WithContext(ctx).Model(&models.NotificationDelivery{}).
+		Where("id = ? AND status = ? AND attempts = ? AND next_attempt_at <= ?",
+			d.ID, models.DeliveryPending, d.Attempts, now).
+		Update("next_attempt_at", now.Add(deliveryLease))
+	if res.Error != nil || res.RowsAffected == 0 {
+		return
+	}
+
+	err := deliver(ctx, d)
+	if ctx.Err() != nil {
+		// Shutting down; the lease expires and the delivery is retried
+		return
+	}
+	d.Attempts++
+	done := time.Now().UTC()
+	updates := map[string]interface{}{"attempts": d.Attempts, "next_attempt_at": done}
+	result := metrics.DeliverySent
+	switch {
+	case err == nil:
+		updates["status"] = models.DeliverySent
+		updates["sent_at"] = &done
+		updates["last_error"] = ""
+	case errors.Is(err, errPermanent) || d.Attempts >= config.Get().NotificationMaxAttempts:
+		result = metrics.DeliveryFailed
+		updates["status"] = models.DeliveryFailed
+		updates["last_error"] = truncate(err.Error(), 255)
+	default:
+		result = metrics.DeliveryRetry
+		updates["next_attempt_at"] = done.Add(retryDelay(d.Attempts))
+		updates["last_error"] = truncate(err.Error(), 255)
+	}
+	metrics.NotificationDelivery(d.Channel, result)
+	if err != nil {
+		slog.WarnContext(ctx, "notification delivery failed",
+			"delivery_id", d.ID, "channel", d.Channel, "attempts", d.Attempts, "result", result, "error", err)
+	}
+	if err := database.DB.WithContext(ctx).Model(d).Updates(updates).Error; err != nil {
+		slog.WarnContext(ctx, "record notification delivery failed", "delivery_id", d.ID, "error", err)
+	}
+}
+
+// deliver sends the notification of d on its channel.
+func deliver(ctx context.Context, d *models.NotificationDelivery) error {
+	channel, ok := channels[d.Channel]
+	if !ok {
+		return permanentError("unknown channel " + d.Channel)
+	}
+	var n models.Notification
+	if err := database.DB.WithContext(ctx).First(&n, d.NotificationID).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		return permanentError("notification deleted")
+	} else if err != nil {
+		return err
+	}
+	var user models.User
+	if err := database.DB.WithContext(ctx).First(&user, d.UserID).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		return permanentError("user not found")
+	} else if err != nil {
+		return err
+	}
+	if user.Deleted() {
+		return permanentError("account deleted")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, deliveryTimeout)
+	defer cancel()
+	return channel.Deliver(ctx, &user, &n)
+}
+
+// permanentError returns a delivery error that is not retried.
+func permanentError(reason string) error {
+	return fmt.Errorf("%w: %s", errPermanent, reason)
+}
+
+// retryDelay is the wait after the given number of failed attempts.
+func retryDelay(attempts int) time.Duration {
+	delay := config.Get().NotificationRetryBase
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryDelay)
+}
@@ -0,0 +1,192 @@
+// Package notify stores the notifications of users, wakes their open
+// notification streams, queues email and webhook deliveries according to the
+// users' preferences and deletes read notifications once they are older than
+// NOTIFICATION_RETENTION.
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"authservice/config"
+	"authservice/database"
+	"authservice/models"
+)
+
+// maxMessageLen is the size of the message column.
+const maxMessageLen = 255
+
+// Create stores a notification of type typ for userID using tx. payload, when
+// not nil, is stored as JSON so clients can link to what the notification is
+// about. Messages longer than the column are shortened. The notification goes
+// to the channels the user chose for typ: open streams of the user are woken
+// and email and webhook deliveries are queued.
+func Create(tx *gorm.DB, userID uint, typ, message string, payload any) error {
+	_, _, err := store(tx, userID, typ, message, payload, nil)
+	return err
+}
+
+// CreateOnce stores a notification like Create unless the user already has
+// one with dedupKey. It returns the ID of the stored notification, or of the
+// existing one, and whether it was stored now.
+func CreateOnce(tx *gorm.DB, userID uint, typ, message string, payload any, dedupKey string) (uint, bool, error) {
+	return store(tx, userID, typ, message, payload, &dedupKey)
+}
+
+// store saves a notification, without a duplicate when dedupKey is set, and
+// queues its deliveries.
+func store(tx *gorm.DB, userID uint, typ, message string, payload any, dedupKey *string) (uint, bool, error) {
+	var user models.User
+	if err := tx.First(&user, userID).Error; err != nil {
+		return 0, false, err
+	}
+	prefs, err := Preferences(tx, userID, typ)
+	if err != nil {
+		return 0, false, err
+	}
+
+	n := &models.Notification{
+		UserID:   userID,
+		Type:     typ,
+		Message:  truncate(message, maxMessageLen),
+		DedupKey: dedupKey,
+		Hidden:   !prefs.InApp,
+	}
+	if payload != nil {
+		raw, err := json.Marshal(payload)
+		if err != nil {
+			return 0, false, err
+		}
+		n.Payload = raw
+	}
+	if dedupKey == nil {
+		if err := tx.Create(n).Error; err != nil {
+			return 0, false, err
+		}
+	} else {
+		res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(n)
+		if res.Error != nil {
+			return 0, false, res.Error
+		}
+		if res.RowsAffected == 0 {
+			var existing models.Notification
+			err := tx.Select("id").Where("user_id = ? AND dedup_key = ?", userID, *dedupKey).First(&existing).Error
+			return existing.ID, false, err
+		}
+	}
+
+	var deliveries []models.NotificationDelivery
+	now := time.Now().UTC()
+	for _, channel := range deliveryChannels(&user, prefs) {
+		deliveries = append(deliveries, models.NotificationDelivery{
+			NotificationID: n.ID,
+			UserID:         userID,
+			Channel:        channel,
+			Status:         models.DeliveryPending,
+			NextAttemptAt:  now,
+		})
+	}
+	if len(deliveries) > 0 {
+		if err := tx.Create(&deliveries).Error; err != nil {
+			return 0, false, err
+		}
+		wakeDispatcher()
+	}
+	if !n.Hidden {
+		wakeStreams(userID)
+	}
+	return n.ID, true, nil
+}
+
+// deliveryChannels returns the channels other than in-app a notification for
+// user with prefs is delivered on. Email needs a verified address and webhooks
+// a registered URL.
+func deliveryChannels(user *models.User, prefs models.NotificationPreference) []string {
+	var channels []string
+	if prefs.Email && user.EmailVerified() && !user.Deleted() {
+		channels = append(channels, models.ChannelEmail)
+	}
+	if prefs.Webhook && user.WebhookURL != "" && !user.Deleted() {
+		channels = append(channels, models.ChannelWebhook)
+	}
+	return channels
+}
+
+// DefaultPreference is the preference of a user who chose no channels for typ:
+// in-app only. Email and webhook delivery are opt-in.
+func DefaultPreference(typ string) models.NotificationPreference {
+	return models.NotificationPreference{Type: typ, InApp: true}
+}
+
+// Preferences returns the channels userID gets notifications of typ on: the
+// preference for typ, else the one for all types, else DefaultPreference.
+func Preferences(tx *gorm.DB, userID uint, typ string) (models.NotificationPreference, error) {
+	var prefs []models.NotificationPreference
+	if err := tx.Where("user_id = ? AND type IN ?", userID, []string{typ, models.AllNotificationTypes}).
+		Find(&prefs).Error; err != nil {
+		return models.NotificationPreference{}, err
+	}
+	effective := DefaultPreference(typ)
+	for _, p := range prefs {
+		if p.Type == typ {
+			return p, nil
+		}
+		effective = p
+		effective.Type = typ
+	}
+	return effective, nil
+}
+
+// Run deletes read and hidden notifications, and finished deliveries, older
+// than the retention every interval until ctx is done. A retention of zero
+// keeps them forever. Open streams are
+// closed when ctx is done so they do not hold up shutdown.
+func Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			closeStreams()
+			return
+		case <-ticker.C:
+			retention := config.Get().NotificationRetention
+			if retention == 0 {
+				continue
+			}
+			cutoff := time.Now().UTC().Add(-retention)
+			res := database.DB.WithContext(ctx).
+				Where("(is_read = ? AND read_at < ?) OR (hidden = ? AND created_at < ?)", true, cutoff, true, cutoff).
+				Delete(&models.Notification{})
+			if res.Error != nil && !errors.Is(res.Error, context.Canceled) {
+				slog.WarnContext(ctx, "prune read notifications failed", "error", res.Error)
+			} else if res.RowsAffected > 0 {
+				slog.InfoContext(ctx, "pruned read notifications", "count", res.RowsAffected)
+			}
+			res = database.DB.WithContext(ctx).
+				Where("status <> ? AND updated_at < ?", models.DeliveryPending, cutoff).
+				Delete(&models.NotificationDelivery{})
+			if res.Error != nil && !errors.Is(res.Error, context.Canceled) {
+				slog.WarnContext(ctx, "prune notification deliveries failed", "error", res.Error)
+			}
+		}
+	}
+}
+
+// truncate shortens s to at most n bytes without splitting a UTF-8 sequence.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
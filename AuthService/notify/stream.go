@@ -0,0 +1,70 @@
+package notify
+
+import "sync"
+
+// Open notification streams of this instance, by user. Each stream has a
+// wake channel with room for one signal, so a burst of notifications wakes
+// it once.
+var (
+	streamsMu     sync.Mutex
+	streams       = map[uint]map[chan struct{}]struct{}{}
+	streamsClosed bool
+)
+
+// Subscribe registers an open notification stream of userID. The channel
+// receives a signal when a notification is created for the user by this
+// instance and is closed when the service shuts down. Signals are only hints:
+// they may arrive before the creating transaction commits, and notifications
+// created by other instances send none, so streams poll as well. Call cancel
+// once the stream ends.
+func Subscribe(userID uint) (wake <-chan struct{}, cancel func()) {
+	ch := make(chan struct{}, 1)
+
+	streamsMu.Lock()
+	defer streamsMu.Unlock()
+	if streamsClosed {
+		close(ch)
+		return ch, func() {}
+	}
+	if streams[userID] == nil {
+		streams[userID] = map[chan struct{}]struct{}{}
+	}
+	streams[userID][ch] = struct{}{}
+
+	return ch, func() {
+		streamsMu.Lock()
+		defer streamsMu.Unlock()
+		if _, ok := streams[userID][ch]; ok {
+			delete(streams[userID], ch)
+			if len(streams[userID]) == 0 {
+				delete(streams, userID)
+			}
+		}
+	}
+}
+
+// wakeStreams signals the open streams of userID without blocking.
+func wakeStreams(userID uint) {
+	streamsMu.Lock()
+	defer streamsMu.Unlock()
+	for ch := range streams[userID] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// closeStreams closes the wake channel of every open stream, ending the
+// streams, and refuses new ones.
+func closeStreams() {
+	streamsMu.Lock()
+	defer streamsMu.Unlock()
+	streamsClosed = true
+	for userID, chans := range streams {
+		for ch := range chans {
+			close(ch)
+		}
+		delete(streams, userID)
+	}
+}
@@ -0,0 +1,46 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"authservice/models"
+)
+
+// ErrNoTemplate is returned by Render for types that other services cannot send.
+var ErrNoTemplate = errors.New("no message template for notification type")
+
+// templates render the messages of the notifications other services send,
+// by type, from the notification payload.
+var templates = parseTemplates(map[string]string{
+	models.NotificationOrderPlaced:        "Your order #{{.order_id}} for {{.quantity}} x {{.product_name}} has been placed",
+	models.NotificationOrderReceived:      "New order #{{.order_id}}: {{.quantity}} x {{.product_name}}",
+	models.NotificationOrderStatusChanged: "Your order #{{.order_id}} is now {{.status}}",
+	models.NotificationLowStock:           "{{.product_name}} is running low: {{.quantity}} left in stock",
+})
+
+// Render returns the message of a notification of type typ, filled in from
+// payload. Every field the template uses must be in payload.
+func Render(typ string, payload map[string]any) (string, error) {
+	t, ok := templates[typ]
+	if !ok {
+		return "", fmt.Errorf("%w %q", ErrNoTemplate, typ)
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, payload); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// parseTemplates parses message templates by type. Every field a template
+// uses is required.
+func parseTemplates(texts map[string]string) map[string]*template.Template {
+	parsed := make(map[string]*template.Template, len(texts))
+	for typ, text := range texts {
+		parsed[typ] = template.Must(template.New(typ).Option("missingkey=error").Parse(text))
+	}
+	return parsed
+}
@@ -0,0 +1,114 @@
+// Package tracing configures OpenTelemetry tracing and W3C trace context
+// propagation for the auth service.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// Span exporters selected by OTEL_TRACES_EXPORTER.
+const (
+	ExporterNone   = "none"
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+	ExporterFile   = "file"
+)
+
+// Setup installs the W3C traceparent/baggage propagator and a tracer provider
+// for service. OTEL_TRACES_EXPORTER selects where spans go:
+//
+//   - none (default): nothing is recorded, incoming trace context is still forwarded
+//   - otlp: OTLP over HTTP, configured by the standard OTEL_EXPORTER_OTLP_* variables
+//   - stdout: one JSON span per line on stdout
+//   - file: one JSON span per line appended to OTEL_TRACES_FILE (default <service>-traces.json)
+//
+// Sampling follows OTEL_TRACES_SAMPLER. The returned function flushes pending
+// spans and must be called on shutdown.
+func Setup(ctx context.Context, service string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{},
+	))
+
+	exporter, err := newExporter(ctx, service)
+	if err != nil || exporter == nil {
+		return func(context.Context) error { return nil }, err
+	}
+
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES override the defaults
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName(service)),
+		resource.WithTelemetrySDK(),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		_ = exporter.Shutdown(ctx)
+		return nil, fmt.Errorf("tracing resource: %w", err)
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
+
+// newExporter builds the exporter named by OTEL_TRACES_EXPORTER, or nil for none.
+func newExporter(ctx context.Context, service string) (sdktrace.SpanExporter, error) {
+	switch name := strings.ToLower(strings.TrimSpace(os.Getenv("OTEL_TRACES_EXPORTER"))); name {
+	case "", ExporterNone:
+		return nil, nil
+	case ExporterOTLP:
+		return otlptracehttp.New(ctx)
+	case ExporterStdout, "console":
+		return stdouttrace.New()
+	case ExporterFile:
+		path := os.Getenv("OTEL_TRACES_FILE")
+		if path == "" {
+			path = service + "-traces.json"
+		}
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("open trace file: %w", err)
+		}
+		exp, err := stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return &fileExporter{SpanExporter: exp, file: f}, nil
+	default:
+		return nil, fmt.Errorf("unknown OTEL_TRACES_EXPORTER %q", name)
+	}
+}
+
+// fileExporter closes the trace file once the wrapped exporter is shut down.
+type fileExporter struct {
+	sdktrace.SpanExporter
+	file *os.File
+}
+
+func (e *fileExporter) Shutdown(ctx context.Context) error {
+	return errors.Join(e.SpanExporter.Shutdown(ctx), e.file.Close())
+}
+
+// ShouldTrace excludes health probes and metric scrapes from tracing.
+func ShouldTrace(r *http.Request) bool {
+	switch r.URL.Path {
+	case "/Check", "/healthz", "/readyz", "/metrics":
+		return false
+	}
+	return true
+}
@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"authservice/config"
+)
+
+// IdentityHeader carries the identity assertion signed by the API gateway.
+const IdentityHeader = "X-Gateway-Identity"
+
+// ParseIdentityAssertion verifies a gateway identity assertion and returns its claims.
+// Assertions are HS256 tokens signed with GATEWAY_IDENTITY_SECRET, issued by
+// "api-gateway" for the "internal" audience.
+func ParseIdentityAssertion(assertion string) (*Claims, error) {
+	c := config.Get()
+	if c.GatewayIdentitySecret == "" {
+		return nil, errors.New("gateway identity not configured")
+	}
+	token, err := jwt.ParseWithClaims(assertion, &Claims{}, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(c.GatewayIdentitySecret), nil
+	}, jwt.WithIssuer("api-gateway"), jwt.WithAudience("internal"), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, err
+	}
+	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
+		return claims, nil
+	}
+	return nil, errors.New("invalid identity assertion")
+}
@@ -7,36 +7,57 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 
 	"authservice/config"
+	"authservice/keys"
 )
 
 // Claims represents JWT claims used in tokens.
 type Claims struct {
 	UserID uint   `json:"user_id"`
 	Role   string `json:"role"`
+	// Permissions are those of the role when the token was issued.
+	Permissions   []string `json:"permissions"`
+	EmailVerified bool     `json:"email_verified"`
+	// IssuedAtMs is iat in milliseconds, precise enough to order the token
+	// against session revocations.
+	IssuedAtMs int64 `json:"iat_ms,omitempty"`
+	// Set on gateway identity assertions only: the access token the identity
+	// was taken from.
+	TokenID         string           `json:"token_jti,omitempty"`
+	TokenIssuedAt   *jwt.NumericDate `json:"token_iat,omitempty"`
+	TokenIssuedAtMs int64            `json:"token_iat_ms,omitempty"`
+	TokenExpiresAt  *jwt.NumericDate `json:"token_exp,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// GenerateToken creates a JWT for the given user id and role.
-func GenerateToken(userID uint, role string) (string, error) {
+// GenerateToken creates a JWT for the given user id, role, permissions and email
+// verification status, signed with the active signing key. Each token gets a unique jti so it can be revoked individually.
+func GenerateToken(userID uint, role string, permissions []string, emailVerified bool) (string, error) {
 	c := config.Get()
+	jti, err := NewTokenID()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
 	claims := &Claims{
-		UserID: userID,
-		Role:   role,
+		UserID:        userID,
+		Role:          role,
+		Permissions:   permissions,
+		EmailVerified: emailVerified,
+		IssuedAtMs:    now.UnixMilli(),
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(c.JWTExpiry)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ID:        jti,
+			ExpiresAt: jwt.NewNumericDate(now.Add(c.JWTExpiry)),
+			IssuedAt:  jwt.NewNumericDate(now),
 		},
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(c.JWTSecret))
+	return keys.Sign(claims)
 }
 
-// ParseToken validates a token string and returns the Claims if valid.
+// ParseToken validates a token string against the published signing keys and
+// returns the Claims if valid.
 func ParseToken(tokenStr string) (*Claims, error) {
-	c := config.Get()
-	token, err := jwt.ParseWithClaims(tokenStr, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(c.JWTSecret), nil
-	})
+	token, err := jwt.ParseWithClaims(tokenStr, &Claims{}, keys.Keyfunc,
+		jwt.WithValidMethods([]string{keys.AlgRS256, keys.AlgEdDSA}))
 	if err != nil {
 		return nil, err
 	}
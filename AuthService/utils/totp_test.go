@@ -0,0 +1,128 @@
+package utils
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 seed of the RFC 6238 test vectors, base32 encoded.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	key, err := totpEncoding.DecodeString(rfcSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, tt := range tests {
+		if got := totpCode(key, tt.unix/totpPeriod); got != tt.want {
+			t.Errorf("code at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestVerifyTOTP(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	step := now.Unix() / totpPeriod
+	key, _ := totpEncoding.DecodeString(rfcSecret)
+	codeAt := func(s int64) string { return totpCode(key, s) }
+
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		lastStep int64
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current step", rfcSecret, codeAt(step), 0, step, true},
+		{"previous step", rfcSecret, codeAt(step - 1), 0, step - 1, true},
+		{"next step", rfcSecret, codeAt(step + 1), 0, step + 1, true},
+		{"outside skew", rfcSecret, codeAt(step - 2), 0, 0, false},
+		{"surrounding spaces", rfcSecret, " " + codeAt(step) + " ", 0, step, true},
+		{"lower-case secret", strings.ToLower(rfcSecret), codeAt(step), 0, step, true},
+		{"replayed step", rfcSecret, codeAt(step), step, 0, false},
+		{"older than last step", rfcSecret, codeAt(step - 1), step - 1, 0, false},
+		{"later than last step", rfcSecret, codeAt(step + 1), step, step + 1, true},
+		{"wrong code", rfcSecret, "000000", 0, 0, false},
+		{"too short", rfcSecret, codeAt(step)[:5], 0, 0, false},
+		{"invalid secret", "not base32!", codeAt(step), 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotStep, ok := VerifyTOTP(tt.secret, tt.code, tt.lastStep, now)
+			if ok != tt.wantOK || gotStep != tt.wantStep {
+				t.Fatalf("VerifyTOTP() = %d, %v; want %d, %v", gotStep, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestNewTOTPSecret(t *testing.T) {
+	a, err := NewTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := NewTOTPSecret()
+	if a == b {
+		t.Fatal("two secrets are equal")
+	}
+	if key, err := totpEncoding.DecodeString(a); err != nil || len(key) != 20 {
+		t.Fatalf("secret %q decodes to %d bytes, %v; want 20", a, len(key), err)
+	}
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+	u, err := url.Parse(TOTPProvisioningURI("Shop", "ann@example.com", rfcSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/Shop:ann@example.com" {
+		t.Errorf("uri = %s, want otpauth://totp/Shop:ann@example.com", u)
+	}
+	q := u.Query()
+	for param, want := range map[string]string{
+		"secret": rfcSecret, "issuer": "Shop", "algorithm": "SHA1", "digits": "6", "period": "30",
+	} {
+		if got := q.Get(param); got != want {
+			t.Errorf("%s = %q, want %q", param, got, want)
+		}
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, hashes, err := NewRecoveryCodes(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != 10 || len(hashes) != 10 {
+		t.Fatalf("got %d codes and %d hashes, want 10", len(codes), len(hashes))
+	}
+	seen := map[string]bool{}
+	for i, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Errorf("code %q is not formatted xxxxx-xxxxx", code)
+		}
+		if seen[code] {
+			t.Errorf("code %q repeated", code)
+		}
+		seen[code] = true
+		// Users may type codes without the dash, in upper case or with spaces
+		for _, typed := range []string{code, strings.ToUpper(code), strings.ReplaceAll(code, "-", " ")} {
+			if HashRecoveryCode(typed) != hashes[i] {
+				t.Errorf("%q does not match the hash of %q", typed, code)
+			}
+		}
+	}
+}
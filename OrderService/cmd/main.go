@@ -1,29 +1,57 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 
+	"authclient/jwks"
+	"authclient/notify"
+	"authclient/revocation"
+	"authclient/userevents"
 	"orderservice/internal/db"
 	"orderservice/internal/handlers"
+	"orderservice/internal/health"
+	"orderservice/internal/logging"
+	"orderservice/internal/metrics"
 	"orderservice/internal/middleware"
 	"orderservice/internal/repo"
 	"orderservice/internal/service"
+	"orderservice/internal/tracing"
 )
 
 func main() {
 	// Load .env file
-	if err := godotenv.Load(); err != nil {
+	envErr := godotenv.Load()
+
+	// Structured JSON logs; the standard log package is routed through slog too
+	logging.Setup("order-service")
+	if envErr != nil {
 		log.Println("No .env file found, using environment variables")
 	}
 
 	// Validate required environment variables
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		log.Fatal("JWT_SECRET environment variable is required")
+	jwksURL := os.Getenv("JWKS_URL")
+	if jwksURL == "" {
+		log.Fatal("JWKS_URL environment variable is required")
+	}
+	// Optional: accept identity assertions signed by the API gateway
+	identitySecret := os.Getenv("GATEWAY_IDENTITY_SECRET")
+
+	// AuthService's /internal endpoints are guarded by this token alone; without
+	// it the feeds and notifications served there are not used
+	internalToken := os.Getenv("INTERNAL_API_TOKEN")
+	if internalToken == "" {
+		log.Println("INTERNAL_API_TOKEN not set; Auth Service's internal endpoints are not used")
 	}
 
 	productServiceURL := os.Getenv("PRODUCT_SERVICE_URL")
@@ -37,41 +65,127 @@ func main() {
 		port = "8003"
 	}
 
+	// Stop serving and flush traces on SIGINT/SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Tracing exporter is selected by OTEL_TRACES_EXPORTER (none, otlp, stdout, file)
+	shutdownTracing, err := tracing.Setup(ctx, "order-service")
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %v", err)
+	}
+
 	// Initialize database
 	database := db.InitDB()
 
+	// Signing keys are refetched periodically and whenever a token names an unknown kid
+	keys := jwks.NewCache(jwksURL)
+	jwksInterval, err := time.ParseDuration(getEnvOrDefault("JWKS_REFRESH_INTERVAL", "5m"))
+	if err != nil {
+		log.Fatalf("Invalid JWKS_REFRESH_INTERVAL: %v", err)
+	}
+	go keys.Run(ctx, jwksInterval)
+
+	// Token revocation list synced from Auth Service
+	var revocations *revocation.List
+	if feedURL := os.Getenv("REVOCATION_FEED_URL"); feedURL != "" && internalToken != "" {
+		interval, err := time.ParseDuration(getEnvOrDefault("REVOCATION_POLL_INTERVAL", "5s"))
+		if err != nil {
+			log.Fatalf("Invalid REVOCATION_POLL_INTERVAL: %v", err)
+		}
+		revocations = revocation.NewList(feedURL, internalToken)
+		go revocations.Run(ctx, interval)
+	} else {
+		log.Println("REVOCATION_FEED_URL or INTERNAL_API_TOKEN not set; revoked tokens are accepted until they expire")
+	}
+
+	// Buyers and sellers are notified of orders through Auth Service
+	var notifier *notify.Sender
+	if notifyURL := os.Getenv("NOTIFICATIONS_URL"); notifyURL != "" && internalToken != "" {
+		notifier = notify.NewSender(notifyURL, internalToken, logging.RequestID)
+	} else {
+		log.Println("NOTIFICATIONS_URL or INTERNAL_API_TOKEN not set; buyers and sellers are not notified of orders")
+	}
+
 	// Initialize layers (dependency injection)
 	orderRepo := repo.NewOrderRepository(database)
-	orderService := service.NewOrderService(orderRepo, productServiceURL)
+	orderService := service.NewOrderService(orderRepo, productServiceURL, notifier)
 	orderHandler := handlers.NewOrderHandler(orderService)
 
+	// Pending orders of deleted accounts are cancelled as Auth Service reports the deletions
+	if feedURL := os.Getenv("USER_EVENTS_FEED_URL"); feedURL != "" && internalToken != "" {
+		interval, err := time.ParseDuration(getEnvOrDefault("USER_EVENTS_POLL_INTERVAL", "30s"))
+		if err != nil {
+			log.Fatalf("Invalid USER_EVENTS_POLL_INTERVAL: %v", err)
+		}
+		feed := userevents.NewFeed(feedURL, internalToken, map[string]userevents.Handler{
+			userevents.EventDeleted: orderService.CancelUserOrders,
+		})
+		go feed.Run(ctx, interval)
+	} else {
+		log.Println("USER_EVENTS_FEED_URL or INTERNAL_API_TOKEN not set; orders of deleted accounts are kept pending")
+	}
+
 	// Setup Gin router
-	router := gin.Default()
+	router := gin.New()
+	router.Use(otelgin.Middleware("order-service", otelgin.WithFilter(tracing.ShouldTrace)))
+	router.Use(gin.Recovery(), middleware.RequestIDMiddleware(), middleware.LoggingMiddleware(), metrics.Middleware())
 
 	// Check
 	router.GET("/Check", func(c *gin.Context) {
 		c.JSON(200, gin.H{"status": "ok", "service": "order-service"})
 	})
 
+	// Liveness and readiness (database and Product Service reachable)
+	router.GET("/healthz", health.Liveness("order-service"))
+	router.GET("/readyz", health.Readiness("order-service",
+		health.Database(database),
+		health.HTTP("product-service", productServiceURL+"/healthz", &http.Client{}),
+	))
+
+	// Prometheus metrics
+	router.GET("/metrics", metrics.Handler())
+
 	// Protected routes - require authentication
 	authGroup := router.Group("/")
-	authGroup.Use(middleware.AuthMiddleware())
+	authGroup.Use(middleware.AuthMiddleware(keys, identitySecret, revocations))
 	{
-		// Users can create orders and view their own
-		authGroup.POST("/orders", orderHandler.CreateOrder)
-		authGroup.GET("/orders", orderHandler.GetOrders) // Role-based filtering inside handler
+		// Users can create orders (verified email required) and view their own
+		authGroup.POST("/orders", middleware.RequirePermission(middleware.PermOrderCreate),
+			middleware.VerifiedEmailMiddleware(), orderHandler.CreateOrder)
+		authGroup.GET("/orders", orderHandler.GetOrders) // order:read_all sees every order
 		authGroup.GET("/orders/:id", orderHandler.GetOrder)
 
-		// Admin/Super Admin only - update order status
-		adminGroup := authGroup.Group("/")
-		adminGroup.Use(middleware.AdminOnlyMiddleware())
-		{
-			adminGroup.PATCH("/orders/:id/status", orderHandler.UpdateOrderStatus)
+		// order:update_status - update order status
+		authGroup.PATCH("/orders/:id/status", middleware.RequirePermission(middleware.PermOrderUpdateStatus),
+			orderHandler.UpdateOrderStatus)
+	}
+
+	server := &http.Server{Addr: ":" + port, Handler: router}
+	go func() {
+		log.Printf("Order service running on port %s", port)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Failed to start server: %v", err)
 		}
+	}()
+
+	// Drain in-flight requests, then flush buffered spans
+	<-ctx.Done()
+	log.Println("Order service shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Server shutdown failed: %v", err)
 	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		log.Printf("Failed to flush traces: %v", err)
+	}
+}
 
-	log.Printf("Order service running on port %s", port)
-	if err := router.Run(":" + port); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+// getEnvOrDefault returns environment variable value or default if not set.
+func getEnvOrDefault(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
 	}
+	return defaultValue
 }
@@ -7,7 +7,9 @@ import (
 	"github.com/glebarez/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
+	otelgorm "gorm.io/plugin/opentelemetry/tracing"
 
+	"orderservice/internal/logging"
 	"orderservice/internal/models"
 )
 
@@ -17,7 +19,7 @@ func InitDB() *gorm.DB {
 
 	// Open SQLite database
 	db, err := gorm.Open(sqlite.Open(dbPath), &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Info),
+		Logger: logging.NewGormLogger(logger.Info),
 	})
 	if err != nil {
 		log.Fatalf("failed to connect to database: %v", err)
@@ -28,6 +30,11 @@ func InitDB() *gorm.DB {
 		log.Fatalf("failed to migrate database: %v", err)
 	}
 
+	// Record a span for every query from here on; migrations stay untraced
+	if err := db.Use(otelgorm.NewPlugin(otelgorm.WithoutMetrics())); err != nil {
+		log.Fatalf("failed to enable query tracing: %v", err)
+	}
+
 	log.Println("Database initialized successfully")
 	return db
 }
@@ -37,7 +37,7 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 	}
 
 	// Create order
-	order, err := h.service.CreateOrder(userID, &req)
+	order, err := h.service.CreateOrder(c.Request.Context(), userID, &req)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -49,18 +49,12 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 	})
 }
 
-// GetOrders handles GET /orders - get orders based on role.
-// Users see only their orders; Admins see all orders.
+// GetOrders handles GET /orders - get orders based on permissions.
+// Users see only their orders; holders of order:read_all see all orders.
 func (h *OrderHandler) GetOrders(c *gin.Context) {
-	role, err := middleware.GetRole(c)
-	if err != nil {
-		c.JSON(http.StatusForbidden, gin.H{"error": "role not found"})
-		return
-	}
-
-	// Admin/Super Admin can see all orders
-	if role == "saler" || role == "superadmin" {
-		orders, err := h.service.GetAllOrders()
+	// order:read_all can see all orders
+	if middleware.HasPermission(c, middleware.PermOrderReadAll) {
+		orders, err := h.service.GetAllOrders(c.Request.Context())
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch orders"})
 			return
@@ -80,7 +74,7 @@ func (h *OrderHandler) GetOrders(c *gin.Context) {
 		return
 	}
 
-	orders, err := h.service.GetOrdersByUserID(userID)
+	orders, err := h.service.GetOrdersByUserID(c.Request.Context(), userID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch your orders"})
 		return
@@ -101,7 +95,7 @@ func (h *OrderHandler) GetOrder(c *gin.Context) {
 		return
 	}
 
-	order, err := h.service.GetOrderByID(uint(id))
+	order, err := h.service.GetOrderByID(c.Request.Context(), uint(id))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
@@ -109,9 +103,8 @@ func (h *OrderHandler) GetOrder(c *gin.Context) {
 
 	// Authorization check: Users can only view their own orders
 	userID, _ := middleware.GetUserID(c)
-	role, _ := middleware.GetRole(c)
 
-	if role != "saler" && role != "superadmin" && order.UserID != userID {
+	if !middleware.HasPermission(c, middleware.PermOrderReadAll) && order.UserID != userID {
 		c.JSON(http.StatusForbidden, gin.H{"error": "you can only view your own orders"})
 		return
 	}
@@ -119,7 +112,7 @@ func (h *OrderHandler) GetOrder(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"order": order})
 }
 
-// UpdateOrderStatus handles PATCH /orders/:id/status - updates order status (Admin only).
+// UpdateOrderStatus handles PATCH /orders/:id/status - updates order status (order:update_status).
 func (h *OrderHandler) UpdateOrderStatus(c *gin.Context) {
 	idParam := c.Param("id")
 	id, err := strconv.ParseUint(idParam, 10, 32)
@@ -134,7 +127,7 @@ func (h *OrderHandler) UpdateOrderStatus(c *gin.Context) {
 		return
 	}
 
-	if err := h.service.UpdateOrderStatus(uint(id), req.Status); err != nil {
+	if err := h.service.UpdateOrderStatus(c.Request.Context(), uint(id), req.Status); err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
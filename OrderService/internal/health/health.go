@@ -0,0 +1,106 @@
+// Package health provides the liveness and readiness endpoints of the service.
+package health
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// checkTimeout bounds each readiness check.
+const checkTimeout = 2 * time.Second
+
+// Check is a dependency the service needs before it can take traffic.
+type Check struct {
+	Name  string
+	Probe func(ctx context.Context) error
+}
+
+// result is the outcome of a single readiness check.
+type result struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Liveness reports that the process is up; it never touches dependencies.
+func Liveness(service string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": "ok", "service": service})
+	}
+}
+
+// Readiness runs every check concurrently and answers 200 when all pass,
+// 503 otherwise, with the status and latency of each check.
+func Readiness(service string, checks ...Check) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		results := make(map[string]result, len(checks))
+		var (
+			mu sync.Mutex
+			wg sync.WaitGroup
+		)
+		for _, check := range checks {
+			wg.Add(1)
+			go func(check Check) {
+				defer wg.Done()
+				ctx, cancel := context.WithTimeout(c.Request.Context(), checkTimeout)
+				defer cancel()
+
+				start := time.Now()
+				err := check.Probe(ctx)
+				res := result{Status: "ok", LatencyMS: float64(time.Since(start).Microseconds()) / 1000}
+				if err != nil {
+					res.Status, res.Error = "failed", err.Error()
+				}
+				mu.Lock()
+				results[check.Name] = res
+				mu.Unlock()
+			}(check)
+		}
+		wg.Wait()
+
+		status, code := "ready", http.StatusOK
+		for _, res := range results {
+			if res.Error != "" {
+				status, code = "not_ready", http.StatusServiceUnavailable
+				break
+			}
+		}
+		c.JSON(code, gin.H{"status": status, "service": service, "checks": results})
+	}
+}
+
+// Database checks that the database answers a ping.
+func Database(db *gorm.DB) Check {
+	return Check{Name: "database", Probe: func(ctx context.Context) error {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return err
+		}
+		return sqlDB.PingContext(ctx)
+	}}
+}
+
+// HTTP checks that url answers with a 2xx status.
+func HTTP(name, url string, client *http.Client) Check {
+	return Check{Name: name, Probe: func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return fmt.Errorf("unexpected status %d", resp.StatusCode)
+		}
+		return nil
+	}}
+}
@@ -0,0 +1,81 @@
+// Package metrics holds the Prometheus collectors of the order service and the
+// handler exposing them in the text exposition format.
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// unmatchedRoute labels requests that matched no route so the route label
+// stays bounded by the registered routes.
+const unmatchedRoute = "unmatched"
+
+var (
+	requestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests handled, by route template and status.",
+	}, []string{"method", "route", "status"})
+
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Latency of HTTP requests, by route template and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	ordersCreated = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "orders_created_total",
+		Help: "Orders created, by payment method.",
+	}, []string{"payment_method"})
+
+	orderStatusUpdates = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "order_status_updates_total",
+		Help: "Order status changes, by new status.",
+	}, []string{"status"})
+
+	stockDeductionFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "order_stock_deduction_failures_total",
+		Help: "Orders whose stock deduction in Product Service failed.",
+	})
+)
+
+// Middleware records the request counter and latency histogram of every request.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		status := strconv.Itoa(c.Writer.Status())
+		requestsTotal.WithLabelValues(c.Request.Method, route, status).Inc()
+		requestDuration.WithLabelValues(c.Request.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+// Handler serves all registered metrics in the Prometheus text format.
+func Handler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.Handler())
+}
+
+// OrderCreated counts a created order by its payment method.
+func OrderCreated(paymentMethod string) {
+	ordersCreated.WithLabelValues(paymentMethod).Inc()
+}
+
+// OrderStatusUpdated counts an order moved to status.
+func OrderStatusUpdated(status string) {
+	orderStatusUpdates.WithLabelValues(status).Inc()
+}
+
+// StockDeductionFailed counts an order whose stock could not be deducted.
+func StockDeductionFailed() {
+	stockDeductionFailures.Inc()
+}
@@ -4,23 +4,58 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
-	"os"
+	"slices"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+
+	"authclient/jwks"
+	"authclient/revocation"
 )
 
 // Claims represents JWT token claims.
 type Claims struct {
-	UserID uint   `json:"user_id"`
-	Role   string `json:"role"`
+	UserID        uint     `json:"user_id"`
+	Role          string   `json:"role"`
+	Permissions   []string `json:"permissions"`
+	EmailVerified bool     `json:"email_verified"`
+	// IssuedAtMs is iat in milliseconds, used to order the token against revocations
+	IssuedAtMs int64 `json:"iat_ms,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// AuthMiddleware validates JWT token and extracts user information.
-func AuthMiddleware() gin.HandlerFunc {
+// Permissions checked by OrderService; roles grant them in AuthService.
+const (
+	PermOrderCreate       = "order:create"
+	PermOrderReadAll      = "order:read_all"
+	PermOrderUpdateStatus = "order:update_status"
+)
+
+// IdentityHeader carries the identity assertion signed by the API gateway.
+const IdentityHeader = "X-Gateway-Identity"
+
+// AuthMiddleware validates JWT token against AuthService's published signing keys
+// and extracts user information.
+// When identitySecret is set, a gateway identity assertion is accepted instead of the JWT.
+// JWTs found in revocations are rejected; the gateway checks asserted identities itself.
+func AuthMiddleware(keys *jwks.Cache, identitySecret string, revocations *revocation.List) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if assertion := c.GetHeader(IdentityHeader); assertion != "" && identitySecret != "" {
+			claims, err := parseIdentityAssertion(assertion, identitySecret)
+			if err != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid gateway identity"})
+				c.Abort()
+				return
+			}
+			c.Set("user_id", claims.UserID)
+			c.Set("role", claims.Role)
+			c.Set("permissions", claims.Permissions)
+			c.Set("email_verified", claims.EmailVerified)
+			c.Next()
+			return
+		}
+
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "authorization header required"})
@@ -37,12 +72,7 @@ func AuthMiddleware() gin.HandlerFunc {
 		}
 
 		// Parse and validate token
-		token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return []byte(os.Getenv("JWT_SECRET")), nil
-		})
+		token, err := jwt.ParseWithClaims(tokenString, &Claims{}, keys.Keyfunc, jwt.WithValidMethods(jwks.Methods))
 
 		if err != nil || !token.Valid {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired token"})
@@ -57,13 +87,42 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		issuedAt := revocation.IssuedAt(claims.IssuedAt, claims.IssuedAtMs)
+		if revocations.IsRevoked(claims.ID, claims.UserID, issuedAt) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "token has been revoked"})
+			c.Abort()
+			return
+		}
+
 		// Set user information in context
 		c.Set("user_id", claims.UserID)
 		c.Set("role", claims.Role)
+		c.Set("permissions", claims.Permissions)
+		c.Set("email_verified", claims.EmailVerified)
 		c.Next()
 	}
 }
 
+// parseIdentityAssertion verifies a gateway identity assertion: an HS256 token
+// issued by "api-gateway" for the "internal" audience.
+func parseIdentityAssertion(assertion, identitySecret string) (*Claims, error) {
+	token, err := jwt.ParseWithClaims(assertion, &Claims{}, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(identitySecret), nil
+	}, jwt.WithIssuer("api-gateway"), jwt.WithAudience("internal"), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(*Claims)
+	if !ok || !token.Valid {
+		return nil, errors.New("invalid identity assertion")
+	}
+	return claims, nil
+}
+
 // GetUserID extracts user_id from gin context (set by AuthMiddleware).
 func GetUserID(c *gin.Context) (uint, error) {
 	userID, exists := c.Get("user_id")
@@ -94,22 +153,36 @@ func GetRole(c *gin.Context) (string, error) {
 	return roleStr, nil
 }
 
-// AdminOnlyMiddleware ensures only Admin/Super Admin can access.
-func AdminOnlyMiddleware() gin.HandlerFunc {
+// RequirePermission ensures the token grants every one of the given permissions.
+func RequirePermission(permissions ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		role, err := GetRole(c)
-		if err != nil {
-			c.JSON(http.StatusForbidden, gin.H{"error": "role not found"})
-			c.Abort()
-			return
+		for _, p := range permissions {
+			if !HasPermission(c, p) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "missing permission " + p})
+				c.Abort()
+				return
+			}
 		}
 
-		if role != "saler" && role != "superadmin" {
-			c.JSON(http.StatusForbidden, gin.H{"error": "admin access required"})
+		c.Next()
+	}
+}
+
+// HasPermission reports whether the token (set by AuthMiddleware) grants permission.
+func HasPermission(c *gin.Context, permission string) bool {
+	granted, _ := c.Get("permissions")
+	list, _ := granted.([]string)
+	return slices.Contains(list, permission)
+}
+
+// VerifiedEmailMiddleware rejects users who have not verified their email address yet.
+func VerifiedEmailMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !c.GetBool("email_verified") {
+			c.JSON(http.StatusForbidden, gin.H{"error": "email address not verified"})
 			c.Abort()
 			return
 		}
-
 		c.Next()
 	}
 }
@@ -1,6 +1,7 @@
 package repo
 
 import (
+	"context"
 	"errors"
 
 	"gorm.io/gorm"
@@ -10,12 +11,13 @@ import (
 
 // OrderRepository defines the interface for order data operations.
 type OrderRepository interface {
-	Create(order *models.Order) error
-	FindAll() ([]models.Order, error)
-	FindByID(id uint) (*models.Order, error)
-	FindByUserID(userID uint) ([]models.Order, error)
-	UpdateStatus(id uint, status string) error
-	Update(order *models.Order) error
+	Create(ctx context.Context, order *models.Order) error
+	FindAll(ctx context.Context) ([]models.Order, error)
+	FindByID(ctx context.Context, id uint) (*models.Order, error)
+	FindByUserID(ctx context.Context, userID uint) ([]models.Order, error)
+	UpdateStatus(ctx context.Context, id uint, status string) error
+	Update(ctx context.Context, order *models.Order) error
+	CancelPendingByUserID(ctx context.Context, userID uint) (int64, error)
 }
 
 // orderRepo implements OrderRepository using GORM.
@@ -29,21 +31,21 @@ func NewOrderRepository(db *gorm.DB) OrderRepository {
 }
 
 // Create inserts a new order into the database.
-func (r *orderRepo) Create(order *models.Order) error {
-	return r.db.Create(order).Error
+func (r *orderRepo) Create(ctx context.Context, order *models.Order) error {
+	return r.db.WithContext(ctx).Create(order).Error
 }
 
 // FindAll retrieves all orders from the database.
-func (r *orderRepo) FindAll() ([]models.Order, error) {
+func (r *orderRepo) FindAll(ctx context.Context) ([]models.Order, error) {
 	var orders []models.Order
-	err := r.db.Order("created_at DESC").Find(&orders).Error
+	err := r.db.WithContext(ctx).Order("created_at DESC").Find(&orders).Error
 	return orders, err
 }
 
 // FindByID retrieves an order by its ID.
-func (r *orderRepo) FindByID(id uint) (*models.Order, error) {
+func (r *orderRepo) FindByID(ctx context.Context, id uint) (*models.Order, error) {
 	var order models.Order
-	err := r.db.First(&order, id).Error
+	err := r.db.WithContext(ctx).First(&order, id).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, nil
@@ -54,18 +56,26 @@ func (r *orderRepo) FindByID(id uint) (*models.Order, error) {
 }
 
 // FindByUserID retrieves all orders for a specific user.
-func (r *orderRepo) FindByUserID(userID uint) ([]models.Order, error) {
+func (r *orderRepo) FindByUserID(ctx context.Context, userID uint) ([]models.Order, error) {
 	var orders []models.Order
-	err := r.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&orders).Error
+	err := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at DESC").Find(&orders).Error
 	return orders, err
 }
 
 // UpdateStatus updates the status of an order.
-func (r *orderRepo) UpdateStatus(id uint, status string) error {
-	return r.db.Model(&models.Order{}).Where("id = ?", id).Update("status", status).Error
+func (r *orderRepo) UpdateStatus(ctx context.Context, id uint, status string) error {
+	return r.db.WithContext(ctx).Model(&models.Order{}).Where("id = ?", id).Update("status", status).Error
 }
 
 // Update saves changes to an existing order.
-func (r *orderRepo) Update(order *models.Order) error {
-	return r.db.Save(order).Error
+func (r *orderRepo) Update(ctx context.Context, order *models.Order) error {
+	return r.db.WithContext(ctx).Save(order).Error
+}
+
+// CancelPendingByUserID cancels all pending orders of a user and returns how many there were.
+func (r *orderRepo) CancelPendingByUserID(ctx context.Context, userID uint) (int64, error) {
+	res := r.db.WithContext(ctx).Model(&models.Order{}).
+		Where("user_id = ? AND status = ?", userID, models.StatusPending).
+		Update("status", models.StatusCancelled)
+	return res.RowsAffected, res.Error
 }
@@ -1,44 +1,84 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"strings"
 	"time"
 
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"authclient/notify"
+	"orderservice/internal/logging"
+	"orderservice/internal/metrics"
 	"orderservice/internal/models"
 	"orderservice/internal/repo"
 )
 
+var tracer = otel.Tracer("orderservice/internal/service")
+
 // OrderService defines business logic for order operations.
 type OrderService interface {
-	CreateOrder(userID uint, req *models.CreateOrderRequest) (*models.Order, error)
-	GetAllOrders() ([]models.Order, error)
-	GetOrdersByUserID(userID uint) ([]models.Order, error)
-	GetOrderByID(id uint) (*models.Order, error)
-	UpdateOrderStatus(id uint, status string) error
+	CreateOrder(ctx context.Context, userID uint, req *models.CreateOrderRequest) (*models.Order, error)
+	GetAllOrders(ctx context.Context) ([]models.Order, error)
+	GetOrdersByUserID(ctx context.Context, userID uint) ([]models.Order, error)
+	GetOrderByID(ctx context.Context, id uint) (*models.Order, error)
+	UpdateOrderStatus(ctx context.Context, id uint, status string) error
+	CancelUserOrders(ctx context.Context, userID uint) error
 }
 
 // orderService implements OrderService.
 type orderService struct {
 	repo              repo.OrderRepository
 	productServiceURL string
+	httpClient        *http.Client
+	notifier          *notify.Sender
 }
 
 // NewOrderService creates a new order service instance.
-func NewOrderService(repo repo.OrderRepository, productServiceURL string) OrderService {
+// Calls to Product Service are traced and carry the W3C traceparent header.
+// Buyers and sellers are notified of new orders and status changes through
+// notifier, unless it is nil.
+func NewOrderService(repo repo.OrderRepository, productServiceURL string, notifier *notify.Sender) OrderService {
 	return &orderService{
 		repo:              repo,
 		productServiceURL: productServiceURL,
+		notifier:          notifier,
+		httpClient: &http.Client{
+			Timeout: 10 * time.Second,
+			Transport: otelhttp.NewTransport(http.DefaultTransport, otelhttp.WithSpanNameFormatter(
+				func(_ string, r *http.Request) string { return "product-service " + r.Method },
+			)),
+		},
 	}
 }
 
 // CreateOrder creates a new order with product validation and quantity deduction.
-func (s *orderService) CreateOrder(userID uint, req *models.CreateOrderRequest) (*models.Order, error) {
+// The request ID in ctx is forwarded on every call to Product Service.
+func (s *orderService) CreateOrder(ctx context.Context, userID uint, req *models.CreateOrderRequest) (_ *models.Order, err error) {
+	ctx, span := tracer.Start(ctx, "CreateOrder", trace.WithAttributes(
+		attribute.Int("order.product_id", int(req.ProductID)),
+		attribute.Int("order.quantity", req.Quantity),
+		attribute.String("order.payment_method", req.PaymentMethod),
+	))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
 	// 1. Validate product availability from Product Service
-	product, err := s.getProductFromService(req.ProductID)
+	product, err := s.getProductFromService(ctx, req.ProductID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch product: %w", err)
 	}
@@ -73,32 +113,39 @@ func (s *orderService) CreateOrder(userID uint, req *models.CreateOrderRequest)
 		UpdatedAt:     time.Now(),
 	}
 
-	if err := s.repo.Create(order); err != nil {
+	if err := s.repo.Create(ctx, order); err != nil {
 		return nil, err
 	}
+	metrics.OrderCreated(order.PaymentMethod)
+
+	span.SetAttributes(attribute.Int("order.id", int(order.ID)))
+	s.notifyOrderPlaced(ctx, order, product)
 
 	// 6. Deduct product quantity (call Product Service)
-	if err := s.deductProductQuantity(req.ProductID, req.Quantity); err != nil {
+	if err := s.deductProductQuantity(ctx, req.ProductID, req.Quantity); err != nil {
 		// Log error but don't fail the order (can be handled by background job)
-		fmt.Printf("Warning: failed to deduct product quantity: %v\n", err)
+		metrics.StockDeductionFailed()
+		span.AddEvent("stock deduction failed", trace.WithAttributes(attribute.String("error", err.Error())))
+		logging.FromContext(ctx).Warn("failed to deduct product quantity",
+			"order_id", order.ID, "product_id", req.ProductID, "quantity", req.Quantity, "error", err)
 	}
 
 	return order, nil
 }
 
 // GetAllOrders retrieves all orders (Admin view).
-func (s *orderService) GetAllOrders() ([]models.Order, error) {
-	return s.repo.FindAll()
+func (s *orderService) GetAllOrders(ctx context.Context) ([]models.Order, error) {
+	return s.repo.FindAll(ctx)
 }
 
 // GetOrdersByUserID retrieves orders for a specific user.
-func (s *orderService) GetOrdersByUserID(userID uint) ([]models.Order, error) {
-	return s.repo.FindByUserID(userID)
+func (s *orderService) GetOrdersByUserID(ctx context.Context, userID uint) ([]models.Order, error) {
+	return s.repo.FindByUserID(ctx, userID)
 }
 
 // GetOrderByID retrieves a single order by ID.
-func (s *orderService) GetOrderByID(id uint) (*models.Order, error) {
-	order, err := s.repo.FindByID(id)
+func (s *orderService) GetOrderByID(ctx context.Context, id uint) (*models.Order, error) {
+	order, err := s.repo.FindByID(ctx, id)
 	if err != nil {
 		return nil, err
 	}
@@ -109,8 +156,8 @@ func (s *orderService) GetOrderByID(id uint) (*models.Order, error) {
 }
 
 // UpdateOrderStatus updates the status of an order.
-func (s *orderService) UpdateOrderStatus(id uint, status string) error {
-	order, err := s.repo.FindByID(id)
+func (s *orderService) UpdateOrderStatus(ctx context.Context, id uint, status string) error {
+	order, err := s.repo.FindByID(ctx, id)
 	if err != nil {
 		return err
 	}
@@ -118,14 +165,75 @@ func (s *orderService) UpdateOrderStatus(id uint, status string) error {
 		return errors.New("order not found")
 	}
 
-	return s.repo.UpdateStatus(id, status)
+	if err := s.repo.UpdateStatus(ctx, id, status); err != nil {
+		return err
+	}
+	metrics.OrderStatusUpdated(status)
+	if order.Status != status {
+		s.notifier.Send(ctx, notify.Notification{
+			UserID:   order.UserID,
+			Type:     notify.TypeOrderStatusChanged,
+			Payload:  map[string]any{"order_id": order.ID, "product_id": order.ProductID, "status": status},
+			DedupKey: fmt.Sprintf("order_status:%d:%d", order.ID, time.Now().UnixNano()),
+		})
+	}
+	return nil
+}
+
+// CancelUserOrders cancels the pending orders of a user whose account was
+// deleted. Completed orders are kept as records of the sale.
+func (s *orderService) CancelUserOrders(ctx context.Context, userID uint) error {
+	cancelled, err := s.repo.CancelPendingByUserID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for i := int64(0); i < cancelled; i++ {
+		metrics.OrderStatusUpdated(models.StatusCancelled)
+	}
+	if cancelled > 0 {
+		logging.FromContext(ctx).Info("cancelled orders of deleted user", "user_id", userID, "orders", cancelled)
+	}
+	return nil
+}
+
+// notifyOrderPlaced confirms a new order to the buyer and tells the seller of
+// the product about it.
+func (s *orderService) notifyOrderPlaced(ctx context.Context, order *models.Order, product *models.Product) {
+	payload := map[string]any{
+		"order_id":     order.ID,
+		"product_id":   product.ID,
+		"product_name": product.Name,
+		"quantity":     order.Quantity,
+		"total_amount": order.TotalAmount,
+		"status":       order.Status,
+	}
+	notifications := []notify.Notification{{
+		UserID:   order.UserID,
+		Type:     notify.TypeOrderPlaced,
+		Payload:  payload,
+		DedupKey: fmt.Sprintf("order_placed:%d", order.ID),
+	}}
+	if product.SellerID != 0 && product.SellerID != order.UserID {
+		notifications = append(notifications, notify.Notification{
+			UserID:   product.SellerID,
+			Type:     notify.TypeOrderReceived,
+			Payload:  payload,
+			DedupKey: fmt.Sprintf("order_received:%d", order.ID),
+		})
+	}
+	s.notifier.Send(ctx, notifications...)
 }
 
 // getProductFromService fetches product details from Product Service.
-func (s *orderService) getProductFromService(productID uint) (*models.Product, error) {
+func (s *orderService) getProductFromService(ctx context.Context, productID uint) (*models.Product, error) {
 	url := fmt.Sprintf("%s/products/%d", s.productServiceURL, productID)
 
-	resp, err := http.Get(url)
+	req, err := s.newProductRequest(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.httpClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("product service unreachable: %w", err)
 	}
@@ -151,11 +259,19 @@ func (s *orderService) getProductFromService(productID uint) (*models.Product, e
 }
 
 // deductProductQuantity calls Product Service to reduce stock.
-func (s *orderService) deductProductQuantity(productID uint, quantity int) error {
+func (s *orderService) deductProductQuantity(ctx context.Context, productID uint, quantity int) (err error) {
+	ctx, span := tracer.Start(ctx, "deductProductQuantity")
+	defer func() {
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
 	url := fmt.Sprintf("%s/products/%d/stock", s.productServiceURL, productID)
 
 	// Calculate new quantity (fetch current, subtract ordered)
-	product, err := s.getProductFromService(productID)
+	product, err := s.getProductFromService(ctx, productID)
 	if err != nil || product == nil {
 		return err
 	}
@@ -167,7 +283,7 @@ func (s *orderService) deductProductQuantity(productID uint, quantity int) error
 
 	// Prepare request body
 	bodyStr := fmt.Sprintf(`{"quantity": %d}`, newQuantity)
-	req, err := http.NewRequest("PATCH", url, strings.NewReader(bodyStr))
+	req, err := s.newProductRequest(ctx, http.MethodPatch, url, strings.NewReader(bodyStr))
 	if err != nil {
 		return err
 	}
@@ -175,8 +291,7 @@ func (s *orderService) deductProductQuantity(productID uint, quantity int) error
 	req.Header.Set("Content-Type", "application/json")
 
 	// For now, skip authentication (in production, use service-to-service auth)
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := s.httpClient.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to update product quantity: %w", err)
 	}
@@ -188,3 +303,15 @@ func (s *orderService) deductProductQuantity(productID uint, quantity int) error
 
 	return nil
 }
+
+// newProductRequest builds a Product Service request carrying the caller's request ID.
+func (s *orderService) newProductRequest(ctx context.Context, method, url string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	if id := logging.RequestID(ctx); id != "" {
+		req.Header.Set(logging.RequestIDHeader, id)
+	}
+	return req, nil
+}
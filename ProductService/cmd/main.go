@@ -1,30 +1,68 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 
+	"authclient/jwks"
+	"authclient/notify"
+	"authclient/revocation"
+	"authclient/userevents"
 	"productservice/internal/db"
 	"productservice/internal/handlers"
+	"productservice/internal/health"
+	"productservice/internal/logging"
+	"productservice/internal/metrics"
 	"productservice/internal/middleware"
 	"productservice/internal/repo"
 	"productservice/internal/service"
+	"productservice/internal/tracing"
 )
 
 func main() {
 	// Load .env file if present
 	// envPath := filepath.Join("..", ".env")
 	err := godotenv.Load()
+
+	// Structured JSON logs; the standard log package is routed through slog too
+	logging.Setup("product-service")
 	if err != nil {
 		log.Print("No .env file found")
 	}
-	// Load JWT secret from environment variable
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		log.Fatal("JWT_SECRET environment variable is required")
+	// Access tokens are verified with the public keys Auth Service publishes
+	jwksURL := os.Getenv("JWKS_URL")
+	if jwksURL == "" {
+		log.Fatal("JWKS_URL environment variable is required")
+	}
+	// Optional: accept identity assertions signed by the API gateway
+	identitySecret := os.Getenv("GATEWAY_IDENTITY_SECRET")
+
+	// AuthService's /internal endpoints are guarded by this token alone; without
+	// it the feeds and notifications served there are not used
+	internalToken := os.Getenv("INTERNAL_API_TOKEN")
+	if internalToken == "" {
+		log.Println("INTERNAL_API_TOKEN not set; Auth Service's internal endpoints are not used")
+	}
+
+	// Stop serving and flush traces on SIGINT/SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Tracing exporter is selected by OTEL_TRACES_EXPORTER (none, otlp, stdout, file)
+	shutdownTracing, err := tracing.Setup(ctx, "product-service")
+	if err != nil {
+		log.Fatalf("failed to set up tracing: %v", err)
 	}
 
 	// Initialize database and run migrations
@@ -33,13 +71,74 @@ func main() {
 		log.Fatalf("failed to initialize database: %v", err)
 	}
 
+	// Signing keys are refetched periodically and whenever a token names an unknown kid
+	keys := jwks.NewCache(jwksURL)
+	jwksInterval, err := time.ParseDuration(getEnvOrDefault("JWKS_REFRESH_INTERVAL", "5m"))
+	if err != nil {
+		log.Fatalf("Invalid JWKS_REFRESH_INTERVAL: %v", err)
+	}
+	go keys.Run(ctx, jwksInterval)
+
+	// Token revocation list synced from Auth Service
+	var revocations *revocation.List
+	if feedURL := os.Getenv("REVOCATION_FEED_URL"); feedURL != "" && internalToken != "" {
+		interval, err := time.ParseDuration(getEnvOrDefault("REVOCATION_POLL_INTERVAL", "5s"))
+		if err != nil {
+			log.Fatalf("Invalid REVOCATION_POLL_INTERVAL: %v", err)
+		}
+		revocations = revocation.NewList(feedURL, internalToken)
+		go revocations.Run(ctx, interval)
+	} else {
+		log.Println("REVOCATION_FEED_URL or INTERNAL_API_TOKEN not set; revoked tokens are accepted until they expire")
+	}
+
+	// Sellers are notified through Auth Service when a product runs low on stock
+	var notifier *notify.Sender
+	if notifyURL := os.Getenv("NOTIFICATIONS_URL"); notifyURL != "" && internalToken != "" {
+		notifier = notify.NewSender(notifyURL, internalToken, logging.RequestID)
+	} else {
+		log.Println("NOTIFICATIONS_URL or INTERNAL_API_TOKEN not set; sellers are not notified of low stock")
+	}
+	lowStockThreshold, err := strconv.Atoi(getEnvOrDefault("LOW_STOCK_THRESHOLD", "5"))
+	if err != nil || lowStockThreshold < 0 {
+		log.Fatalf("Invalid LOW_STOCK_THRESHOLD: %q", os.Getenv("LOW_STOCK_THRESHOLD"))
+	}
+
 	// Initialize layers (dependency injection)
 	productRepo := repo.NewProductRepository(database)
-	productService := service.NewProductService(productRepo)
+	productService := service.NewProductService(productRepo, notifier, lowStockThreshold)
 	productHandler := handlers.NewProductHandler(productService)
 
+	// Products of deleted accounts are removed as Auth Service reports the deletions
+	if feedURL := os.Getenv("USER_EVENTS_FEED_URL"); feedURL != "" && internalToken != "" {
+		interval, err := time.ParseDuration(getEnvOrDefault("USER_EVENTS_POLL_INTERVAL", "30s"))
+		if err != nil {
+			log.Fatalf("Invalid USER_EVENTS_POLL_INTERVAL: %v", err)
+		}
+		feed := userevents.NewFeed(feedURL, internalToken, map[string]userevents.Handler{
+			userevents.EventDeleted: productService.DeleteSellerProducts,
+		})
+		go feed.Run(ctx, interval)
+	} else {
+		log.Println("USER_EVENTS_FEED_URL or INTERNAL_API_TOKEN not set; products of deleted accounts are kept")
+	}
+
 	// Setup Gin router
-	router := gin.Default()
+	router := gin.New()
+	router.Use(otelgin.Middleware("product-service", otelgin.WithFilter(tracing.ShouldTrace)))
+	router.Use(gin.Recovery(), middleware.RequestID(), middleware.RequestLogger(), metrics.Middleware())
+
+	// Check
+	router.GET("/Check", func(c *gin.Context) {
+		c.JSON(200, gin.H{"status": "ok", "service": "product-service"})
+	})
+
+	// Liveness and readiness (database reachable)
+	router.GET("/healthz", health.Liveness("product-service"))
+	router.GET("/readyz", health.Readiness("product-service", health.Database(database)))
+
+	// Prometheus metrics
+	router.GET("/metrics", metrics.Handler())
 
 	// Public routes - anyone can view products
 	router.GET("/products", productHandler.ListProducts)
@@ -47,9 +146,10 @@ func main() {
 
 	// Protected routes - Admin/Super Admin only
 	adminRoutes := router.Group("/")
-	adminRoutes.Use(middleware.JWTAuth(jwtSecret), middleware.AdminOnly())
+	adminRoutes.Use(middleware.JWTAuth(keys, identitySecret, revocations), middleware.RequirePermission(middleware.PermProductWrite))
 	{
-		adminRoutes.POST("/products", productHandler.CreateProduct)
+		// Listing a product requires a verified email address
+		adminRoutes.POST("/products", middleware.VerifiedEmailOnly(), productHandler.CreateProduct)
 		adminRoutes.PATCH("/products/:id", productHandler.UpdateProduct)
 		adminRoutes.PATCH("/products/:id/stock", productHandler.UpdateStock)
 		adminRoutes.DELETE("/products/:id", productHandler.DeleteProduct)
@@ -63,8 +163,31 @@ func main() {
 		port = "8002"
 	}
 
-	log.Printf("Product service running on port %s", port)
-	if err := router.Run(":" + port); err != nil {
-		log.Fatalf("failed to start server: %v", err)
+	server := &http.Server{Addr: ":" + port, Handler: router}
+	go func() {
+		log.Printf("Product service running on port %s", port)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("failed to start server: %v", err)
+		}
+	}()
+
+	// Drain in-flight requests, then flush buffered spans
+	<-ctx.Done()
+	log.Println("Product service shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("server shutdown failed: %v", err)
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		log.Printf("failed to flush traces: %v", err)
+	}
+}
+
+// getEnvOrDefault returns environment variable value or default if not set.
+func getEnvOrDefault(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
 	}
+	return defaultValue
 }
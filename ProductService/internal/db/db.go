@@ -7,7 +7,9 @@ import (
 	"github.com/glebarez/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
+	otelgorm "gorm.io/plugin/opentelemetry/tracing"
 
+	"productservice/internal/logging"
 	"productservice/internal/models"
 )
 
@@ -16,7 +18,7 @@ import (
 func InitDB(dbPath string) (*gorm.DB, error) {
 	// Open SQLite database
 	db, err := gorm.Open(sqlite.Open(dbPath), &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Info),
+		Logger: logging.NewGormLogger(logger.Info),
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
@@ -27,6 +29,11 @@ func InitDB(dbPath string) (*gorm.DB, error) {
 		return nil, fmt.Errorf("failed to migrate database: %w", err)
 	}
 
+	// Record a span for every query from here on; migrations stay untraced
+	if err := db.Use(otelgorm.NewPlugin(otelgorm.WithoutMetrics())); err != nil {
+		return nil, fmt.Errorf("failed to enable query tracing: %w", err)
+	}
+
 	log.Println("Database initialized successfully")
 	return db, nil
 }
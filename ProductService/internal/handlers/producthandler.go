@@ -23,7 +23,7 @@ func NewProductHandler(service service.ProductService) *ProductHandler {
 
 // ListProducts handles GET /products - retrieves all products (public).
 func (h *ProductHandler) ListProducts(c *gin.Context) {
-	products, err := h.service.GetAllProducts()
+	products, err := h.service.GetAllProducts(c.Request.Context())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch products"})
 		return
@@ -41,7 +41,7 @@ func (h *ProductHandler) GetProduct(c *gin.Context) {
 		return
 	}
 
-	product, err := h.service.GetProductByID(uint(id))
+	product, err := h.service.GetProductByID(c.Request.Context(), uint(id))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
@@ -59,7 +59,7 @@ func (h *ProductHandler) GetSalerProducts(c *gin.Context) {
 		return
 	}
 
-	products, err := h.service.GetProductsBySellerID(sellerID)
+	products, err := h.service.GetProductsBySellerID(c.Request.Context(), sellerID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch products"})
 		return
@@ -97,7 +97,7 @@ func (h *ProductHandler) CreateProduct(c *gin.Context) {
 
 	req.SellerID = sellerID
 
-	product, err := h.service.CreateProduct(&req)
+	product, err := h.service.CreateProduct(c.Request.Context(), &req)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create product"})
 		return
@@ -124,7 +124,7 @@ func (h *ProductHandler) UpdateProduct(c *gin.Context) {
 		return
 	}
 
-	existingProduct, err := h.service.GetProductByID(uint(id))
+	existingProduct, err := h.service.GetProductByID(c.Request.Context(), uint(id))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
 		return
@@ -141,7 +141,7 @@ func (h *ProductHandler) UpdateProduct(c *gin.Context) {
 		return
 	}
 
-	product, err := h.service.UpdateProduct(uint(id), &req)
+	product, err := h.service.UpdateProduct(c.Request.Context(), uint(id), &req)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
@@ -168,7 +168,7 @@ func (h *ProductHandler) UpdateStock(c *gin.Context) {
 		return
 	}
 
-	existingProduct, err := h.service.GetProductByID(uint(id))
+	existingProduct, err := h.service.GetProductByID(c.Request.Context(), uint(id))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
 		return
@@ -185,7 +185,7 @@ func (h *ProductHandler) UpdateStock(c *gin.Context) {
 		return
 	}
 
-	product, err := h.service.UpdateStock(uint(id), req.Quantity)
+	product, err := h.service.UpdateStock(c.Request.Context(), uint(id), req.Quantity)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
@@ -211,7 +211,7 @@ func (h *ProductHandler) DeleteProduct(c *gin.Context) {
 		return
 	}
 
-	existingProduct, err := h.service.GetProductByID(uint(id))
+	existingProduct, err := h.service.GetProductByID(c.Request.Context(), uint(id))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
 		return
@@ -222,7 +222,7 @@ func (h *ProductHandler) DeleteProduct(c *gin.Context) {
 		return
 	}
 
-	if err := h.service.DeleteProduct(uint(id)); err != nil {
+	if err := h.service.DeleteProduct(c.Request.Context(), uint(id)); err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
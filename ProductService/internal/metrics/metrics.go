@@ -0,0 +1,69 @@
+// Package metrics holds the Prometheus collectors of the product service and the
+// handler exposing them in the text exposition format.
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Product operations recorded by ProductChanged.
+const (
+	OpCreate = "create"
+	OpUpdate = "update"
+	OpStock  = "stock"
+	OpDelete = "delete"
+)
+
+// unmatchedRoute labels requests that matched no route so the route label
+// stays bounded by the registered routes.
+const unmatchedRoute = "unmatched"
+
+var (
+	requestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests handled, by route template and status.",
+	}, []string{"method", "route", "status"})
+
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Latency of HTTP requests, by route template and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	productChanges = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "product_changes_total",
+		Help: "Successful product catalogue changes, by operation.",
+	}, []string{"operation"})
+)
+
+// Middleware records the request counter and latency histogram of every request.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		status := strconv.Itoa(c.Writer.Status())
+		requestsTotal.WithLabelValues(c.Request.Method, route, status).Inc()
+		requestDuration.WithLabelValues(c.Request.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+// Handler serves all registered metrics in the Prometheus text format.
+func Handler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.Handler())
+}
+
+// ProductChanged counts a successful catalogue change.
+func ProductChanged(operation string) {
+	productChanges.WithLabelValues(operation).Inc()
+}
@@ -2,24 +2,59 @@ package middleware
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
+	"slices"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+
+	"authclient/jwks"
+	"authclient/revocation"
 )
 
-// Claims represents JWT token claims with user_id and role.
+// Claims represents JWT token claims with user_id, role and permissions.
 type Claims struct {
-	UserID uint   `json:"user_id"`
-	Role   string `json:"role"`
+	UserID        uint     `json:"user_id"`
+	Role          string   `json:"role"`
+	Permissions   []string `json:"permissions"`
+	EmailVerified bool     `json:"email_verified"`
+	// IssuedAtMs is iat in milliseconds, used to order the token against revocations
+	IssuedAtMs int64 `json:"iat_ms,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// JWTAuth is a middleware that verifies JWT token from Authorization header.
-// It extracts user_id and role from the token and stores them in the Gin context.
-func JWTAuth(jwtSecret string) gin.HandlerFunc {
+// Permissions checked by ProductService; roles grant them in AuthService.
+const (
+	PermProductWrite = "product:write"
+)
+
+// IdentityHeader carries the identity assertion signed by the API gateway.
+const IdentityHeader = "X-Gateway-Identity"
+
+// JWTAuth is a middleware that verifies JWT token from Authorization header
+// against AuthService's published signing keys.
+// It extracts user_id, role and permissions from the token and stores them in the Gin context.
+// When identitySecret is set, a gateway identity assertion is accepted instead of the JWT.
+// JWTs found in revocations are rejected; the gateway checks asserted identities itself.
+func JWTAuth(keys *jwks.Cache, identitySecret string, revocations *revocation.List) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if assertion := c.GetHeader(IdentityHeader); assertion != "" && identitySecret != "" {
+			claims, err := ParseIdentityAssertion(assertion, identitySecret)
+			if err != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid gateway identity"})
+				c.Abort()
+				return
+			}
+			c.Set("user_id", claims.UserID)
+			c.Set("role", claims.Role)
+			c.Set("permissions", claims.Permissions)
+			c.Set("email_verified", claims.EmailVerified)
+			c.Next()
+			return
+		}
+
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "missing authorization header"})
@@ -38,9 +73,7 @@ func JWTAuth(jwtSecret string) gin.HandlerFunc {
 		tokenString := parts[1]
 
 		// Parse and validate token
-		token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-			return []byte(jwtSecret), nil
-		})
+		token, err := jwt.ParseWithClaims(tokenString, &Claims{}, keys.Keyfunc, jwt.WithValidMethods(jwks.Methods))
 
 		if err != nil || !token.Valid {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired token"})
@@ -55,39 +88,55 @@ func JWTAuth(jwtSecret string) gin.HandlerFunc {
 			return
 		}
 
+		issuedAt := revocation.IssuedAt(claims.IssuedAt, claims.IssuedAtMs)
+		if revocations.IsRevoked(claims.ID, claims.UserID, issuedAt) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "token has been revoked"})
+			c.Abort()
+			return
+		}
+
 		// Store user info in context for handlers to use
 		c.Set("user_id", claims.UserID)
 		c.Set("role", claims.Role)
+		c.Set("permissions", claims.Permissions)
+		c.Set("email_verified", claims.EmailVerified)
 
 		c.Next()
 	}
 }
 
-// AdminOnly is a middleware that ensures only Admin or Super Admin can access the route.
-// Must be used after JWTAuth middleware.
-func AdminOnly() gin.HandlerFunc {
+// RequirePermission is a middleware that ensures the token grants every one of
+// the given permissions. Must be used after JWTAuth middleware.
+func RequirePermission(permissions ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		role, exists := c.Get("role")
-		if !exists {
-			c.JSON(http.StatusForbidden, gin.H{"error": "role not found in token"})
-			c.Abort()
-			return
+		for _, p := range permissions {
+			if !HasPermission(c, p) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "missing permission " + p})
+				c.Abort()
+				return
+			}
 		}
 
-		roleStr, ok := role.(string)
-		if !ok {
-			c.JSON(http.StatusForbidden, gin.H{"error": "invalid role type"})
-			c.Abort()
-			return
-		}
+		c.Next()
+	}
+}
 
-		// Allow "saler" (Admin) and "superadmin" roles
-		if roleStr != "saler" && roleStr != "superadmin" {
-			c.JSON(http.StatusForbidden, gin.H{"error": "admin access required"})
+// HasPermission reports whether the token stored by JWTAuth grants permission.
+func HasPermission(c *gin.Context, permission string) bool {
+	granted, _ := c.Get("permissions")
+	list, _ := granted.([]string)
+	return slices.Contains(list, permission)
+}
+
+// VerifiedEmailOnly is a middleware that rejects users who have not verified
+// their email address yet. Must be used after JWTAuth middleware.
+func VerifiedEmailOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !c.GetBool("email_verified") {
+			c.JSON(http.StatusForbidden, gin.H{"error": "email address not verified"})
 			c.Abort()
 			return
 		}
-
 		c.Next()
 	}
 }
@@ -114,10 +163,8 @@ func GetUserID(c *gin.Context) (uint, error) {
 }
 
 // ParseToken parses and validates a JWT token string (utility function).
-func ParseToken(tokenString, jwtSecret string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(jwtSecret), nil
-	})
+func ParseToken(tokenString string, keys *jwks.Cache) (*Claims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, keys.Keyfunc, jwt.WithValidMethods(jwks.Methods))
 
 	if err != nil {
 		return nil, err
@@ -129,3 +176,24 @@ func ParseToken(tokenString, jwtSecret string) (*Claims, error) {
 
 	return nil, errors.New("invalid token")
 }
+
+// ParseIdentityAssertion verifies a gateway identity assertion: an HS256 token
+// issued by "api-gateway" for the "internal" audience.
+func ParseIdentityAssertion(assertion, identitySecret string) (*Claims, error) {
+	token, err := jwt.ParseWithClaims(assertion, &Claims{}, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(identitySecret), nil
+	}, jwt.WithIssuer("api-gateway"), jwt.WithAudience("internal"), jwt.WithExpirationRequired())
+
+	if err != nil {
+		return nil, err
+	}
+
+	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
+		return claims, nil
+	}
+
+	return nil, errors.New("invalid identity assertion")
+}
@@ -1,6 +1,7 @@
 package repo
 
 import (
+	"context"
 	"errors"
 
 	"gorm.io/gorm"
@@ -10,12 +11,13 @@ import (
 
 // ProductRepository defines the interface for product data operations.
 type ProductRepository interface {
-	Create(product *models.Product) error
-	FindAll() ([]models.Product, error)
-	FindByID(id uint) (*models.Product, error)
-	Update(product *models.Product) error
-	Delete(id uint) error
-	FindBySellerID(sellerID uint) ([]models.Product, error)
+	Create(ctx context.Context, product *models.Product) error
+	FindAll(ctx context.Context) ([]models.Product, error)
+	FindByID(ctx context.Context, id uint) (*models.Product, error)
+	Update(ctx context.Context, product *models.Product) error
+	Delete(ctx context.Context, id uint) error
+	FindBySellerID(ctx context.Context, sellerID uint) ([]models.Product, error)
+	DeleteBySellerID(ctx context.Context, sellerID uint) (int64, error)
 }
 
 // productRepo implements ProductRepository using GORM.
@@ -29,21 +31,21 @@ func NewProductRepository(db *gorm.DB) ProductRepository {
 }
 
 // Create inserts a new product into the database.
-func (r *productRepo) Create(product *models.Product) error {
-	return r.db.Create(product).Error
+func (r *productRepo) Create(ctx context.Context, product *models.Product) error {
+	return r.db.WithContext(ctx).Create(product).Error
 }
 
 // FindAll retrieves all products from the database.
-func (r *productRepo) FindAll() ([]models.Product, error) {
+func (r *productRepo) FindAll(ctx context.Context) ([]models.Product, error) {
 	var products []models.Product
-	err := r.db.Order("created_at DESC").Find(&products).Error
+	err := r.db.WithContext(ctx).Order("created_at DESC").Find(&products).Error
 	return products, err
 }
 
 // FindByID retrieves a product by its ID.
-func (r *productRepo) FindByID(id uint) (*models.Product, error) {
+func (r *productRepo) FindByID(ctx context.Context, id uint) (*models.Product, error) {
 	var product models.Product
-	err := r.db.First(&product, id).Error
+	err := r.db.WithContext(ctx).First(&product, id).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, nil // Return nil if not found
@@ -54,18 +56,24 @@ func (r *productRepo) FindByID(id uint) (*models.Product, error) {
 }
 
 // Update saves changes to an existing product.
-func (r *productRepo) Update(product *models.Product) error {
-	return r.db.Save(product).Error
+func (r *productRepo) Update(ctx context.Context, product *models.Product) error {
+	return r.db.WithContext(ctx).Save(product).Error
 }
 
 // Delete removes a product from the database by ID.
-func (r *productRepo) Delete(id uint) error {
-	return r.db.Delete(&models.Product{}, id).Error
+func (r *productRepo) Delete(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Delete(&models.Product{}, id).Error
 }
 
 // FindBySellerID retrieves all products for a specific seller.
-func (r *productRepo) FindBySellerID(sellerID uint) ([]models.Product, error) {
+func (r *productRepo) FindBySellerID(ctx context.Context, sellerID uint) ([]models.Product, error) {
 	var products []models.Product
-	err := r.db.Where("seller_id = ?", sellerID).Order("created_at DESC").Find(&products).Error
+	err := r.db.WithContext(ctx).Where("seller_id = ?", sellerID).Order("created_at DESC").Find(&products).Error
 	return products, err
 }
+
+// DeleteBySellerID removes all products of a seller and returns how many there were.
+func (r *productRepo) DeleteBySellerID(ctx context.Context, sellerID uint) (int64, error) {
+	res := r.db.WithContext(ctx).Where("seller_id = ?", sellerID).Delete(&models.Product{})
+	return res.RowsAffected, res.Error
+}
@@ -1,36 +1,46 @@
 package service
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"time"
 
+	"authclient/notify"
+	"productservice/internal/logging"
+	"productservice/internal/metrics"
 	"productservice/internal/models"
 	"productservice/internal/repo"
 )
 
 // ProductService defines business logic for product operations.
 type ProductService interface {
-	CreateProduct(req *models.CreateProductRequest) (*models.Product, error)
-	GetAllProducts() ([]models.Product, error)
-	GetProductByID(id uint) (*models.Product, error)
-	UpdateProduct(id uint, req *models.UpdateProductRequest) (*models.Product, error)
-	UpdateStock(id uint, quantity int) (*models.Product, error)
-	DeleteProduct(id uint) error
-	GetProductsBySellerID(sellerID uint) ([]models.Product, error)
+	CreateProduct(ctx context.Context, req *models.CreateProductRequest) (*models.Product, error)
+	GetAllProducts(ctx context.Context) ([]models.Product, error)
+	GetProductByID(ctx context.Context, id uint) (*models.Product, error)
+	UpdateProduct(ctx context.Context, id uint, req *models.UpdateProductRequest) (*models.Product, error)
+	UpdateStock(ctx context.Context, id uint, quantity int) (*models.Product, error)
+	DeleteProduct(ctx context.Context, id uint) error
+	GetProductsBySellerID(ctx context.Context, sellerID uint) ([]models.Product, error)
+	DeleteSellerProducts(ctx context.Context, sellerID uint) error
 }
 
 // productService implements ProductService.
 type productService struct {
-	repo repo.ProductRepository
+	repo              repo.ProductRepository
+	notifier          *notify.Sender
+	lowStockThreshold int
 }
 
-// NewProductService creates a new product service instance.
-func NewProductService(repo repo.ProductRepository) ProductService {
-	return &productService{repo: repo}
+// NewProductService creates a new product service instance. Sellers are
+// notified through notifier when the stock of a product falls to
+// lowStockThreshold or below; a threshold of 0 or a nil notifier disables it.
+func NewProductService(repo repo.ProductRepository, notifier *notify.Sender, lowStockThreshold int) ProductService {
+	return &productService{repo: repo, notifier: notifier, lowStockThreshold: lowStockThreshold}
 }
 
 // CreateProduct creates a new product in the system.
-func (s *productService) CreateProduct(req *models.CreateProductRequest) (*models.Product, error) {
+func (s *productService) CreateProduct(ctx context.Context, req *models.CreateProductRequest) (*models.Product, error) {
 	product := &models.Product{
 		Name:        req.Name,
 		Description: req.Description,
@@ -41,26 +51,27 @@ func (s *productService) CreateProduct(req *models.CreateProductRequest) (*model
 		UpdatedAt:   time.Now(),
 	}
 
-	if err := s.repo.Create(product); err != nil {
+	if err := s.repo.Create(ctx, product); err != nil {
 		return nil, err
 	}
+	metrics.ProductChanged(metrics.OpCreate)
 
 	return product, nil
 }
 
 // GetAllProducts retrieves all products.
-func (s *productService) GetAllProducts() ([]models.Product, error) {
-	return s.repo.FindAll()
+func (s *productService) GetAllProducts(ctx context.Context) ([]models.Product, error) {
+	return s.repo.FindAll(ctx)
 }
 
 // GetProductsBySellerID retrieves all products for a specific seller.
-func (s *productService) GetProductsBySellerID(sellerID uint) ([]models.Product, error) {
-	return s.repo.FindBySellerID(sellerID)
+func (s *productService) GetProductsBySellerID(ctx context.Context, sellerID uint) ([]models.Product, error) {
+	return s.repo.FindBySellerID(ctx, sellerID)
 }
 
 // GetProductByID retrieves a single product by ID.
-func (s *productService) GetProductByID(id uint) (*models.Product, error) {
-	product, err := s.repo.FindByID(id)
+func (s *productService) GetProductByID(ctx context.Context, id uint) (*models.Product, error) {
+	product, err := s.repo.FindByID(ctx, id)
 	if err != nil {
 		return nil, err
 	}
@@ -71,8 +82,8 @@ func (s *productService) GetProductByID(id uint) (*models.Product, error) {
 }
 
 // UpdateProduct updates product information (name, description, price, quantity).
-func (s *productService) UpdateProduct(id uint, req *models.UpdateProductRequest) (*models.Product, error) {
-	product, err := s.repo.FindByID(id)
+func (s *productService) UpdateProduct(ctx context.Context, id uint, req *models.UpdateProductRequest) (*models.Product, error) {
+	product, err := s.repo.FindByID(ctx, id)
 	if err != nil {
 		return nil, err
 	}
@@ -90,22 +101,25 @@ func (s *productService) UpdateProduct(id uint, req *models.UpdateProductRequest
 	if req.Price != nil {
 		product.Price = *req.Price
 	}
+	previous := product.Quantity
 	if req.Quantity != nil {
 		product.Quantity = *req.Quantity
 	}
 
 	product.UpdatedAt = time.Now()
 
-	if err := s.repo.Update(product); err != nil {
+	if err := s.repo.Update(ctx, product); err != nil {
 		return nil, err
 	}
+	metrics.ProductChanged(metrics.OpUpdate)
+	s.notifyLowStock(ctx, product, previous)
 
 	return product, nil
 }
 
 // UpdateStock updates only the stock quantity of a product.
-func (s *productService) UpdateStock(id uint, quantity int) (*models.Product, error) {
-	product, err := s.repo.FindByID(id)
+func (s *productService) UpdateStock(ctx context.Context, id uint, quantity int) (*models.Product, error) {
+	product, err := s.repo.FindByID(ctx, id)
 	if err != nil {
 		return nil, err
 	}
@@ -113,19 +127,22 @@ func (s *productService) UpdateStock(id uint, quantity int) (*models.Product, er
 		return nil, errors.New("product not found")
 	}
 
+	previous := product.Quantity
 	product.Quantity = quantity
 	product.UpdatedAt = time.Now()
 
-	if err := s.repo.Update(product); err != nil {
+	if err := s.repo.Update(ctx, product); err != nil {
 		return nil, err
 	}
+	metrics.ProductChanged(metrics.OpStock)
+	s.notifyLowStock(ctx, product, previous)
 
 	return product, nil
 }
 
 // DeleteProduct removes a product from the system.
-func (s *productService) DeleteProduct(id uint) error {
-	product, err := s.repo.FindByID(id)
+func (s *productService) DeleteProduct(ctx context.Context, id uint) error {
+	product, err := s.repo.FindByID(ctx, id)
 	if err != nil {
 		return err
 	}
@@ -133,5 +150,39 @@ func (s *productService) DeleteProduct(id uint) error {
 		return errors.New("product not found")
 	}
 
-	return s.repo.Delete(id)
+	if err := s.repo.Delete(ctx, id); err != nil {
+		return err
+	}
+	metrics.ProductChanged(metrics.OpDelete)
+	return nil
+}
+
+// DeleteSellerProducts removes every product of a seller whose account was deleted.
+func (s *productService) DeleteSellerProducts(ctx context.Context, sellerID uint) error {
+	deleted, err := s.repo.DeleteBySellerID(ctx, sellerID)
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		logging.FromContext(ctx).Info("deleted products of deleted seller", "seller_id", sellerID, "products", deleted)
+	}
+	return nil
+}
+
+// notifyLowStock tells the seller when a stock change took product from above
+// the low stock threshold to the threshold or below.
+func (s *productService) notifyLowStock(ctx context.Context, product *models.Product, previous int) {
+	if s.lowStockThreshold <= 0 || previous <= s.lowStockThreshold || product.Quantity > s.lowStockThreshold {
+		return
+	}
+	s.notifier.Send(ctx, notify.Notification{
+		UserID: product.SellerID,
+		Type:   notify.TypeLowStock,
+		Payload: map[string]any{
+			"product_id":   product.ID,
+			"product_name": product.Name,
+			"quantity":     product.Quantity,
+		},
+		DedupKey: fmt.Sprintf("low_stock:%d:%d", product.ID, product.UpdatedAt.UnixNano()),
+	})
 }
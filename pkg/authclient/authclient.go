@@ -0,0 +1,10 @@
+// Package authclient holds the client side of AuthService shared by the API
+// gateway, ProductService and OrderService: verifying access tokens with the
+// published signing keys (jwks), syncing the token revocation list
+// (revocation), applying user account events (userevents) and sending
+// notifications to users (notify). Services reference this module with a replace directive
+// pointing at pkg/authclient.
+package authclient
+
+// InternalTokenHeader carries the shared token expected by AuthService's /internal endpoints.
+const InternalTokenHeader = "X-Internal-Token"
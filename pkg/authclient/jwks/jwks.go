@@ -0,0 +1,203 @@
+// Package jwks verifies access tokens with the public keys AuthService
+// publishes at /.well-known/jwks.json, kept in a local cache.
+package jwks
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Methods are the signing algorithms accepted for access tokens.
+var Methods = []string{"RS256", "EdDSA"}
+
+// minRefetchInterval bounds how often tokens with an unknown kid trigger a
+// fetch, so forged kids cannot flood AuthService. Periodic fetches do not count.
+const minRefetchInterval = 10 * time.Second
+
+// jwk is a key of the published key set.
+type jwk struct {
+	KeyType string `json:"kty"`
+	Use     string `json:"use"`
+	Alg     string `json:"alg"`
+	KID     string `json:"kid"`
+	Curve   string `json:"crv"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+	X       string `json:"x"`
+}
+
+// publicKey is a verification key and the algorithm it is used with.
+type publicKey struct {
+	alg string
+	key crypto.PublicKey
+}
+
+// Cache holds the public keys fetched from a JWKS URL. Keys are refreshed
+// periodically by Run and on demand when a token names an unknown kid, so new
+// keys are picked up as soon as AuthService rotates.
+type Cache struct {
+	url    string
+	client *http.Client
+
+	fetchMu sync.Mutex
+
+	mu          sync.RWMutex
+	keys        map[string]publicKey
+	refetchedAt time.Time
+}
+
+// NewCache creates an empty cache for the key set at url.
+func NewCache(url string) *Cache {
+	return &Cache{
+		url:    url,
+		client: &http.Client{Timeout: 5 * time.Second},
+		keys:   map[string]publicKey{},
+	}
+}
+
+// Keyfunc resolves the public key that verifies token from its kid header.
+// Use it with jwt.Parse together with jwt.WithValidMethods(Methods).
+func (c *Cache) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, errors.New("token has no kid header")
+	}
+
+	key, ok := c.lookup(kid)
+	if !ok && c.claimRefetch() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := c.Refresh(ctx); err != nil {
+			return nil, fmt.Errorf("fetch signing keys: %w", err)
+		}
+		key, ok = c.lookup(kid)
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if token.Method.Alg() != key.alg {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return key.key, nil
+}
+
+// Run fetches the key set immediately and then every interval until ctx is
+// done. Failed fetches are logged and the cached keys stay in use.
+func (c *Cache) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := c.Refresh(ctx); err != nil && ctx.Err() == nil {
+			slog.Warn("signing key fetch failed", "url", c.url, "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh replaces the cached keys with the currently published key set.
+func (c *Cache) Refresh(ctx context.Context) error {
+	c.fetchMu.Lock()
+	defer c.fetchMu.Unlock()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("key set returned status %d", resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return fmt.Errorf("decode key set: %w", err)
+	}
+
+	keys := make(map[string]publicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.KID == "" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		pk, err := k.publicKey()
+		if err != nil {
+			slog.Warn("skipping unusable signing key", "kid", k.KID, "error", err)
+			continue
+		}
+		keys[k.KID] = pk
+	}
+
+	c.mu.Lock()
+	c.keys = keys
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *Cache) lookup(kid string) (publicKey, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	k, ok := c.keys[kid]
+	return k, ok
+}
+
+// claimRefetch reports whether an unknown kid may trigger a fetch now and,
+// if so, records it.
+func (c *Cache) claimRefetch() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Since(c.refetchedAt) < minRefetchInterval {
+		return false
+	}
+	c.refetchedAt = time.Now()
+	return true
+}
+
+// publicKey decodes an RSA or Ed25519 JWK.
+func (k jwk) publicKey() (publicKey, error) {
+	switch {
+	case k.KeyType == "RSA" && k.Alg == "RS256":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return publicKey{}, fmt.Errorf("invalid modulus: %w", err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return publicKey{}, errors.New("invalid exponent")
+		}
+		return publicKey{alg: k.Alg, key: &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}}, nil
+	case k.KeyType == "OKP" && k.Curve == "Ed25519" && k.Alg == "EdDSA":
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return publicKey{}, errors.New("invalid Ed25519 key")
+		}
+		return publicKey{alg: k.Alg, key: ed25519.PublicKey(x)}, nil
+	default:
+		return publicKey{}, fmt.Errorf("unsupported key type %s/%s", k.KeyType, k.Alg)
+	}
+}
@@ -0,0 +1,127 @@
+// Package notify sends notifications to users through AuthService's
+// /internal/notifications endpoint.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"authclient"
+)
+
+// Notification types AuthService has message templates for.
+const (
+	TypeOrderPlaced        = "order.placed"
+	TypeOrderReceived      = "order.received"
+	TypeOrderStatusChanged = "order.status_changed"
+	TypeLowStock           = "product.low_stock"
+)
+
+// requestIDHeader carries the correlation ID of the request that caused a notification.
+const requestIDHeader = "X-Request-ID"
+
+// maxAttempts is how often a request is tried before its notifications are dropped.
+const maxAttempts = 4
+
+// Notification is a notification for a user. AuthService renders its message
+// from the template of Type with the fields of Payload and stores it once per
+// user and DedupKey.
+type Notification struct {
+	UserID   uint           `json:"user_id"`
+	Type     string         `json:"type"`
+	Payload  map[string]any `json:"payload,omitempty"`
+	DedupKey string         `json:"dedup_key"`
+}
+
+// Sender delivers notifications to AuthService. A nil Sender drops them.
+type Sender struct {
+	url       string
+	token     string
+	requestID func(context.Context) string
+	client    *http.Client
+}
+
+// NewSender creates a sender posting to url (AuthService's
+// /internal/notifications endpoint) with the shared internal token.
+// requestID, when not nil, returns the calling service's request ID stored in
+// a context; it is forwarded to AuthService and logged with failed deliveries.
+func NewSender(url, token string, requestID func(context.Context) string) *Sender {
+	return &Sender{url: url, token: token, requestID: requestID, client: &http.Client{Timeout: 5 * time.Second}}
+}
+
+// Send delivers up to 100 notifications in the background so the caller does
+// not wait for AuthService. Failed requests are retried with backoff; the
+// dedup keys keep a retry from notifying twice. Notifications still failing
+// after the last attempt are logged and dropped.
+func (s *Sender) Send(ctx context.Context, notifications ...Notification) {
+	if s == nil || len(notifications) == 0 {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		backoff := time.Second
+		for attempt := 1; ; attempt++ {
+			retry, err := s.post(ctx, notifications)
+			if err == nil {
+				return
+			}
+			if !retry || attempt == maxAttempts {
+				s.logger(ctx).WarnContext(ctx, "failed to send notifications",
+					"count", len(notifications), "attempts", attempt, "error", err)
+				return
+			}
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}()
+}
+
+// post sends one batch and reports whether a failure is worth retrying.
+func (s *Sender) post(ctx context.Context, notifications []Notification) (retry bool, err error) {
+	body, err := json.Marshal(notifications)
+	if err != nil {
+		return false, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(authclient.InternalTokenHeader, s.token)
+	if id := s.requestIDOf(ctx); id != "" {
+		req.Header.Set(requestIDHeader, id)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return false, nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return resp.StatusCode >= 500, fmt.Errorf("auth service returned status %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+}
+
+// requestIDOf returns the request ID stored in ctx, if any.
+func (s *Sender) requestIDOf(ctx context.Context) string {
+	if s.requestID == nil {
+		return ""
+	}
+	return s.requestID(ctx)
+}
+
+// logger returns the default logger annotated with the request ID of ctx.
+func (s *Sender) logger(ctx context.Context) *slog.Logger {
+	if id := s.requestIDOf(ctx); id != "" {
+		return slog.Default().With("request_id", id)
+	}
+	return slog.Default()
+}
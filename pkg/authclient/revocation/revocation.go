@@ -0,0 +1,192 @@
+// Package revocation keeps a local copy of AuthService's access token
+// revocation list so revoked tokens can be rejected without a remote call.
+package revocation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"authclient"
+)
+
+// entry is a revocation list entry as served by AuthService.
+type entry struct {
+	ID           uint       `json:"id"`
+	JTI          string     `json:"jti"`
+	UserID       uint       `json:"user_id"`
+	IssuedBefore *time.Time `json:"issued_before"`
+	ExpiresAt    time.Time  `json:"expires_at"`
+}
+
+// userRevocation revokes every token of a user issued before issuedBefore;
+// see revokedBefore.
+type userRevocation struct {
+	issuedBefore time.Time
+	expiresAt    time.Time
+}
+
+// List is a locally cached revocation list, refreshed by polling AuthService.
+// A nil *List revokes nothing.
+type List struct {
+	feedURL string
+	token   string
+	client  *http.Client
+
+	mu     sync.RWMutex
+	cursor uint
+	tokens map[string]time.Time
+	users  map[uint]userRevocation
+}
+
+// NewList creates a list synced from feedURL (AuthService's
+// /internal/revocations endpoint) using the shared internal token.
+func NewList(feedURL, token string) *List {
+	return &List{
+		feedURL: feedURL,
+		token:   token,
+		client:  &http.Client{Timeout: 5 * time.Second},
+		tokens:  map[string]time.Time{},
+		users:   map[uint]userRevocation{},
+	}
+}
+
+// IsRevoked reports whether the token with the given jti, issued to userID at
+// issuedAt, has been revoked.
+func (l *List) IsRevoked(jti string, userID uint, issuedAt time.Time) bool {
+	if l == nil {
+		return false
+	}
+	now := time.Now()
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if exp, ok := l.tokens[jti]; ok && jti != "" && now.Before(exp) {
+		return true
+	}
+	if u, ok := l.users[userID]; ok && now.Before(u.expiresAt) && revokedBefore(issuedAt, u.issuedBefore) {
+		return true
+	}
+	return false
+}
+
+// IssuedAt returns when a token was issued. Access tokens carry their issue
+// time in milliseconds in the iat_ms claim; for tokens without it the whole
+// second of iat is used.
+func IssuedAt(iat *jwt.NumericDate, iatMs int64) time.Time {
+	switch {
+	case iatMs > 0:
+		return time.UnixMilli(iatMs)
+	case iat != nil:
+		return iat.Time
+	default:
+		return time.Time{}
+	}
+}
+
+// revokedBefore reports whether a token issued at issuedAt is covered by a
+// revocation of every token issued before cutoff. AuthService records cutoffs
+// in whole milliseconds, so the token handed out right after a revocation,
+// e.g. by a password change, is not covered while every earlier one is.
+// Tokens without iat_ms are covered when issued in the cutoff's second.
+func revokedBefore(issuedAt, cutoff time.Time) bool {
+	return issuedAt.Before(cutoff)
+}
+
+// Run syncs the list immediately and then every interval until ctx is done.
+// Failed syncs are logged and the last known list stays in use.
+func (l *List) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := l.Sync(ctx); err != nil && ctx.Err() == nil {
+			slog.Warn("revocation list sync failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sync fetches the entries added since the last sync and drops expired ones.
+func (l *List) Sync(ctx context.Context) error {
+	l.mu.RLock()
+	cursor := l.cursor
+	l.mu.RUnlock()
+
+	u, err := url.Parse(l.feedURL)
+	if err != nil {
+		return fmt.Errorf("parse feed url: %w", err)
+	}
+	q := u.Query()
+	q.Set("after", strconv.FormatUint(uint64(cursor), 10))
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(authclient.InternalTokenHeader, l.token)
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("revocation feed returned status %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Revocations []entry `json:"revocations"`
+		Cursor      uint    `json:"cursor"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return fmt.Errorf("decode revocation feed: %w", err)
+	}
+
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, e := range body.Revocations {
+		switch {
+		case e.JTI != "":
+			l.tokens[e.JTI] = e.ExpiresAt
+		case e.IssuedBefore != nil:
+			u := l.users[e.UserID]
+			if e.IssuedBefore.After(u.issuedBefore) {
+				u.issuedBefore = *e.IssuedBefore
+			}
+			if e.ExpiresAt.After(u.expiresAt) {
+				u.expiresAt = e.ExpiresAt
+			}
+			l.users[e.UserID] = u
+		}
+	}
+	if body.Cursor > l.cursor {
+		l.cursor = body.Cursor
+	}
+	for jti, exp := range l.tokens {
+		if now.After(exp) {
+			delete(l.tokens, jti)
+		}
+	}
+	for id, u := range l.users {
+		if now.After(u.expiresAt) {
+			delete(l.users, id)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package revocation
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"authclient"
+)
+
+func TestIssuedAt(t *testing.T) {
+	iat := time.Unix(1700000000, 0)
+	tests := []struct {
+		name  string
+		iat   *jwt.NumericDate
+		iatMs int64
+		want  time.Time
+	}{
+		{"milliseconds", jwt.NewNumericDate(iat), iat.UnixMilli() + 250, iat.Add(250 * time.Millisecond)},
+		{"seconds only", jwt.NewNumericDate(iat), 0, iat},
+		{"neither", nil, 0, time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IssuedAt(tt.iat, tt.iatMs); !got.Equal(tt.want) {
+				t.Fatalf("IssuedAt() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsRevokedUserCutoff(t *testing.T) {
+	// Cutoffs are recorded in whole milliseconds
+	cutoff := time.Unix(1700000000, 0).Add(600 * time.Millisecond)
+	second := time.Unix(1700000000, 0)
+	tests := []struct {
+		name     string
+		issuedAt time.Time
+		want     bool
+	}{
+		{"earlier second", second.Add(-time.Second), true},
+		{"before the cutoff in the same second", IssuedAt(nil, cutoff.UnixMilli()-100), true},
+		{"just before the cutoff", IssuedAt(nil, cutoff.UnixMilli()-1), true},
+		{"at the cutoff", IssuedAt(nil, cutoff.UnixMilli()), false},
+		{"after the cutoff in the same second", IssuedAt(nil, cutoff.UnixMilli()+100), false},
+		{"next second", IssuedAt(jwt.NewNumericDate(second.Add(time.Second)), 0), false},
+		{"same second without iat_ms", IssuedAt(jwt.NewNumericDate(second), 0), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewList("", "")
+			l.users[7] = userRevocation{issuedBefore: cutoff, expiresAt: time.Now().Add(time.Hour)}
+			if got := l.IsRevoked("", 7, tt.issuedAt); got != tt.want {
+				t.Fatalf("IsRevoked(issued %v, cutoff %v) = %v, want %v", tt.issuedAt, cutoff, got, tt.want)
+			}
+			if l.IsRevoked("", 8, tt.issuedAt) {
+				t.Fatal("revocation applies to another user")
+			}
+		})
+	}
+}
+
+func TestIsRevokedNilList(t *testing.T) {
+	var l *List
+	if l.IsRevoked("jti", 1, time.Now()) {
+		t.Fatal("nil list revoked a token")
+	}
+}
+
+func TestSync(t *testing.T) {
+	now := time.Now().UTC()
+	cutoff := now.Add(-time.Minute).Truncate(time.Millisecond)
+	later := cutoff.Add(30 * time.Second)
+	// Each sync gets the next page; the feed checks the cursor it is sent
+	pages := []struct {
+		after  string
+		status int
+		body   string
+	}{
+		{"0", http.StatusOK, mustJSON(t, map[string]interface{}{
+			"revocations": []entry{
+				{ID: 1, JTI: "live", ExpiresAt: now.Add(time.Hour)},
+				{ID: 2, JTI: "stale", ExpiresAt: now.Add(-time.Second)},
+				{ID: 3, UserID: 9, IssuedBefore: &cutoff, ExpiresAt: now.Add(-time.Second)},
+				{ID: 4, UserID: 7, IssuedBefore: &cutoff, ExpiresAt: now.Add(time.Hour)},
+			},
+			"cursor": 4,
+		})},
+		{"4", http.StatusInternalServerError, ""},
+		{"4", http.StatusOK, mustJSON(t, map[string]interface{}{
+			"revocations": []entry{{ID: 5, UserID: 7, IssuedBefore: &later, ExpiresAt: now.Add(2 * time.Hour)}},
+			"cursor":      5,
+		})},
+		{"5", http.StatusOK, `{"revocations":[],"cursor":5}`},
+	}
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(authclient.InternalTokenHeader) != "secret" {
+			t.Errorf("sync %d: internal token = %q", calls, r.Header.Get(authclient.InternalTokenHeader))
+		}
+		page := pages[calls]
+		calls++
+		if got := r.URL.Query().Get("after"); got != page.after {
+			t.Errorf("sync %d: after = %q, want %q", calls, got, page.after)
+		}
+		w.WriteHeader(page.status)
+		_, _ = w.Write([]byte(page.body))
+	}))
+	defer srv.Close()
+	l := NewList(srv.URL+"/internal/revocations", "secret")
+
+	checks := []struct {
+		wantErr bool
+		// issued between cutoff and later: revoked once the second revocation is synced
+		wantBetween bool
+	}{
+		{false, false},
+		{true, false},
+		{false, true},
+		{false, true},
+	}
+	between := cutoff.Add(time.Second)
+	for i, c := range checks {
+		if err := l.Sync(context.Background()); (err != nil) != c.wantErr {
+			t.Fatalf("sync %d: err = %v, want error %v", i, err, c.wantErr)
+		}
+		if !l.IsRevoked("live", 1, now) {
+			t.Errorf("sync %d: revoked jti not found", i)
+		}
+		if !l.IsRevoked("other", 7, cutoff.Add(-time.Second)) {
+			t.Errorf("sync %d: token before the cutoff not revoked", i)
+		}
+		if got := l.IsRevoked("other", 7, between); got != c.wantBetween {
+			t.Errorf("sync %d: token issued between cutoffs revoked = %v, want %v", i, got, c.wantBetween)
+		}
+	}
+	if _, ok := l.tokens["stale"]; ok {
+		t.Error("expired token revocation kept")
+	}
+	if _, ok := l.users[9]; ok {
+		t.Error("expired user revocation kept")
+	}
+	if l.cursor != 5 {
+		t.Errorf("cursor = %d, want 5", l.cursor)
+	}
+}
+
+func mustJSON(t *testing.T, v interface{}) string {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
@@ -0,0 +1,128 @@
+// Package userevents applies AuthService's user account events, such as
+// deleted accounts, to the calling service's data.
+package userevents
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"authclient"
+)
+
+// EventDeleted is the type of the event emitted when a user deletes their account.
+const EventDeleted = "user.deleted"
+
+// event is a user event as served by AuthService.
+type event struct {
+	ID     uint   `json:"id"`
+	UserID uint   `json:"user_id"`
+	Type   string `json:"type"`
+}
+
+// Handler applies an event to the data of userID. It must be idempotent:
+// events are delivered again after a restart or a failed sync.
+type Handler func(ctx context.Context, userID uint) error
+
+// Feed polls AuthService for user events and passes them to the handler
+// registered for their type. Events without a handler are skipped.
+type Feed struct {
+	feedURL  string
+	token    string
+	client   *http.Client
+	handlers map[string]Handler
+
+	mu     sync.Mutex
+	cursor uint
+}
+
+// NewFeed creates a feed read from feedURL (AuthService's /internal/user-events
+// endpoint) using the shared internal token.
+func NewFeed(feedURL, token string, handlers map[string]Handler) *Feed {
+	return &Feed{
+		feedURL:  feedURL,
+		token:    token,
+		client:   &http.Client{Timeout: 5 * time.Second},
+		handlers: handlers,
+	}
+}
+
+// Run syncs the feed immediately and then every interval until ctx is done.
+// Failed syncs are logged and retried from the first unapplied event.
+func (f *Feed) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := f.Sync(ctx); err != nil && ctx.Err() == nil {
+			slog.Warn("user event sync failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sync fetches the events added since the last sync, page by page, and
+// applies them in order. It stops at the first event whose handler fails.
+func (f *Feed) Sync(ctx context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for {
+		events, err := f.fetch(ctx)
+		if err != nil || len(events) == 0 {
+			return err
+		}
+		for _, e := range events {
+			if h, ok := f.handlers[e.Type]; ok {
+				if err := h(ctx, e.UserID); err != nil {
+					return fmt.Errorf("apply %s event %d for user %d: %w", e.Type, e.ID, e.UserID, err)
+				}
+				slog.InfoContext(ctx, "user event applied", "type", e.Type, "event_id", e.ID, "user_id", e.UserID)
+			}
+			f.cursor = e.ID
+		}
+	}
+}
+
+// fetch requests the events after the current cursor.
+func (f *Feed) fetch(ctx context.Context) ([]event, error) {
+	u, err := url.Parse(f.feedURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse feed url: %w", err)
+	}
+	q := u.Query()
+	q.Set("after", strconv.FormatUint(uint64(f.cursor), 10))
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(authclient.InternalTokenHeader, f.token)
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("user event feed returned status %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Events []event `json:"events"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("decode user event feed: %w", err)
+	}
+	return body.Events, nil
+}